@@ -0,0 +1,38 @@
+package main
+
+import "time"
+
+// altText describes the heatmap of tweets in a sentence for those who cannot
+// see it: the title, the days it covers, how many were active, the total,
+// the busiest day and the longest streak, as in "Tweet Activity Heatmap, Jan
+// 1 to Dec 31 2024: 212 active days, 3,482 in total, busiest day Mar 3 with
+// 41, longest streak 19 days." It is the <desc> of SVG images, the alt of
+// -image-map's <img> and what -alt-text writes.
+func altText(tweets []DailyTweet, opts renderOptions) string {
+	return describeHeatmap(newHeatmap(tweets, opts), opts)
+}
+
+// describeHeatmap is altText for a heatmap already built.
+func describeHeatmap(hm heatmap, opts renderOptions) string {
+	days := hm.shown()
+	if len(days) == 0 {
+		return trf("%s: no data.", opts.Title)
+	}
+	sum := summarize(days)
+	// The year goes with the last date, and with the others only when
+	// theirs differs.
+	date := func(t time.Time) string {
+		if t.Year() == sum.to.Year() {
+			return t.Format(tr("Jan 2"))
+		}
+		return t.Format(tr("Jan 2 2006"))
+	}
+	text := trf("%s, %s to %s: ", opts.Title, date(sum.from), sum.to.Format(tr("Jan 2 2006")))
+	if sum.active == 0 {
+		return text + tr("no activity.")
+	}
+	active := trn("%s active day", "%s active days", sum.active, formatCount(sum.active))
+	streak := trn("%d day", "%d days", sum.longestStreak, sum.longestStreak)
+	return text + trf("%s, %s in total, busiest day %s with %s, longest streak %s.",
+		active, formatCount(sum.total), date(sum.best.Date), formatCount(sum.best.Count), streak)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"time"
+)
+
+// Anki starts a new day at 4am by default, so reviews done shortly after
+// midnight count toward the previous day just as they do in Anki's own
+// statistics.
+const ankiRollover = 4 * time.Hour
+
+// revlog.type values up to this one are real reviews (learning, review,
+// relearning, filtered); later ones are manual reschedules.
+const ankiLastReviewType = 3
+
+// readAnkiRevlog reads the review log from an Anki collection, given either
+// as the collection SQLite file itself or as an exported .colpkg/.apkg
+// package, and returns the number of reviews per day.
+func readAnkiRevlog(filename string, limits inputLimits) ([]DailyTweet, error) {
+	data, err := limits.readFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte("PK")) {
+		data, err = ankiCollectionFromPackage(data, limits)
+		if err != nil {
+			return nil, errorf("%s: %w", filename, err)
+		}
+	}
+
+	db, err := openSQLite(data)
+	if err != nil {
+		return nil, errorf("%s: %w", filename, err)
+	}
+	root, err := db.tableRoot("revlog")
+	if err != nil {
+		return nil, errorf("%s: %w", filename, err)
+	}
+
+	totals := make(map[civilDate]int)
+	err = db.scanTable(root, func(id int64, record []interface{}) error {
+		// The last column is the review type.
+		if len(record) > 0 {
+			if t, ok := record[len(record)-1].(int64); ok && t > ankiLastReviewType {
+				return nil
+			}
+		}
+		// The id is the review time in milliseconds.
+		reviewed := time.UnixMilli(id).Add(-ankiRollover)
+		totals[civil(reviewed)]++
+		return nil
+	})
+	if err != nil {
+		return nil, errorf("%s: %w", filename, err)
+	}
+
+	return dailyTotals(totals), nil
+}
+
+// ankiCollectionFromPackage extracts the collection database from an
+// exported package, failing on one that unpacks past -max-bytes.
+func ankiCollectionFromPackage(data []byte, limits inputLimits) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	// Packages from current Anki versions also hold a placeholder
+	// collection.anki2, so prefer the newer name.
+	for _, name := range []string{"collection.anki21", "collection.anki2"} {
+		if f, ok := files[name]; ok {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return limits.readAll(rc, name)
+		}
+	}
+
+	if _, ok := files["collection.anki21b"]; ok {
+		return nil, errors.New(tr("package uses the compressed collection format; re-export with \"Support older Anki versions\" enabled"))
+	}
+	return nil, errors.New(tr("no collection found in package"))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// A day is unusual when its count is more than k median absolute
+// deviations (MAD) from the median of the anomalyWindow days before it.
+// A day with data is measured against the days with data among them, so
+// sparse data, whose median is zero, does not make every active day
+// unusual. A day without data is measured against all of them, as zero, so
+// a day missing from busy data is an outage and one missing from sparse
+// data is not. Unlike a mean, the median is not pulled along by the spikes
+// it is there to find.
+const (
+	anomalyWindow = 28
+	// minAnomalyHistory is how many days of its window a day needs to be
+	// judged, so the first days of the data are not all unusual.
+	minAnomalyHistory = 7
+	// defaultAnomalyK is the k of stats, about 3.4 standard deviations of
+	// normally distributed data.
+	defaultAnomalyK = 5
+)
+
+// anomaly is an unusual day, with the median of the days before it.
+type anomaly struct {
+	DailyTweet
+	baseline float64
+}
+
+// findAnomalies returns the unusual days from the first day with data to
+// the last, in date order. A deviation of the window under one count is
+// taken as one, or data that rarely changes would make every change
+// unusual.
+func findAnomalies(tweets []DailyTweet, k float64) []anomaly {
+	if len(tweets) == 0 || k <= 0 {
+		return nil
+	}
+	var (
+		history []float64
+		found   []anomaly
+	)
+	i := 0
+	last := tweets[len(tweets)-1].Date
+	for d := tweets[0].Date; !d.After(last); d = addDate(d, 0, 0, 1) {
+		n := 0
+		if i < len(tweets) && tweets[i].Date.Equal(d) {
+			n = tweets[i].Count
+			i++
+		}
+		window := history
+		if n != 0 {
+			window = active(history)
+		}
+		if len(window) >= minAnomalyHistory {
+			baseline := median(window)
+			deviations := make([]float64, len(window))
+			for j, h := range window {
+				deviations[j] = math.Abs(h - baseline)
+			}
+			mad := math.Max(median(deviations), 1)
+			if math.Abs(float64(n)-baseline) > k*mad {
+				found = append(found, anomaly{DailyTweet{Date: d, Count: n}, baseline})
+			}
+		}
+		history = append(history, float64(n))
+		if len(history) > anomalyWindow {
+			history = history[1:]
+		}
+	}
+	return found
+}
+
+// active returns the days of history with data.
+func active(history []float64) []float64 {
+	var counts []float64
+	for _, h := range history {
+		if h != 0 {
+			counts = append(counts, h)
+		}
+	}
+	return counts
+}
+
+// median returns the median of values, which it leaves unchanged.
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+// anomalyDates returns the dates of the unusual days, for looking up.
+func anomalyDates(anomalies []anomaly) map[civilDate]bool {
+	dates := make(map[civilDate]bool, len(anomalies))
+	for _, a := range anomalies {
+		dates[civil(a.Date)] = true
+	}
+	return dates
+}
+
+// checkAnomalies validates -anomalies; zero draws no outlines.
+func checkAnomalies(k float64) (float64, error) {
+	if math.IsNaN(k) || k < 0 || math.IsInf(k, 0) {
+		return 0, usageError(trf("anomalies must be a positive number of median absolute deviations, or 0, not %v", k))
+	}
+	return k, nil
+}
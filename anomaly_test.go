@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestAnomaliesSparseData checks input.csv, active on about one day in
+// three: measured against windows that are mostly zero, nearly every day
+// with data was unusual.
+func TestAnomaliesSparseData(t *testing.T) {
+	tweets, err := readCSV("input.csv", "", defaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := findAnomalies(tweets, defaultAnomalyK)
+	if len(found) > len(tweets)/20 {
+		t.Errorf("%d of %d days with data are unusual, want at most %d", len(found), len(tweets), len(tweets)/20)
+	}
+	for _, a := range found {
+		if a.baseline == 0 {
+			t.Errorf("%s is unusual against a median of zero", a.Date.Format("2006-01-02"))
+		}
+	}
+}
+
+// dailyCounts returns a day of data for each count, from 2024-01-01, with
+// the zeros left out.
+func dailyCounts(counts ...int) []DailyTweet {
+	var tweets []DailyTweet
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for i, n := range counts {
+		if n != 0 {
+			tweets = append(tweets, DailyTweet{Date: addDate(start, 0, 0, i), Count: n})
+		}
+	}
+	return tweets
+}
+
+func TestAnomalies(t *testing.T) {
+	repeat := func(pattern []int, n int) []int {
+		var counts []int
+		for len(counts) < n {
+			counts = append(counts, pattern...)
+		}
+		return counts[:n]
+	}
+	tests := []struct {
+		name   string
+		counts []int
+		want   []int // days after 2024-01-01
+	}{
+		{"outage in busy data", append(repeat([]int{98, 100, 103}, 30), 0, 101), []int{30}},
+		{"spike in sparse data", append(repeat([]int{0, 0, 5, 0, 6, 0, 4}, 63), 40), []int{63}},
+		{"gaps in sparse data", repeat([]int{0, 0, 5, 0, 6, 0, 4}, 70), nil},
+	}
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, a := range findAnomalies(dailyCounts(tt.counts...), defaultAnomalyK) {
+				got = append(got, int(a.Date.Sub(start).Hours()/24))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unusual days %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
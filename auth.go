@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAuth wraps next so requests must carry the bearer token or the
+// basic-auth credentials, whichever are configured. Empty credentials are
+// not checked; with neither set, next is returned unchanged.
+func requireAuth(next http.Handler, token, basicUser, basicPassword string) http.Handler {
+	if token == "" && basicUser == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && secureEqual(bearer, token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if basicUser != "" {
+			if user, password, ok := r.BasicAuth(); ok && secureEqual(user, basicUser) && secureEqual(password, basicPassword) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="heatmap", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="heatmap"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"strings"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// defaultBadgeMessage is the message template of -badge.
+const defaultBadgeMessage = "🔥 {{.CurrentStreak}}-day streak"
+
+// badgeFlags are the flags that write a shields-style badge summarizing
+// the data next to the image, for a README to show beside the heatmap.
+type badgeFlags struct {
+	path    string
+	label   string
+	message string
+}
+
+func addBadgeFlags(fs *flag.FlagSet) *badgeFlags {
+	b := &badgeFlags{}
+	fs.StringVar(&b.path, "badge", "", "also write an SVG badge summarizing the data to this file")
+	fs.StringVar(&b.label, "badge-label", "", "text of the gray left part of the badge (default none)")
+	fs.StringVar(&b.message, "badge-message", defaultBadgeMessage, "Go template of the badge message, with the fields of -caption, e.g. '{{commas .Total}} tweets this year'")
+	return b
+}
+
+func (b *badgeFlags) check() error {
+	if b.path == "" {
+		return nil
+	}
+	_, err := parseTemplate("badge-message", b.message)
+	return err
+}
+
+// write renders the badge in the colors of the theme and writes it to the
+// -badge file.
+func (b *badgeFlags) write(caption captionData, t theme) error {
+	tmpl, err := parseTemplate("badge-message", b.message)
+	if err != nil {
+		return err
+	}
+	var message strings.Builder
+	if err := tmpl.Execute(&message, caption); err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, generateBadge(b.label, message.String(), t.Colors[len(t.Colors)-1]), 0o644)
+}
+
+// generateBadge draws a badge in the flat style of shields.io: the label on
+// gray, if any, and the message on the given color.
+func generateBadge(label, message string, c color.RGBA) []byte {
+	const height, padding = 20, 6
+	labelWidth := 0
+	if label != "" {
+		labelWidth = badgeTextWidth(label) + 2*padding
+	}
+	messageWidth := badgeTextWidth(message) + 2*padding
+	width := labelWidth + messageWidth
+
+	// Dark text keeps light colors readable.
+	textColor, shadow := "#fff", "#010101"
+	if luminance(c) > 0.6 {
+		textColor, shadow = "#333", "#ccc"
+	}
+
+	alt := message
+	if label != "" {
+		alt = label + ": " + message
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" role="img" aria-label="`, width, height)
+	xml.EscapeText(&buf, []byte(alt))
+	buf.WriteString("\">\n<title>")
+	xml.EscapeText(&buf, []byte(alt))
+	buf.WriteString("</title>\n")
+	buf.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` + "\n")
+	fmt.Fprintf(&buf, `<clipPath id="r"><rect width="%d" height="%d" rx="3" fill="#fff"/></clipPath>`+"\n", width, height)
+	buf.WriteString(`<g clip-path="url(#r)">` + "\n")
+	if labelWidth > 0 {
+		fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#555"/>`+"\n", labelWidth, height)
+	}
+	fmt.Fprintf(&buf, `<rect x="%d" width="%d" height="%d" fill="%s"/>`+"\n", labelWidth, messageWidth, height, hexColor(c))
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="url(#s)"/>`+"\n", width, height)
+	buf.WriteString("</g>\n")
+	buf.WriteString(`<g text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` + "\n")
+	if labelWidth > 0 {
+		badgeText(&buf, labelWidth/2, label, "#fff", "#010101")
+	}
+	badgeText(&buf, labelWidth+messageWidth/2, message, textColor, shadow)
+	buf.WriteString("</g>\n</svg>\n")
+	return buf.Bytes()
+}
+
+// badgeText writes centered text with the one-pixel shadow of flat badges.
+func badgeText(buf *bytes.Buffer, x int, s, fill, shadow string) {
+	for _, layer := range []struct {
+		y           int
+		fill, extra string
+	}{{15, shadow, ` fill-opacity=".3"`}, {14, fill, ""}} {
+		fmt.Fprintf(buf, `<text x="%d" y="%d" fill="%s"%s>`, x, layer.y, layer.fill, layer.extra)
+		xml.EscapeText(buf, []byte(s))
+		buf.WriteString("</text>\n")
+	}
+}
+
+// badgeTextWidth estimates the width of text in 11px Verdana, which runs
+// about a tenth wider than Go Regular. Characters the font lacks, such as
+// emoji, count as 14 pixels; joiners and variation selectors as nothing.
+func badgeTextWidth(s string) int {
+	face, err := cardFace("badge")
+	if err != nil {
+		return 7 * len([]rune(s))
+	}
+	var width fixed.Int26_6
+	for _, r := range s {
+		if r == 0x200d || 0xfe00 <= r && r <= 0xfe0f {
+			continue
+		}
+		if advance, ok := face.GlyphAdvance(r); ok && r < 0x2000 {
+			width += advance
+		} else {
+			width += fixed.I(14)
+		}
+	}
+	return int(math.Ceil(float64(width) / 64 * 1.1))
+}
+
+// luminance returns the relative luminance of a color from 0 to 1.
+func luminance(c color.RGBA) float64 {
+	return (0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)) / 255
+}
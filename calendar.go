@@ -0,0 +1,113 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// The calendar layout draws a wall calendar of twelve month blocks, four a
+// row unless -calendar-columns says otherwise, each a week a row from
+// Monday, under the month's name and the initials of the weekdays.
+const (
+	calendarColumns = 4
+	calendarHead    = 40 // the month name and weekday initials above a block
+	calendarWeeks   = 6  // rows a block has room for
+	minNumberCell   = 16 // the smallest cells day numbers fit in
+)
+
+// checkCalendar validates -calendar-columns and -day-numbers, which only
+// the calendar layout draws with.
+func checkCalendar(columns int, numbers bool, opts renderOptions) (int, bool, error) {
+	switch {
+	case columns < 1 || columns > monthsInYear:
+		return 0, false, usageError(trf("calendar-columns must be 1 to %d, not %d", monthsInYear, columns))
+	case numbers && opts.Layout != "calendar":
+		return 0, false, usageError(tr("-day-numbers needs -layout calendar"))
+	case numbers && opts.cellSize() < minNumberCell:
+		return 0, false, usageError(trf("day numbers need cells of %d pixels or more", minNumberCell))
+	}
+	return columns, numbers, nil
+}
+
+// calendarLayout arranges the twelve months up to the one the year of hm
+// ends in as blocks of weeks, Monday first, in rows of opts.CalendarColumns,
+// with the legend right of the first row and the panel and streaks the
+// options ask for.
+func calendarLayout(hm heatmap, opts renderOptions) layout {
+	cell, gap := opts.cellSize(), opts.Theme.Gap
+	face := opts.Theme.newFace()
+	t := opts.Theme
+	columns := opts.CalendarColumns
+	if columns == 0 {
+		columns = calendarColumns
+	}
+	blockWidth := daysInWeek*(cell+gap) - gap
+	blockHeight := calendarHead + calendarWeeks*(cell+gap) - gap
+	rows := (monthsInYear + columns - 1) / columns
+	left := 10
+	legendX := left + columns*(blockWidth+stackGap) - stackGap + 10
+	l := layout{width: legendX - 10 + legendWidth, height: titleHeight + rows*(blockHeight+stackGap) - stackGap + 10}
+	l.labels = append(l.labels, layoutText{10, 25, opts.Title})
+
+	end := addDate(hm.start, 1, 0, -1)
+	first := addDate(time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC), 0, -(monthsInYear - 1), 0)
+	var shown []DailyTweet
+	for i := 0; i < monthsInYear; i++ {
+		month := addDate(first, 0, i, 0)
+		x0 := left + i%columns*(blockWidth+stackGap)
+		y0 := titleHeight + i/columns*(blockHeight+stackGap)
+		l.labels = append(l.labels, layoutText{x0, y0 + 15, month.Format(opts.Theme.label("Jan 2006"))})
+		for d := 0; d < daysInWeek; d++ {
+			initial := firstRune(opts.Theme.label(weekdayNames[(d+1)%daysInWeek]))
+			l.addLabel(face, layoutText{x0 + d*(cell+gap) + cell/2 - 3, y0 + 32, initial})
+		}
+		offset := (int(month.Weekday()) + 6) % daysInWeek
+		for date := month; date.Month() == month.Month(); date = addDate(date, 0, 0, 1) {
+			slot := offset + date.Day() - 1
+			x, y := x0+slot%daysInWeek*(cell+gap), y0+calendarHead+slot/daysInWeek*(cell+gap)
+			c := dayCell(hm, date, image.Rect(x, y, x+cell, y+cell))
+			l.cells = append(l.cells, c)
+			if count, ok := hm.counts[civil(date)]; ok {
+				shown = append(shown, DailyTweet{Date: date, Count: count})
+			}
+		}
+	}
+	l.colorCategories(hm, l.cells, opts)
+	if opts.DayNumbers {
+		for _, c := range l.cells {
+			l.numbers = append(l.numbers, layoutSwatch{
+				color: contrasting(t, c.color),
+				label: layoutText{c.rect.Min.X + 2, c.rect.Min.Y + 12, strconv.Itoa(c.date.Day())},
+			})
+		}
+	}
+
+	sum := summary{}
+	if len(shown) > 0 {
+		sum = summarize(shown)
+	}
+	l.addLegend(face, hm, opts, legendX, titleHeight+calendarHead+10)
+	l.outlineUnusual(hm, l.cells, cell)
+	l.addSummary(face, sum, opts, legendX)
+	return l
+}
+
+// contrasting returns the text or background color of t, whichever stands
+// out more on c.
+func contrasting(t theme, c color.RGBA) color.RGBA {
+	lc := luminance(c)
+	if math.Abs(luminance(t.Text)-lc) >= math.Abs(luminance(t.Background)-lc) {
+		return t.Text
+	}
+	return t.Background
+}
+
+// firstRune returns the first letter of s, as the initial of a weekday.
+func firstRune(s string) string {
+	r, _ := utf8.DecodeRuneInString(s)
+	return string(r)
+}
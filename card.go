@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Social cards use the size OpenGraph and Twitter cards display best at.
+const (
+	cardWidth  = 1200
+	cardHeight = 630
+	cardMargin = 60
+	cardCell   = 18
+	cardGap    = 2
+)
+
+// cardFaceSpec is a face cards are drawn with: a font and its size.
+type cardFaceSpec struct {
+	font *opentype.Font
+	size float64
+}
+
+var (
+	cardFontsOnce sync.Once
+	cardFonts     map[string]cardFaceSpec
+	cardFontsErr  error
+)
+
+// cardFace returns one of the faces cards are drawn with: "title", "stat",
+// "label" or "small"; or "badge", which badges measure their text with.
+// Faces keep state while drawing, so each call returns a new one and
+// renders running at once never share a face.
+func cardFace(name string) (font.Face, error) {
+	cardFontsOnce.Do(func() {
+		regular, err := opentype.Parse(goregular.TTF)
+		if err != nil {
+			cardFontsErr = err
+			return
+		}
+		bold, err := opentype.Parse(gobold.TTF)
+		if err != nil {
+			cardFontsErr = err
+			return
+		}
+		cardFonts = map[string]cardFaceSpec{
+			"title": {bold, 44},
+			"stat":  {bold, 64},
+			"label": {regular, 24},
+			"small": {regular, 20},
+			"badge": {regular, 11},
+		}
+	})
+	if cardFontsErr != nil {
+		return nil, cardFontsErr
+	}
+	spec := cardFonts[name]
+	return opentype.NewFace(spec.font, &opentype.FaceOptions{Size: spec.size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// generateCard draws a 1200×630 social card: the title, a compact grid of
+// the year and the headline statistics below it, on the theme's background
+// with a stripe of its strongest color.
+func generateCard(tweets []DailyTweet, opts renderOptions) (*image.RGBA, error) {
+	t := opts.Theme
+	img := image.NewRGBA(image.Rect(0, 0, cardWidth, cardHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{t.Background}, image.Point{}, draw.Src)
+	accent := t.Colors[len(t.Colors)-1]
+	drawRect(img, 0, 0, cardWidth, 10, accent)
+
+	if err := cardText(img, "title", cardMargin, 100, opts.Title, t.Text); err != nil {
+		return nil, err
+	}
+
+	hm := newHeatmap(tweets, opts)
+	gridX := (cardWidth - (cardCell*numWeeks + cardGap*(numWeeks-1))) / 2
+	cells := gridCells(hm, gridX, 170, cardCell, cardGap)
+	drawCells(img, cells)
+	for _, c := range cells {
+		if hm.unusual[civil(c.date)] {
+			drawOutline(img, c.rect, outlineWidth(cardCell), t.Text)
+		}
+	}
+
+	// Statistics cover the days the grid shows.
+	end := addDate(hm.start, 0, 0, numWeeks*daysInWeek)
+	shown := hm.shown()
+	if len(shown) == 0 {
+		shown = []DailyTweet{{Date: hm.start}}
+	}
+	sum := summarize(shown)
+
+	// Cards set their text in the Go fonts, whatever those of the theme.
+	goText := opts
+	goText.Theme.Font = "go"
+	labels := goText.Theme
+	stats := []struct{ value, label string }{
+		{formatCount(sum.total), labels.label("total")},
+		{formatCount(sum.best.Count), labels.labelf("best day, %s", sum.best.Date.Format(labels.label("Jan 2")))},
+		{strconv.Itoa(sum.longestStreak), labels.label("day longest streak")},
+	}
+	muted := mix(t.Text, t.Background, 0.35)
+	columnWidth := (cardWidth - 2*cardMargin) / len(stats)
+	for i, s := range stats {
+		x := cardMargin + i*columnWidth
+		if err := cardText(img, "stat", x, 440, s.value, accentOrText(t)); err != nil {
+			return nil, err
+		}
+		if err := cardText(img, "label", x, 480, s.label, muted); err != nil {
+			return nil, err
+		}
+	}
+
+	day := labels.label("Jan 2, 2006")
+	footer := fmt.Sprintf("%s – %s", hm.start.Format(day), addDate(end, 0, 0, -1).Format(day))
+	if heading := legendHeading(hm, goText); heading != "" {
+		// Cards have no legend to say what the colors stand for.
+		footer += labels.labelf(" · colored by %s", heading)
+	}
+	if len(hm.unusual) > 0 {
+		footer += labels.label(" · outlined days are unusual")
+	}
+	if err := cardText(img, "small", cardMargin, cardHeight-40, footer, muted); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func cardText(img *image.RGBA, face string, x, y int, s string, c color.Color) error {
+	f, err := cardFace(face)
+	if err != nil {
+		return err
+	}
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(c), Face: f, Dot: fixed.P(x, y)}
+	d.DrawString(s)
+	return nil
+}
+
+// accentOrText picks the color of the headline numbers: the strongest
+// color of the theme, unless it is too close to the background to read.
+func accentOrText(t theme) color.RGBA {
+	accent := t.Colors[len(t.Colors)-1]
+	if colorDistance(accent, t.Background) < 120 {
+		return t.Text
+	}
+	return accent
+}
+
+func colorDistance(a, b color.RGBA) int {
+	abs := func(x int) int {
+		if x < 0 {
+			return -x
+		}
+		return x
+	}
+	return abs(int(a.R)-int(b.R)) + abs(int(a.G)-int(b.G)) + abs(int(a.B)-int(b.B))
+}
+
+// mix blends a toward b by the fraction f.
+func mix(a, b color.RGBA, f float64) color.RGBA {
+	blend := func(x, y uint8) uint8 { return uint8(float64(x)*(1-f) + float64(y)*f) }
+	return color.RGBA{R: blend(a.R, b.R), G: blend(a.G, b.G), B: blend(a.B, b.B), A: 255}
+}
+
+// formatCount writes n with thousands separators, as in 3,482.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
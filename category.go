@@ -0,0 +1,187 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+// uncategorized is the category of rows that leave theirs empty.
+const uncategorized = "uncategorized"
+
+// otherCategories gathers the smallest categories when there are more than
+// categoryColors has colors for.
+const otherCategories = "other"
+
+// categoryColors are the colors of categories, largest first: the Dark2
+// scheme of ColorBrewer, whose colors stay apart on light and dark
+// backgrounds.
+var categoryColors = []color.RGBA{
+	{27, 158, 119, 255},
+	{217, 95, 2, 255},
+	{117, 112, 179, 255},
+	{231, 41, 138, 255},
+	{102, 166, 30, 255},
+	{230, 171, 2, 255},
+	{166, 118, 29, 255},
+	{102, 102, 102, 255},
+}
+
+// categoryStyles are how -categories draws days broken down by category:
+// not at all, each cell split into a band per category as tall as its
+// share, or each cell in the color of its largest category. Either way the
+// color fades with the day's total as the scale has it.
+var categoryStyles = []string{"none", "split", "dominant"}
+
+// parseCategoryStyle validates -categories, returning "" for none.
+func parseCategoryStyle(style string) (string, error) {
+	switch style {
+	case "none":
+		return "", nil
+	case "split", "dominant":
+		return style, nil
+	}
+	return "", usageError(trf("unknown category style %q (available: %s)", style, strings.Join(categoryStyles, ", ")))
+}
+
+// categoryNames returns the categories of tweets from the largest total to
+// the smallest, with ties in name order. Beyond the number of colors the
+// smallest make up one more, otherCategories.
+func categoryNames(tweets []DailyTweet) []string {
+	totals := make(map[string]int)
+	for _, tweet := range tweets {
+		for name, count := range tweet.Categories {
+			totals[name] += count
+		}
+	}
+	names := largestFirst(totals)
+	if len(names) > len(categoryColors) {
+		names = append(names[:len(categoryColors)-1], otherCategories)
+	}
+	return names
+}
+
+// categoryParts returns the counts of a day's categories in the order of
+// names, the smallest folded into the last when names ends in
+// otherCategories.
+func categoryParts(categories map[string]int, names []string) []int {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	parts := make([]int, len(names))
+	for name, count := range categories {
+		i, ok := index[name]
+		if !ok {
+			i = len(names) - 1
+		}
+		parts[i] += count
+	}
+	return parts
+}
+
+// colorCategories recolors the cells of the days hm has categories for in
+// the style of opts.Categories. The strength of a day's color in the theme
+// sets how far toward the background its category colors fade.
+func (l *layout) colorCategories(hm heatmap, cells []layoutCell, opts renderOptions) {
+	if len(hm.categoryNames) == 0 {
+		return
+	}
+	t := opts.Theme
+	for i, c := range cells {
+		categories := hm.categories[civil(c.date)]
+		if len(categories) == 0 || c.count == 0 {
+			continue
+		}
+		if _, ok := hm.projected[civil(c.date)]; ok {
+			continue
+		}
+		fade := 1 - themeStrength(t, hm.scale.colorFor(hm.shades[civil(c.date)]))
+		parts := categoryParts(categories, hm.categoryNames)
+		if opts.Categories == "dominant" {
+			largest := 0
+			for j, n := range parts {
+				if n > parts[largest] {
+					largest = j
+				}
+			}
+			cells[i].color = mix(categoryColors[largest], t.Background, fade)
+			continue
+		}
+		// Bands run top to bottom, each edge rounded from the running
+		// total so the bands always fill the cell.
+		height := c.rect.Dy()
+		sum, top := 0, c.rect.Min.Y
+		for j, n := range parts {
+			sum += n
+			bottom := c.rect.Min.Y + int(math.Round(float64(sum)/float64(c.count)*float64(height)))
+			if bottom > top {
+				l.parts = append(l.parts, layoutSwatch{
+					rect:  image.Rect(c.rect.Min.X, top, c.rect.Max.X, bottom),
+					color: mix(categoryColors[j], t.Background, fade),
+				})
+			}
+			top = bottom
+		}
+	}
+}
+
+// themeStrength returns where c stands among the colors of t, from a
+// quarter for the lightest, so the quietest days stay visible, to 1 for the
+// strongest; colors not of the theme, as of -goal, count as the strongest.
+func themeStrength(t theme, c color.RGBA) float64 {
+	for i, tc := range t.Colors {
+		if tc == c {
+			return 0.25 + 0.75*float64(i)/float64(len(t.Colors)-1)
+		}
+	}
+	return 1
+}
+
+// categoryMaps returns the categories of the days of tweets that have any.
+func categoryMaps(tweets []DailyTweet) map[civilDate]map[string]int {
+	days := make(map[civilDate]map[string]int)
+	for _, tweet := range tweets {
+		if len(tweet.Categories) > 0 {
+			days[civil(tweet.Date)] = tweet.Categories
+		}
+	}
+	return days
+}
+
+// splitCategories returns each category of tweets as a series of its own,
+// from the largest total to the smallest.
+func splitCategories(tweets []DailyTweet) ([]string, [][]DailyTweet) {
+	totals := make(map[string]int)
+	series := make(map[string][]DailyTweet)
+	for _, tweet := range tweets {
+		for name, count := range tweet.Categories {
+			totals[name] += count
+			series[name] = append(series[name], DailyTweet{Date: tweet.Date, Count: count})
+		}
+	}
+	names := largestFirst(totals)
+	datasets := make([][]DailyTweet, len(names))
+	for i, name := range names {
+		datasets[i] = series[name]
+	}
+	return names, datasets
+}
+
+// largestFirst returns the names of totals from the largest total to the
+// smallest, with ties in name order.
+func largestFirst(totals map[string]int) []string {
+	names := make([]string, 0, len(totals))
+	for name := range totals {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if totals[names[i]] != totals[names[j]] {
+			return totals[names[i]] > totals[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"unicode/utf8"
+)
+
+// Limits on the text of a message.
+const (
+	discordMaxContent  = 2000
+	telegramMaxCaption = 1024
+)
+
+// postDiscord posts the image with the caption to a Discord webhook.
+func postDiscord(webhookURL string, n notification) error {
+	payload, err := json.Marshal(map[string]string{"content": truncate(n.text(), discordMaxContent)})
+	if err != nil {
+		return err
+	}
+	return postMultipart(webhookURL, "discord.com webhook", [][2]string{{"payload_json", string(payload)}}, "files[0]", n)
+}
+
+// sendTelegram sends the image with the caption to a chat through the bot
+// whose token is in TELEGRAM_BOT_TOKEN. Telegram shows PNG images as photos;
+// SVG images go as documents.
+func sendTelegram(chat string, n notification) error {
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		return errors.New(tr("TELEGRAM_BOT_TOKEN must be set"))
+	}
+	method, field := "sendPhoto", "photo"
+	if n.contentType != "image/png" {
+		method, field = "sendDocument", "document"
+	}
+	fields := [][2]string{{"chat_id", chat}, {"caption", truncate(n.text(), telegramMaxCaption)}}
+	return postMultipart("https://api.telegram.org/bot"+token+"/"+method, "api.telegram.org "+method, fields, field, n)
+}
+
+// truncate shortens s to at most max characters, marking the cut.
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,93 @@
+package main
+
+import "time"
+
+// Days are counted as civil dates: a year, month and day with no time of
+// day or zone, so no offset, daylight saving change or zone of a timestamp
+// can make two days one or skip one. A civilDate is the number of days since
+// 1970-01-01 in the proleptic Gregorian calendar, so stepping through days
+// is adding integers; the conversions follow Howard Hinnant's
+// days_from_civil and civil_from_days. Dates leave as time.Time at midnight
+// UTC, which is what day gives every date read.
+type civilDate int32
+
+// civil returns the civil date of t, the day it falls on in its own zone.
+func civil(t time.Time) civilDate {
+	y, m, d := t.Date()
+	return civilFromDate(y, m, d)
+}
+
+// civilFromDate returns the civil date of year, month and day. Days past
+// the end of the month, or before its first, run on into the next or back
+// into the previous, as with time.Date.
+func civilFromDate(year int, month time.Month, day int) civilDate {
+	// Months past December or before January carry into the year.
+	months := year*12 + int(month) - 1
+	year, m := floorDiv(months, 12), months-floorDiv(months, 12)*12+1
+	// Count years from March, so the leap day ends the year.
+	if m <= 2 {
+		year--
+	}
+	era := floorDiv(year, 400)
+	yoe := year - era*400
+	mp := (m + 9) % 12
+	doy := (153*mp+2)/5 + day - 1
+	doe := yoe*365 + yoe/4 - yoe/100 + doy
+	return civilDate(era*146097 + doe - 719468)
+}
+
+// date returns the year, month and day of d.
+func (d civilDate) date() (int, time.Month, int) {
+	z := int(d) + 719468
+	era := floorDiv(z, 146097)
+	doe := z - era*146097
+	yoe := (doe - doe/1460 + doe/36524 - doe/146096) / 365
+	doy := doe - (365*yoe + yoe/4 - yoe/100)
+	mp := (5*doy + 2) / 153
+	day := doy - (153*mp+2)/5 + 1
+	month := mp + 3
+	if month > 12 {
+		month -= 12
+	}
+	year := yoe + era*400
+	if month <= 2 {
+		year++
+	}
+	return year, time.Month(month), day
+}
+
+// time returns d as midnight UTC.
+func (d civilDate) time() time.Time {
+	y, m, day := d.date()
+	return time.Date(y, m, day, 0, 0, 0, 0, time.UTC)
+}
+
+// weekday returns the day of the week of d; 1970-01-01 was a Thursday.
+func (d civilDate) weekday() time.Weekday {
+	return time.Weekday((int(d)%7 + 7 + int(time.Thursday)) % 7)
+}
+
+// addDate returns the day the given years, months and days after the day
+// of t, as midnight UTC. Like time.AddDate it adds the years and months
+// first and lets a day past the end of the month run on, so a year after
+// Feb 29 is Mar 1.
+func addDate(t time.Time, years, months, days int) time.Time {
+	y, m, d := t.Date()
+	return (civilFromDate(y+years, m+time.Month(months), d) + civilDate(days)).time()
+}
+
+// daysBetween returns how many days from comes before to, negative when
+// it comes after.
+func daysBetween(from, to time.Time) int {
+	return int(civil(to) - civil(from))
+}
+
+// floorDiv divides rounding down, as the calendar needs for dates before
+// the epoch.
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
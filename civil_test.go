@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCivilDates(t *testing.T) {
+	tests := []struct {
+		year    int
+		month   time.Month
+		day     int
+		want    civilDate
+		weekday time.Weekday
+	}{
+		{1970, time.January, 1, 0, time.Thursday},
+		{1969, time.December, 31, -1, time.Wednesday},
+		{1968, time.February, 29, -672, time.Thursday},
+		// 1900 is not a leap year, as a century; 2000 is, as a fourth one.
+		{1900, time.February, 28, -25509, time.Wednesday},
+		{1900, time.March, 1, -25508, time.Thursday},
+		{2000, time.February, 29, 11016, time.Tuesday},
+		{2000, time.March, 1, 11017, time.Wednesday},
+		{1600, time.February, 29, -135081, time.Tuesday},
+		{2024, time.February, 29, 19782, time.Thursday},
+		{2100, time.March, 1, 47541, time.Monday},
+		{1, time.January, 1, -719162, time.Monday},
+		{9999, time.December, 31, 2932896, time.Friday},
+	}
+	for _, tt := range tests {
+		name := time.Date(tt.year, tt.month, tt.day, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+		t.Run(name, func(t *testing.T) {
+			d := civilFromDate(tt.year, tt.month, tt.day)
+			if d != tt.want {
+				t.Errorf("civil date %d, want %d", d, tt.want)
+			}
+			if y, m, day := d.date(); y != tt.year || m != tt.month || day != tt.day {
+				t.Errorf("back to %d-%02d-%02d", y, m, day)
+			}
+			if got := d.weekday(); got != tt.weekday {
+				t.Errorf("weekday %s, want %s", got, tt.weekday)
+			}
+			// A zone far from UTC keeps the day of its own clock.
+			zone := time.FixedZone("UTC+14", 14*60*60)
+			if got := civil(time.Date(tt.year, tt.month, tt.day, 23, 59, 0, 0, zone)); got != tt.want {
+				t.Errorf("civil date of the last minute in UTC+14 %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCivilOverflow checks that days and months outside their ranges run
+// on into the next or back into the previous, as with time.Date.
+func TestCivilOverflow(t *testing.T) {
+	tests := []struct {
+		year  int
+		month time.Month
+		day   int
+		want  string
+	}{
+		{1900, time.February, 29, "1900-03-01"},
+		{2024, time.February, 30, "2024-03-01"},
+		{1970, time.January, 0, "1969-12-31"},
+		{2000, time.March, 0, "2000-02-29"},
+		{1999, time.Month(13), 1, "2000-01-01"},
+		{1960, time.Month(0), 15, "1959-12-15"},
+		{1960, time.Month(-13), 1, "1958-11-01"},
+	}
+	for _, tt := range tests {
+		if got := civilFromDate(tt.year, tt.month, tt.day).time().Format("2006-01-02"); got != tt.want {
+			t.Errorf("civilFromDate(%d, %d, %d) is %s, want %s", tt.year, tt.month, tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestAddDate(t *testing.T) {
+	leapDay := time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		from                time.Time
+		years, months, days int
+		want                string
+	}{
+		{leapDay, 1, 0, 0, "2025-03-01"},
+		{leapDay, 4, 0, 0, "2028-02-29"},
+		{leapDay, -100, 0, 0, "1924-02-29"},
+		{leapDay, 0, -1, 0, "2024-01-29"},
+		{leapDay, 0, 0, 1, "2024-03-01"},
+		{time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC), 0, 0, -366, "1968-12-31"},
+		{time.Date(1969, time.March, 31, 0, 0, 0, 0, time.UTC), 0, -1, 0, "1969-03-03"},
+	}
+	for _, tt := range tests {
+		if got := addDate(tt.from, tt.years, tt.months, tt.days).Format("2006-01-02"); got != tt.want {
+			t.Errorf("addDate(%s, %d, %d, %d) is %s, want %s", tt.from.Format("2006-01-02"), tt.years, tt.months, tt.days, got, tt.want)
+		}
+	}
+}
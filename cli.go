@@ -0,0 +1,89 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	args, err := leadingLocale(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "heatmap: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		return
+	}
+	if name == "version" || name == "-version" || name == "--version" {
+		printVersion()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(args[1:])
+		profiling.stop()
+		if err == flag.ErrHelp {
+			return
+		}
+		if err == errBadFlags {
+			os.Exit(exitUsage)
+		}
+		if err != nil {
+			os.Exit(reportError(name, err))
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, tr("heatmap: unknown command %q\n"), name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+// leadingLocale sets the language of messages from a -locale before the
+// command, which applies to the usage too, and returns the arguments after
+// it.
+func leadingLocale(args []string) ([]string, error) {
+	name, value, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+	if !strings.HasPrefix(args[0], "-") || name != "locale" {
+		return args, nil
+	}
+	args = args[1:]
+	if !hasValue {
+		if len(args) == 0 {
+			return nil, usageError(tr("-locale needs a language"))
+		}
+		value, args = args[0], args[1:]
+	}
+	return args, localeFlag{}.Set(value)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, tr("Usage: heatmap [-locale LANG] <command> [flags] [input]"))
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, tr("Commands:"))
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, tr(cmd.summary))
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, tr("Run 'heatmap <command> -h' for the flags of a command,"))
+	fmt.Fprintln(os.Stderr, tr("or 'heatmap --version' for build information."))
+}
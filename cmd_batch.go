@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchFlags are the flags batch adds to those of generate.
+type batchFlags struct {
+	jobs     int
+	outDir   string
+	manifest string
+}
+
+func addBatchFlags(fs *flag.FlagSet) *batchFlags {
+	b := &batchFlags{}
+	fs.IntVar(&b.jobs, "jobs", runtime.NumCPU(), "number of heatmaps to generate at once")
+	fs.StringVar(&b.outDir, "out-dir", ".", "directory of the images of inputs without an output")
+	fs.StringVar(&b.manifest, "manifest", "", "TOML file of [[heatmap]] tables, each an input and its generate flags")
+	return b
+}
+
+// batchTask is one heatmap of a batch.
+type batchTask struct {
+	input    string
+	fs       *flag.FlagSet
+	generate *generateFlags
+}
+
+// batchResult is the outcome of a task.
+type batchResult struct {
+	err      error
+	upToDate bool
+	elapsed  time.Duration
+}
+
+func runBatch(args []string) error {
+	fs := newFlagSet("batch", "[pattern...]")
+	addGenerateFlags(fs)
+	b := addBatchFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if b.jobs < 1 {
+		return usageError(tr("-jobs must be at least 1"))
+	}
+	if fs.NArg() == 0 && b.manifest == "" {
+		return usageError(tr("give input patterns or -manifest"))
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "output" || f.Name == "o" || f.Name == "input" {
+			err = usageError(trf("-%s is set per input in batch; use -out-dir or a manifest", f.Name))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Each task parses the command line again into flags of its own, so
+	// workers share nothing.
+	flagArgs := args[:len(args)-fs.NArg()]
+	tasks, err := b.tasks(flagArgs, fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return inputError(errors.New(tr("no inputs match")))
+	}
+
+	start := time.Now()
+	results := make([]batchResult, len(tasks))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for w := 0; w < b.jobs && w < len(tasks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				t := tasks[i]
+				taskStart := time.Now()
+				upToDate, err := t.generate.execute(context.Background(), t.fs)
+				results[i] = batchResult{err: err, upToDate: upToDate, elapsed: time.Since(taskStart)}
+
+				mu.Lock()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "FAIL  %s: %v\n", t.input, err)
+				} else if upToDate {
+					printf("same  %s -> %s (up to date)\n", t.input, t.generate.output)
+				} else {
+					printf("ok    %s -> %s (%s)\n", t.input, t.generate.output, results[i].elapsed.Round(time.Millisecond))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range tasks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	failed, upToDate := 0, 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		} else if r.upToDate {
+			upToDate++
+		}
+	}
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if upToDate > 0 {
+		printf("%d of %d heatmaps generated, %d up to date, in %s\n", len(tasks)-failed-upToDate, len(tasks), upToDate, elapsed)
+	} else {
+		printf("%d of %d heatmaps generated in %s\n", len(tasks)-failed, len(tasks), elapsed)
+	}
+	if failed > 0 {
+		return errorf("%d of %d heatmaps failed", failed, len(tasks))
+	}
+	return nil
+}
+
+// tasks expands the patterns and the manifest into tasks. Inputs from
+// patterns are written to -out-dir under their own base name; manifest
+// tables may name an output and override any flag of the command line.
+func (b *batchFlags) tasks(flagArgs, patterns []string) ([]*batchTask, error) {
+	var tasks []*batchTask
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, usageError(trf("invalid pattern %q", pattern))
+		}
+		if len(matches) == 0 {
+			// A pattern without wildcards names a file, which should exist.
+			if _, err := os.Stat(pattern); err != nil {
+				return nil, inputError(err)
+			}
+			matches = []string{pattern}
+		}
+		sort.Strings(matches)
+		for _, input := range matches {
+			t, err := newBatchTask(flagArgs, map[string]interface{}{"input": input})
+			if err != nil {
+				return nil, errorf("%s: %w", input, err)
+			}
+			tasks = append(tasks, t)
+		}
+	}
+
+	if b.manifest != "" {
+		manifest, err := loadConfig(b.manifest)
+		if err != nil {
+			return nil, err
+		}
+		tables, ok := manifest["heatmap"].([]map[string]interface{})
+		if !ok {
+			return nil, errorf("%s: want an array of [[heatmap]] tables", b.manifest)
+		}
+		for i, table := range tables {
+			if _, ok := table["input"]; !ok {
+				return nil, errorf("%s: heatmap %d: input is required", b.manifest, i+1)
+			}
+			t, err := newBatchTask(flagArgs, table)
+			if err != nil {
+				return nil, errorf("%s: heatmap %d: %w", b.manifest, i+1, err)
+			}
+			tasks = append(tasks, t)
+		}
+	}
+
+	outputs := make(map[string]string)
+	for _, t := range tasks {
+		if t.generate.output == "" {
+			name := strings.TrimSuffix(filepath.Base(t.input), filepath.Ext(t.input))
+			format := t.generate.format
+			if format == "" {
+				format = "png"
+			}
+			t.generate.output = filepath.Join(b.outDir, name+"."+format)
+		}
+		if other, ok := outputs[t.generate.output]; ok {
+			return nil, usageError(trf("%s and %s would both be written to %s", other, t.input, t.generate.output))
+		}
+		outputs[t.generate.output] = t.input
+	}
+	if err := os.MkdirAll(b.outDir, 0o755); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// newBatchTask parses the flags of the command line, then sets those of a
+// manifest table, and fills the rest from the environment and the config
+// file as for generate.
+func newBatchTask(flagArgs []string, table map[string]interface{}) (*batchTask, error) {
+	t := &batchTask{fs: newFlagSet("batch", "")}
+	t.generate = addGenerateFlags(t.fs)
+	addBatchFlags(t.fs)
+	if err := t.fs.Parse(flagArgs); err != nil {
+		return nil, err
+	}
+	// Without an output in the table, the output comes from the input's
+	// name; setting it empty keeps the environment and config file off it.
+	if _, ok := table["output"]; !ok {
+		if err := t.fs.Set("output", ""); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range table {
+		if key == "config" || key == "o" || t.fs.Lookup(key) == nil || isBatchFlag(key) {
+			return nil, errorf("unknown setting %q", key)
+		}
+		if err := setFlag(t.fs, key, value); err != nil {
+			return nil, errorf("%s: %w", key, err)
+		}
+	}
+	if err := applyEnv(t.fs); err != nil {
+		return nil, err
+	}
+	if err := applyConfig(t.fs, "generate"); err != nil {
+		return nil, err
+	}
+	t.input = t.generate.source.input
+	return t, nil
+}
+
+func isBatchFlag(name string) bool {
+	return name == "jobs" || name == "out-dir" || name == "manifest"
+}
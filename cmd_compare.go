@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func runCompare(args []string) error {
+	fs := newFlagSet("compare", "input [input]")
+	source := addSourceFlags(fs)
+	render := addRenderFlags(fs)
+	output := fs.String("output", "compare.png", "output image file")
+	fs.StringVar(output, "o", *output, "shorthand for -output")
+	format := fs.String("format", "", "output format: png or svg (default from the output file extension)")
+	labels := fs.String("labels", "", "comma-separated labels of the two grids (default the input names, or the dates they show)")
+	fromB := fs.String("from-b", "", "first day of the second grid as YYYY-MM-DD, to compare years of one input (default the days of the first)")
+	diff := fs.Bool("diff", false, "draw one grid of the second input minus the first, day by day, and print totals of both")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	inputs := fs.Args()
+	switch {
+	case len(inputs) == 1 && *fromB != "":
+		inputs = append(inputs, inputs[0])
+	case len(inputs) != 2:
+		return usageError(tr("compare needs two inputs, or one input and -from-b"))
+	}
+	if *format == "" {
+		*format = formatForFile(*output)
+	}
+
+	ctx := context.Background()
+	var (
+		datasets     [][]DailyTweet
+		defaultTitle string
+	)
+	for _, input := range inputs {
+		tweets, title, err := source.loadInput(ctx, input)
+		if err != nil {
+			return err
+		}
+		if len(tweets) == 0 {
+			return inputError(errorf("%s: no data to render", input))
+		}
+		datasets = append(datasets, tweets)
+		defaultTitle = title
+	}
+	opts, err := render.options(defaultTitle)
+	if err != nil {
+		return err
+	}
+	if opts.Card {
+		return usageError(tr("compare draws no social cards"))
+	}
+	if opts.Layout != "" {
+		return usageError(tr("compare draws years of weeks; -layout does not apply"))
+	}
+	if *diff && opts.Forecast {
+		return usageError(tr("-diff draws no forecast"))
+	}
+	if *diff && opts.Normalize != "" {
+		return usageError(tr("-diff draws the counts themselves and cannot be combined with -normalize"))
+	}
+
+	// The second grid shows the days of the first unless told otherwise,
+	// so the same week lines up in both.
+	scale := sharedScale(datasets, opts)
+	first := newScaledHeatmap(datasets[0], opts, scale)
+	optsB := opts
+	optsB.From, optsB.To = first.start, time.Time{}
+	if *fromB != "" {
+		if optsB.From, err = time.Parse("2006-01-02", *fromB); err != nil {
+			return usageError(trf("invalid -from-b date %q", *fromB))
+		}
+	}
+	hms := []heatmap{first, newScaledHeatmap(datasets[1], optsB, scale)}
+	if *diff {
+		return writeDiff(hms, inputs, *labels, *output, *format, opts)
+	}
+
+	names, err := compareLabels(hms, inputs, *labels)
+	if err != nil {
+		return err
+	}
+	for i, hm := range hms {
+		names[i] = opts.Theme.labelf("%s: %s in total", names[i], formatCount(gridTotal(hm)))
+	}
+
+	data, err := renderLayout(*format, stackedLayout(hms, names, 1, opts), opts)
+	if err != nil {
+		return renderError(err)
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return renderError(err)
+	}
+	printf("Comparison generated successfully: %s\n", *output)
+	return nil
+}
+
+// compareLabels returns the labels of the two grids: those of -labels, or
+// the input names, or the dates the grids show when both come from one
+// input.
+func compareLabels(hms []heatmap, inputs []string, labels string) ([]string, error) {
+	names := strings.Split(labels, ",")
+	switch {
+	case labels == "" && inputs[0] == inputs[1]:
+		return []string{gridDates(hms[0]), gridDates(hms[1])}, nil
+	case labels == "":
+		return []string{filepath.Base(inputs[0]), filepath.Base(inputs[1])}, nil
+	case len(names) != 2:
+		return nil, usageError(tr("-labels needs two comma-separated labels"))
+	}
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	return names, nil
+}
+
+// gridTotal returns the total of the days the grid of hm shows.
+func gridTotal(hm heatmap) int {
+	total := 0
+	for _, day := range hm.shown() {
+		total += day.Count
+	}
+	return total
+}
+
+// writeDiff draws the days of the second grid minus those of the first,
+// position by position, on the dates of the first, with Feb 29 placed as
+// -leap-day says, and prints a summary of how the two differ. Days without
+// data in either grid are left out.
+func writeDiff(hms []heatmap, inputs []string, labels, output, format string, opts renderOptions) error {
+	names, err := compareLabels(hms, inputs, labels)
+	if err != nil {
+		return err
+	}
+	var (
+		days       []DailyTweet
+		more, less int
+		rise, fall DailyTweet
+	)
+	// The days pair in order; under -leap-day skip and merge Feb 29 takes
+	// no part, so a date pairs with the same date of another year.
+	next := hms[1].start
+	for i := 0; i < numWeeks*daysInWeek; i++ {
+		dateA := addDate(hms[0].start, 0, 0, i)
+		if !placed(dateA, opts.LeapDay) {
+			continue
+		}
+		for !placed(next, opts.LeapDay) {
+			next = addDate(next, 0, 0, 1)
+		}
+		dateB := next
+		next = addDate(next, 0, 0, 1)
+		a, okA := hms[0].counts[civil(dateA)]
+		b, okB := hms[1].counts[civil(dateB)]
+		if !okA && !okB {
+			continue
+		}
+		day := DailyTweet{Date: dateA, Count: b - a}
+		days = append(days, day)
+		switch {
+		case day.Count > 0:
+			more++
+		case day.Count < 0:
+			less++
+		}
+		if day.Count > rise.Count {
+			rise = day
+		}
+		if day.Count < fall.Count {
+			fall = day
+		}
+	}
+	if len(days) == 0 {
+		return inputError(errorf("neither grid has data to compare"))
+	}
+
+	var differences []int
+	for _, day := range shaded(days, opts) {
+		differences = append(differences, day.Count)
+	}
+	scale := newDivergingScale(differences, opts.Theme.Colors[0])
+	// Streaks, panels and weekday means of differences would mislead.
+	opts.Streaks, opts.Panel, opts.Profile, opts.Sparkline, opts.MonthTotals, opts.WeekNumbers = false, "", false, "", "", 0
+	opts.Title = opts.Theme.labelf("%s: %s minus %s", opts.Title, names[1], names[0])
+	hm := newScaledHeatmap(days, opts, scale)
+	hm.start = hms[0].start
+
+	totalA, totalB := gridTotal(hms[0]), gridTotal(hms[1])
+	change := formatCount(totalB - totalA)
+	if totalB > totalA {
+		change = "+" + change
+	}
+	if totalA > 0 {
+		change += fmt.Sprintf(" (%+.1f%%)", 100*float64(totalB-totalA)/float64(totalA))
+	}
+	l := yearLayout(hm, opts)
+	l.labels = append(l.labels, layoutText{10, l.height + stripHeight - 8,
+		opts.Theme.labelf("%s: %s   %s: %s   Difference: %s", names[0], formatCount(totalA), names[1], formatCount(totalB), change)})
+	l.height += stripHeight
+
+	data, err := renderLayout(format, l, opts)
+	if err != nil {
+		return renderError(err)
+	}
+	if err := os.WriteFile(output, data, 0o644); err != nil {
+		return renderError(err)
+	}
+	printf("Comparison generated successfully: %s\n", output)
+	printf("%s: %s\n", names[0], formatCount(totalA))
+	printf("%s: %s\n", names[1], formatCount(totalB))
+	printf("Difference: %s\n", change)
+	printf("Days with more: %d, with less: %d, the same: %d\n", more, less, len(days)-more-less)
+	if rise.Count > 0 {
+		printf("Largest rise: %s (%+d)\n", rise.Date.Format("2006-01-02"), rise.Count)
+	}
+	if fall.Count < 0 {
+		printf("Largest fall: %s (%+d)\n", fall.Date.Format("2006-01-02"), fall.Count)
+	}
+	return nil
+}
+
+// gridDates describes the days the grid of hm shows.
+func gridDates(hm heatmap) string {
+	end := addDate(hm.start, 0, 0, numWeeks*daysInWeek-1)
+	return hm.start.Format("2006-01-02") + " to " + end.Format("2006-01-02")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// starterConfig is written by "config init". Every key is a flag name, so
+// the file documents the flags as well.
+const starterConfig = `# heatmap configuration
+#
+# Commands read heatmap.toml from the working directory, or the file given
+# with -config. Every key is the name of a command-line flag; flags given on
+# the command line take precedence over this file. Keys at the top level
+# reach every command with the flag, and those in a table named after a
+# command, as [generate] below, reach that command alone.
+
+# Where the data comes from: csv, toggl, clockify, wakatime, lastfm, anki,
+# todoist, or steam. API-based sources read their credentials from the
+# environment (TOGGL_API_TOKEN, CLOCKIFY_API_KEY, WAKATIME_API_KEY,
+# LASTFM_API_KEY, TODOIST_API_TOKEN, STEAM_API_KEY).
+source = "csv"
+
+# Input file. Leave it out to fetch from the API of sources that have one.
+%s
+# Only count entries in this project (toggl, clockify, wakatime, todoist).
+# project = ""
+
+# Only count entries with this tag or label (toggl, clockify, todoist).
+# tag = ""
+
+# Account name (lastfm user name, steam SteamID or custom URL name).
+# user = ""
+
+# Also upload the image to object storage (s3:// or gs://) after rendering.
+# publish = ["s3://my-bucket/heatmap.png"]
+
+# Title drawn above the grid. Defaults to one suited to the source.
+# title = "Tweet Activity Heatmap"
+
+# Theme; "heatmap themes" lists them and "heatmap themes -preview
+# themes.png" shows them side by side. Theme files in
+# ~/.config/heatmap/themes add to the built-in ones.
+# theme = "github"
+
+# Cell size in pixels (4-64).
+# cell = 20
+
+# Pin the year shown to start or end on a date (YYYY-MM-DD); by default it
+# ends on the last day with data.
+# from = "2024-01-01"
+# to = "2024-12-31"
+
+# Address "serve" listens on.
+# addr = "localhost:8080"
+
+# Jobs "daemon" runs on cron schedules. Keys besides name, schedule,
+# retries and retry_delay are flags of "generate"; the rest come from
+# [generate] and the top level.
+# [[job]]
+# name = "daily"
+# schedule = "0 6 * * *"
+# output = "heatmap.png"
+# retries = 3
+
+[generate]
+# Image written by "generate", which batch and daemon jobs name themselves.
+output = "heatmap.png"
+`
+
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		fmt.Fprintln(os.Stderr, "Usage: heatmap config init [flags] [path]")
+		if len(args) == 0 {
+			return errBadFlags
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "init":
+		return runConfigInit(args[1:])
+	default:
+		return usageError(trf("unknown config command %q", args[0]))
+	}
+}
+
+func runConfigInit(args []string) error {
+	fs := newFlagSet("config init", "[path]")
+	force := fs.Bool("force", false, "overwrite existing files")
+	sample := fs.String("sample", "", "also write a sample CSV to this file and point the config at it")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return usageError(tr("at most one path may be given"))
+	}
+
+	path := defaultConfigFile
+	if fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+
+	input := "input.csv"
+	if *sample != "" {
+		input = *sample
+	}
+
+	// Check every file up front so nothing is written when one exists.
+	targets := []string{path}
+	if *sample != "" {
+		targets = append(targets, *sample)
+	}
+	if !*force {
+		for _, target := range targets {
+			if _, err := os.Stat(target); err == nil {
+				return errorf("%s already exists; use -force to overwrite", target)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	// The encoder quotes the path as TOML, backslashes of Windows and all.
+	var inputLine strings.Builder
+	if err := toml.NewEncoder(&inputLine).Encode(map[string]string{"input": input}); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(starterConfig, inputLine.String())), 0o644); err != nil {
+		return err
+	}
+	printf("Wrote %s\n", path)
+
+	if *sample != "" {
+		if err := writeSampleCSV(*sample); err != nil {
+			return err
+		}
+		printf("Wrote %s\n", *sample)
+	}
+	return nil
+}
+
+// writeSampleCSV writes a year of made-up daily counts ending today.
+func writeSampleCSV(filename string) error {
+	tweets := generateSample(rand.New(rand.NewSource(1)), day(time.Now()), 365)
+	return writeCSVFile(filename, tweets)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func runConvert(args []string) error {
+	fs := newFlagSet("convert", "[input]")
+	source := addSourceFlags(fs)
+	output := fs.String("output", "-", "output CSV file, or - for standard output")
+	fs.StringVar(output, "o", *output, "shorthand for -output")
+	gaps := fs.String("gaps", "zero", trf("days between the first and last without data: %s (write them with a count of zero)", strings.Join(gapPolicies, ", ")))
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkGapPolicy(*gaps); err != nil {
+		return err
+	}
+
+	tweets, _, err := source.load(context.Background(), fs)
+	if err != nil {
+		return err
+	}
+
+	if *gaps == "zero" {
+		tweets = fillGaps(tweets)
+	}
+	return writeCSVFile(*output, tweets)
+}
+
+// fillGaps returns tweets, sorted by date with one entry per day, with a
+// zero count for each day without one between the first and the last.
+func fillGaps(tweets []DailyTweet) []DailyTweet {
+	if len(tweets) == 0 {
+		return tweets
+	}
+	filled := make([]DailyTweet, 0, len(tweets))
+	for _, tweet := range tweets {
+		if n := len(filled); n > 0 {
+			for date := addDate(filled[n-1].Date, 0, 0, 1); date.Before(tweet.Date); date = addDate(date, 0, 0, 1) {
+				filled = append(filled, DailyTweet{Date: date})
+			}
+		}
+		filled = append(filled, tweet)
+	}
+	return filled
+}
+
+// csvHeader is the header writeCSV writes.
+var csvHeader = []string{"date", "tweet_count"}
+
+// writeCSV writes tweets in the format read by the csv source.
+func writeCSV(w io.Writer, tweets []DailyTweet) error {
+	return writeCSVHeader(w, csvHeader, tweets)
+}
+
+// writeCSVHeader is writeCSV under the given header of two columns.
+func writeCSVHeader(w io.Writer, header []string, tweets []DailyTweet) error {
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	for _, tweet := range tweets {
+		writer.Write([]string{tweet.Date.Format("20060102"), strconv.Itoa(tweet.Count)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// maxLag bounds -lag and -max-lag at a year.
+const maxLag = 365
+
+func runCorrelate(args []string) error {
+	fs := newFlagSet("correlate", "input input")
+	source := addSourceFlags(fs)
+	render := addRenderFlags(fs)
+	gaps := fs.String("gaps", "skip", trf("days one input has no data for: %s (count them as zero)", strings.Join(gapPolicies, ", ")))
+	lag := fs.Int("lag", 0, "pair each day of the first input with the day this many days later of the second, e.g. 1 for sleep the night after a run")
+	maxLagFlag := fs.Int("max-lag", 0, "also list the correlation of every lag from minus to plus this many days")
+	scatter := fs.String("scatter", "", "also draw a scatter plot of the paired days to this PNG or SVG file")
+	labels := fs.String("labels", "", "comma-separated names of the two inputs (default the file names)")
+	asJSON := fs.Bool("json", false, "print the results as a JSON object")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	inputs := fs.Args()
+	if len(inputs) != 2 {
+		return usageError(tr("correlate needs two inputs"))
+	}
+	if err := checkGapPolicy(*gaps); err != nil {
+		return err
+	}
+	if *lag < -maxLag || *lag > maxLag {
+		return usageError(trf("lag must be within %d days either way, not %d", maxLag, *lag))
+	}
+	if *maxLagFlag < 0 || *maxLagFlag > maxLag {
+		return usageError(trf("max-lag must be 0 to %d days, not %d", maxLag, *maxLagFlag))
+	}
+	names := []string{filepath.Base(inputs[0]), filepath.Base(inputs[1])}
+	if *labels != "" {
+		names = strings.Split(*labels, ",")
+		if len(names) != 2 {
+			return usageError(tr("-labels needs two comma-separated labels"))
+		}
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+	}
+
+	ctx := context.Background()
+	var datasets [][]DailyTweet
+	for _, input := range inputs {
+		tweets, _, err := source.loadInput(ctx, input)
+		if err != nil {
+			return err
+		}
+		datasets = append(datasets, tweets)
+	}
+	days := pairDays(datasets[0], datasets[1], *lag, *gaps)
+	if len(days) < 2 {
+		return inputError(errors.New(trn("the inputs share %d day; correlation needs at least 2",
+			"the inputs share %d days; correlation needs at least 2", len(days), len(days))))
+	}
+	c := correlate(days)
+
+	var lags []lagCorrelation
+	for l := -*maxLagFlag; *maxLagFlag > 0 && l <= *maxLagFlag; l++ {
+		lags = append(lags, lagCorrelation{l, correlate(pairDays(datasets[0], datasets[1], l, *gaps))})
+	}
+
+	if *scatter != "" {
+		opts, err := render.options(fmt.Sprintf("%s and %s", names[0], names[1]))
+		if err != nil {
+			return err
+		}
+		data, err := renderLayout(formatForFile(*scatter), scatterLayout(days, names, c, opts), opts)
+		if err != nil {
+			return renderError(err)
+		}
+		if err := os.WriteFile(*scatter, data, 0o644); err != nil {
+			return renderError(err)
+		}
+	}
+
+	if *asJSON {
+		return writeCorrelationJSON(os.Stdout, days, c, *lag, lags)
+	}
+	fmt.Printf("days:         %d (%s to %s, gaps: %s)\n", c.n, days[0].date.Format("2006-01-02"),
+		days[len(days)-1].date.Format("2006-01-02"), *gaps)
+	if *lag != 0 {
+		fmt.Printf("lag:          %s %+d %s\n", names[1], *lag, plural(max(*lag, -*lag), "day", "days"))
+	}
+	fmt.Printf("pearson r:    %s %s\n", formatCoefficient(c.pearson), strength(c.pearson))
+	fmt.Printf("spearman rho: %s %s\n", formatCoefficient(c.spearman), strength(c.spearman))
+	if !math.IsNaN(c.slope) {
+		fmt.Printf("slope:        %.3f %s per %s\n", c.slope, names[1], names[0])
+	}
+	if len(lags) > 0 {
+		fmt.Println()
+		best := strongestLag(lags)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "lag\tdays\tpearson r\tspearman rho\t")
+		for _, l := range lags {
+			mark := ""
+			if l.lag == best {
+				mark = "strongest"
+			}
+			fmt.Fprintf(tw, "%+d\t%d\t%s\t%s\t%s\n", l.lag, l.n, formatCoefficient(l.pearson), formatCoefficient(l.spearman), mark)
+		}
+		tw.Flush()
+	}
+	if *scatter != "" {
+		fmt.Printf("\nScatter plot generated successfully: %s\n", *scatter)
+	}
+	return nil
+}
+
+// lagCorrelation is the correlation of the second series shifted by lag
+// days.
+type lagCorrelation struct {
+	lag int
+	correlation
+}
+
+// strongestLag returns the lag whose Pearson's r is furthest from zero.
+func strongestLag(lags []lagCorrelation) int {
+	best, strongest := 0, -1.0
+	for _, l := range lags {
+		if a := math.Abs(l.pearson); !math.IsNaN(a) && a > strongest {
+			best, strongest = l.lag, a
+		}
+	}
+	return best
+}
+
+// correlationJSON is what correlate -json prints. Coefficients that are
+// undefined are null.
+type correlationJSON struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Days     int      `json:"days"`
+	Lag      int      `json:"lag"`
+	Pearson  *float64 `json:"pearson"`
+	Spearman *float64 `json:"spearman"`
+	Slope    *float64 `json:"slope"`
+
+	Lags []correlationLagJSON `json:"lags,omitempty"`
+}
+
+type correlationLagJSON struct {
+	Lag      int      `json:"lag"`
+	Days     int      `json:"days"`
+	Pearson  *float64 `json:"pearson"`
+	Spearman *float64 `json:"spearman"`
+}
+
+func writeCorrelationJSON(w io.Writer, days []pairedDay, c correlation, lag int, lags []lagCorrelation) error {
+	out := correlationJSON{
+		From:     days[0].date.Format("2006-01-02"),
+		To:       days[len(days)-1].date.Format("2006-01-02"),
+		Days:     c.n,
+		Lag:      lag,
+		Pearson:  definedOrNil(c.pearson),
+		Spearman: definedOrNil(c.spearman),
+		Slope:    definedOrNil(c.slope),
+	}
+	for _, l := range lags {
+		out.Lags = append(out.Lags, correlationLagJSON{l.lag, l.n, definedOrNil(l.pearson), definedOrNil(l.spearman)})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// definedOrNil returns v, or nil when it is NaN, which JSON cannot hold.
+func definedOrNil(v float64) *float64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
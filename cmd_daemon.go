@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultRetryDelay is the wait before the first retry of a failed job;
+// each further retry waits twice as long.
+const defaultRetryDelay = time.Minute
+
+func runDaemon(args []string) error {
+	fs := newFlagSet("daemon", "")
+	fs.String("config", "", trf("config file (default %s if present)", defaultConfigFile))
+	statePath := fs.String("state", "", "file to keep the last run of each job in (default in the user cache directory)")
+	once := fs.Bool("once", false, "run every job once and exit")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError(tr("daemon takes no arguments"))
+	}
+
+	jobs, err := loadJobs(fs.Lookup("config").Value.String())
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return usageError(tr("no [[job]] tables in the config file"))
+	}
+
+	if *statePath == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return err
+		}
+		*statePath = filepath.Join(dir, "heatmap-generator", "daemon-state.json")
+	}
+	state, err := loadDaemonState(*statePath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		failed := 0
+		for _, j := range jobs {
+			if err := state.run(ctx, j); err != nil {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return errorf("%d of %d jobs failed", failed, len(jobs))
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			state.loop(ctx, j)
+		}(j)
+	}
+	slog.Info("daemon started", "jobs", len(jobs), "state", *statePath)
+	wg.Wait()
+	slog.Info("daemon stopped")
+	return nil
+}
+
+// job is a [[job]] table of the config file: a generate run on a schedule.
+//
+//	[[job]]
+//	name = "toggl"
+//	schedule = "0 6 * * *"
+//	source = "toggl"
+//	output = "/var/www/heatmap.png"
+//
+// Besides name, schedule, retries and retry_delay, the keys are the flag
+// names of generate; keys a job leaves out take the values of the top level
+// of the config file.
+type job struct {
+	name       string
+	spec       string
+	schedule   schedule
+	retries    int
+	retryDelay time.Duration
+	fs         *flag.FlagSet
+	generate   *generateFlags
+}
+
+func loadJobs(configPath string) ([]*job, error) {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, ok := config["job"]
+	if !ok {
+		return nil, nil
+	}
+	tables, ok := raw.([]map[string]interface{})
+	if !ok {
+		return nil, errorf("config: job must be an array of tables ([[job]])")
+	}
+
+	var jobs []*job
+	seen := make(map[string]bool)
+	for i, table := range tables {
+		name, _ := table["name"].(string)
+		if name == "" {
+			return nil, errorf("config: job %d: name is required", i+1)
+		}
+		if seen[name] {
+			return nil, errorf("config: job %s defined twice", name)
+		}
+		seen[name] = true
+
+		j, err := newJob(configPath, name, table)
+		if err != nil {
+			return nil, errorf("config: job %s: %w", name, err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+func newJob(configPath, name string, table map[string]interface{}) (*job, error) {
+	j := &job{name: name, retryDelay: defaultRetryDelay}
+	j.fs = flag.NewFlagSet(name, flag.ContinueOnError)
+	j.fs.SetOutput(io.Discard)
+	j.generate = addGenerateFlags(j.fs)
+
+	for key, value := range table {
+		switch key {
+		case "name":
+			continue
+		case "schedule":
+			j.spec = fmt.Sprint(value)
+			continue
+		case "retries":
+			n, ok := value.(int64)
+			if !ok || n < 0 {
+				return nil, errors.New(tr("retries must be a non-negative integer"))
+			}
+			j.retries = int(n)
+			continue
+		case "retry_delay":
+			d, err := time.ParseDuration(fmt.Sprint(value))
+			if err != nil {
+				return nil, errorf("retry_delay: %w", err)
+			}
+			j.retryDelay = d
+			continue
+		}
+		if key == "config" || j.fs.Lookup(key) == nil {
+			return nil, errorf("unknown setting %q", key)
+		}
+		if err := setFlag(j.fs, key, value); err != nil {
+			return nil, errorf("%s: %w", key, err)
+		}
+	}
+
+	if j.spec == "" {
+		return nil, errors.New(tr("schedule is required"))
+	}
+	var err error
+	if j.schedule, err = parseSchedule(j.spec); err != nil {
+		return nil, err
+	}
+	if j.schedule.next(time.Now()).IsZero() {
+		return nil, errorf("schedule %q never runs", j.spec)
+	}
+
+	// Keys the job leaves out come from the top level of the config.
+	if err := j.fs.Set("config", configPath); err != nil {
+		return nil, err
+	}
+	if err := applyConfig(j.fs, "generate"); err != nil {
+		return nil, err
+	}
+	if _, err := j.generate.render.options(""); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// jobState is what the daemon remembers of a job between runs.
+type jobState struct {
+	LastRun     time.Time `json:"last_run"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	Failures    int       `json:"consecutive_failures"`
+}
+
+// daemonState is the state of every job, kept in a JSON file so the daemon
+// can catch up on runs it missed while it was stopped.
+type daemonState struct {
+	path string
+
+	mu   sync.Mutex
+	jobs map[string]*jobState
+}
+
+func loadDaemonState(path string) (*daemonState, error) {
+	s := &daemonState{path: path, jobs: make(map[string]*jobState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.jobs); err != nil {
+		return nil, errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// lastRun returns when the job last ran, or the zero time.
+func (s *daemonState) lastRun(name string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.jobs[name]; ok {
+		return st.LastRun
+	}
+	return time.Time{}
+}
+
+// record stores the outcome of a job run and writes the state file.
+func (s *daemonState) record(name string, start time.Time, runErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.jobs[name]
+	if !ok {
+		st = &jobState{}
+		s.jobs[name] = st
+	}
+	st.LastRun = start
+	if runErr != nil {
+		st.LastError = runErr.Error()
+		st.Failures++
+	} else {
+		st.LastSuccess = start
+		st.LastError = ""
+		st.Failures = 0
+	}
+
+	if err := s.save(); err != nil {
+		slog.Error("saving daemon state failed", "file", s.path, "err", err)
+	}
+}
+
+func (s *daemonState) save() error {
+	data, err := json.MarshalIndent(s.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// loop runs a job on its schedule until ctx is done. A run the schedule
+// called for while the daemon was stopped happens right away.
+func (s *daemonState) loop(ctx context.Context, j *job) {
+	now := time.Now()
+	next := j.schedule.next(now)
+	if last := s.lastRun(j.name); !last.IsZero() {
+		if missed := j.schedule.next(last); missed.Before(now) {
+			slog.Info("catching up on missed run", "job", j.name, "due", missed)
+			next = now
+		}
+	}
+
+	for {
+		slog.Debug("job scheduled", "job", j.name, "next", next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.run(ctx, j)
+		next = j.schedule.next(time.Now())
+	}
+}
+
+// run runs a job, retrying it with a growing delay when it fails.
+func (s *daemonState) run(ctx context.Context, j *job) error {
+	start := time.Now()
+	delay := j.retryDelay
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = j.generate.run(ctx, j.fs); err == nil || attempt == j.retries {
+			break
+		}
+		slog.Warn("job failed, retrying", "job", j.name, "attempt", attempt+1, "retry_in", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			s.record(j.name, start, err)
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	if err != nil {
+		slog.Error("job failed", "job", j.name, "err", err)
+	} else {
+		slog.Info("job finished", "job", j.name, "elapsed", time.Since(start))
+	}
+	s.record(j.name, start, err)
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"time"
+)
+
+func runDemo(args []string) error {
+	fs := newFlagSet("demo", "")
+	output := fs.String("output", "-", "output CSV file, or - for standard output")
+	fs.StringVar(output, "o", *output, "shorthand for -output")
+	days := fs.Int("days", 365, "number of days to generate")
+	end := fs.String("end", "", "last day to generate as YYYY-MM-DD (default today)")
+	seed := fs.Int64("seed", 0, "random seed (default derived from the clock)")
+	render := fs.String("render", "", "also render the sample to this PNG file")
+	themeName := fs.String("theme", defaultTheme, "color theme of the rendered sample")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError(tr("demo takes no arguments"))
+	}
+	if *days < 1 {
+		return usageError(tr("-days must be positive"))
+	}
+
+	t, err := lookupTheme(*themeName)
+	if err != nil {
+		return err
+	}
+
+	last := day(time.Now())
+	if *end != "" {
+		last, err = time.Parse("2006-01-02", *end)
+		if err != nil {
+			return usageError(trf("invalid -end: %v", err))
+		}
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	tweets := generateSample(rand.New(rand.NewSource(*seed)), last, *days)
+
+	if err := writeCSVFile(*output, tweets); err != nil {
+		return err
+	}
+
+	if *render != "" {
+		if len(tweets) == 0 {
+			return inputError(errorf("the sample has no active days"))
+		}
+		img, err := generateHeatmap(tweets, renderOptions{Title: "Sample Activity Heatmap", Theme: t})
+		if err != nil {
+			return renderError(err)
+		}
+		if err := savePNG(img, *render); err != nil {
+			return renderError(err)
+		}
+		printf("Heatmap generated successfully: %s\n", *render)
+	}
+	return nil
+}
+
+// writeCSVFile writes tweets as CSV to filename, or to standard output when
+// filename is "-".
+func writeCSVFile(filename string, tweets []DailyTweet) error {
+	if filename == "-" {
+		return writeCSV(os.Stdout, tweets)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeCSV(file, tweets); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
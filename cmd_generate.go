@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// generateFlags are the flags of generate, which daemon jobs share.
+type generateFlags struct {
+	source       *sourceFlags
+	render       *renderFlags
+	output       string
+	also         []string // further outputs, each in the format of its extension
+	format       string
+	publish      stringList
+	cacheControl string
+	share        string
+	shareExpires time.Duration
+	badge        *badgeFlags
+	notify       *notifyFlags
+	git          *gitFlags
+	incremental  bool
+	cacheDir     string
+	exportJSON   string
+	imageMap     string
+	altText      string
+}
+
+func addGenerateFlags(fs *flag.FlagSet) *generateFlags {
+	g := &generateFlags{source: addSourceFlags(fs), render: addRenderFlags(fs)}
+	g.output = "heatmap.png"
+	output := &outputFlag{g: g}
+	fs.Var(output, "output", "output image file, or - for standard output, as with -format sixel; repeat it for more files of the same render, each in the format of its extension, .json for -export-json's grid and .html for -image-map's map")
+	fs.Var(output, "o", "shorthand for -output")
+	fs.StringVar(&g.format, "format", "", "output format: png, svg, txt, xlsx, or sixel or iterm for terminals that show inline images (default from the output file extension)")
+	fs.Var(&g.publish, "publish", "also upload the image to this s3://bucket/key, gs://bucket/object or SCHEME:// of a heatmap-publish-SCHEME plugin (repeatable; a destination ending in / gets the output file name)")
+	fs.StringVar(&g.cacheControl, "cache-control", defaultCacheControl, "Cache-Control of published images")
+	fs.StringVar(&g.share, "share", "", "upload the image to imgur, or to an s3:// destination with a presigned URL, and print its URL")
+	fs.DurationVar(&g.shareExpires, "share-expires", maxShareExpiry, "how long a presigned -share URL stays valid (at most 168h)")
+	g.badge = addBadgeFlags(fs)
+	g.notify = addNotifyFlags(fs)
+	g.git = addGitFlags(fs)
+	fs.BoolVar(&g.incremental, "incremental", false, "do nothing, not even publishing, when the output already holds this image of the same data")
+	fs.StringVar(&g.cacheDir, "cache-dir", defaultRenderCacheDir(), "directory where -incremental keeps what it wrote")
+	fs.StringVar(&g.imageMap, "image-map", "", "also write an HTML <img> of the output with a <map> of an area for each cell, titled with its date and count, to this file")
+	fs.StringVar(&g.altText, "alt-text", "", "also write a sentence describing the heatmap for screen readers, the <desc> of SVG images, to this file, or - for standard output")
+	fs.StringVar(&g.exportJSON, "export-json", "", "also write the computed grid to this JSON file: each cell's date, value, color bucket, color and pixel rectangle")
+	return g
+}
+
+// outputFlag sets the output of generate the first time and adds further
+// outputs after that. An empty output, as batch sets before a manifest
+// names one, counts as unset.
+type outputFlag struct {
+	g   *generateFlags
+	set bool
+}
+
+func (o *outputFlag) String() string {
+	if o.g == nil {
+		return ""
+	}
+	return strings.Join(append([]string{o.g.output}, o.g.also...), ",")
+}
+
+func (o *outputFlag) Set(v string) error {
+	if !o.set || o.g.output == "" {
+		o.g.output, o.set = v, true
+		return nil
+	}
+	o.g.also = append(o.g.also, v)
+	return nil
+}
+
+func runGenerate(args []string) error {
+	fs := newFlagSet("generate", "[input]")
+	g := addGenerateFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if columns := strings.Split(g.source.options.Column, ","); len(columns) > 1 {
+		return g.runColumns(context.Background(), fs, columns)
+	}
+	return g.run(context.Background(), fs)
+}
+
+// runColumns generates a heatmap of each of several -column value columns
+// of one CSV input, each to the output file name with the column's added
+// before the extension and titled by the column unless -title is given.
+// Destinations that would get every image under one name are refused.
+func (g *generateFlags) runColumns(ctx context.Context, fs *flag.FlagSet, columns []string) error {
+	if g.badge.path != "" || g.share != "" || g.exportJSON != "" || g.imageMap != "" || g.altText != "" {
+		return usageError(tr("-badge, -share, -export-json, -image-map and -alt-text take one image; give a single -column"))
+	}
+	for _, target := range g.publish {
+		if !strings.HasSuffix(target, "/") {
+			return usageError(trf("-publish %s would get every column's image; end it with / to publish each under its own name", target))
+		}
+	}
+	for _, column := range columns {
+		column = strings.TrimSpace(column)
+		source, render := *g.source, *g.render
+		source.options.Column = column
+		if render.title == "" {
+			render.title = column
+		}
+		c := *g
+		c.source, c.render = &source, &render
+		ext := filepath.Ext(g.output)
+		c.output = strings.TrimSuffix(g.output, ext) + "-" + column + ext
+		c.also = nil
+		for _, path := range g.also {
+			ext := filepath.Ext(path)
+			c.also = append(c.also, strings.TrimSuffix(path, ext)+"-"+column+ext)
+		}
+		if err := c.run(ctx, fs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run generates the image and reports success.
+func (g *generateFlags) run(ctx context.Context, fs *flag.FlagSet) error {
+	upToDate, err := g.execute(ctx, fs)
+	if err != nil {
+		return err
+	}
+	if upToDate {
+		printf("Heatmap up to date: %s\n", g.output)
+		return nil
+	}
+	if g.output == "-" && len(g.also) == 0 {
+		return nil // the image is the output
+	}
+	printf("Heatmap generated successfully: %s\n", strings.Join(append([]string{g.output}, g.also...), ", "))
+	return nil
+}
+
+// execute loads the data, renders it, writes the image and hands it to the
+// destinations the flags name. With -incremental it reports instead that
+// the output is up to date, when it is. Loading and rendering stop when ctx
+// ends.
+func (g *generateFlags) execute(ctx context.Context, fs *flag.FlagSet) (bool, error) {
+	err := g.generate(ctx, fs)
+	if err == errUpToDate {
+		return true, nil
+	}
+	return false, err
+}
+
+// sidecarKinds are what outputs with these extensions get in place of an
+// image: the grid -export-json writes, or the image map of -image-map.
+var sidecarKinds = map[string]string{".json": "grid", ".html": "map"}
+
+// isSidecar reports whether an output gets a sidecar rather than an image.
+func isSidecar(path string) bool {
+	_, ok := sidecarKinds[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// sidecar returns the grid of the heatmap of tweets as JSON, or an image
+// map of the image at the output, written relative to path.
+func (g *generateFlags) sidecar(kind, path string, tweets []DailyTweet, opts renderOptions) ([]byte, error) {
+	if kind == "grid" {
+		return exportGrid(tweets, opts)
+	}
+	src, err := filepath.Rel(filepath.Dir(path), g.output)
+	if err != nil {
+		src = filepath.Base(g.output)
+	}
+	return imageMap(tweets, opts, filepath.ToSlash(src))
+}
+
+// errUpToDate stops generate when -incremental finds nothing to do.
+var errUpToDate = errors.New("up to date")
+
+func (g *generateFlags) generate(ctx context.Context, fs *flag.FlagSet) error {
+	format := g.format
+	if format == "" {
+		format = formatForFile(g.output)
+	}
+	if err := g.badge.check(); err != nil {
+		return err
+	}
+	if err := g.notify.check(format); err != nil {
+		return err
+	}
+	if err := g.git.check(); err != nil {
+		return err
+	}
+	if g.output == "-" && g.incremental {
+		return usageError(tr("-incremental compares with the output file; it does not apply to -o -"))
+	}
+	if g.output == "-" && g.altText == "-" {
+		return usageError(tr("-o - writes the image to standard output; give -alt-text a file"))
+	}
+	for _, target := range g.publish {
+		if _, err := parsePublishTarget(target, g.output); err != nil {
+			return err
+		}
+	}
+	if g.share != "" {
+		if err := checkShare(g.share, g.output, format, g.shareExpires); err != nil {
+			return err
+		}
+	}
+
+	tweets, defaultTitle, err := g.source.load(ctx, fs)
+	if err != nil {
+		return err
+	}
+	opts, err := g.render.options(defaultTitle)
+	if err != nil {
+		return err
+	}
+	if opts.Card && (g.exportJSON != "" || g.imageMap != "" || slices.ContainsFunc(g.also, isSidecar)) {
+		return usageError(tr("-export-json, -image-map and .json and .html outputs describe the grid, which a -card does not have"))
+	}
+
+	cache := renderCache{dir: g.cacheDir}
+	key := imageKey(dataKey(tweets), format, opts)
+	if g.incremental && cache.upToDate(g.output, key) {
+		return errUpToDate
+	}
+
+	start := time.Now()
+	data, err := renderHeatmap(ctx, format, tweets, opts)
+	if err != nil {
+		return renderError(err)
+	}
+	slog.Debug("heatmap rendered", "format", format, "bytes", len(data), "elapsed", time.Since(start))
+
+	if g.output == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(g.output, data, 0o644)
+	}
+	if err != nil {
+		return renderError(err)
+	}
+	type extra struct{ path, kind string }
+	var extras []extra
+	for _, path := range g.also {
+		extras = append(extras, extra{path, sidecarKinds[strings.ToLower(filepath.Ext(path))]})
+	}
+	if g.exportJSON != "" {
+		extras = append(extras, extra{g.exportJSON, "grid"})
+	}
+	if g.imageMap != "" {
+		extras = append(extras, extra{g.imageMap, "map"})
+	}
+	for _, e := range extras {
+		var data []byte
+		if e.kind != "" {
+			data, err = g.sidecar(e.kind, e.path, tweets, opts)
+		} else {
+			data, err = renderHeatmap(ctx, formatForFile(e.path), tweets, opts)
+		}
+		if err != nil {
+			return renderError(err)
+		}
+		if err := os.WriteFile(e.path, data, 0o644); err != nil {
+			return renderError(err)
+		}
+	}
+	if g.altText == "-" {
+		// Like a shared URL, the description is a result, so it is
+		// printed even with -quiet.
+		fmt.Println(altText(tweets, opts))
+	} else if g.altText != "" {
+		if err := os.WriteFile(g.altText, []byte(altText(tweets, opts)+"\n"), 0o644); err != nil {
+			return renderError(err)
+		}
+	}
+	if g.badge.path != "" {
+		if err := g.badge.write(newCaptionData(opts.Title, summarize(tweets), ""), opts.Theme); err != nil {
+			return renderError(err)
+		}
+	}
+
+	up := upload{data: data, contentType: outputFormats[format], cacheControl: g.cacheControl}
+	if len(g.publish) > 0 {
+		if err := publish(g.publish, g.output, up); err != nil {
+			return err
+		}
+	}
+
+	var sharedURL string
+	if g.share != "" {
+		if sharedURL, err = share(g.share, g.output, up, g.shareExpires); err != nil {
+			return publishError(errorf("sharing: %w", err))
+		}
+		// The URL is the result scripts and bots look for, so it is
+		// printed even with -quiet.
+		fmt.Println(sharedURL)
+	}
+
+	// Daemon jobs run again with the same flags, so the shared URL must
+	// not stick to them.
+	notify := *g.notify
+	if notify.imageURL == "" {
+		notify.imageURL = sharedURL
+	}
+
+	if g.git.repo != "" {
+		caption := newCaptionData(opts.Title, summarize(tweets), notify.imageURL)
+		if err := g.git.commit(g.output, data, caption); err != nil {
+			var ue usageError
+			if errors.As(err, &ue) {
+				return err
+			}
+			return publishError(errorf("committing to %s: %w", redactURL(g.git.repo), err))
+		}
+	}
+	if err := notify.send(opts.Title, g.output, outputFormats[format], data, tweets); err != nil {
+		return err
+	}
+
+	if inGitHubActions() {
+		if err := reportGitHub(g.output, sharedURL, tweets); err != nil {
+			return err
+		}
+	}
+
+	// Only a run that did everything counts, so a failed upload is tried
+	// again next time.
+	if g.incremental {
+		if err := cache.record(g.output, key, data); err != nil {
+			slog.Warn("recording the render failed", "dir", g.cacheDir, "err", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+)
+
+func runMatrix(args []string) error {
+	fs := newFlagSet("matrix", "input")
+	render := addRenderFlags(fs)
+	var limits inputLimits
+	addLimitFlags(fs, &limits)
+	output := fs.String("output", "matrix.png", "output image file")
+	fs.StringVar(output, "o", *output, "shorthand for -output")
+	format := fs.String("format", "", "output format: png or svg (default from the output file extension)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError(tr("matrix needs one input of row, column and count"))
+	}
+	if *format == "" {
+		*format = formatForFile(*output)
+	}
+
+	opts, err := render.options("Heatmap")
+	if err != nil {
+		return err
+	}
+	switch {
+	case opts.Card || opts.Layout != "":
+		return usageError(tr("matrix draws its own grid; -card and -layout do not apply"))
+	case !opts.From.IsZero() || !opts.To.IsZero() || opts.Goal > 0 || opts.Forecast || opts.Smooth > 1 || opts.Normalize != "":
+		return usageError(tr("matrix counts cells, not days: -from, -to, -goal, -forecast, -smooth and -normalize do not apply"))
+	}
+
+	m, err := readMatrix(fs.Arg(0), limits)
+	if err != nil {
+		return classifyLoadError(err)
+	}
+	if len(m.rows) == 0 {
+		return inputError(errorf("%s: no cells to render", fs.Arg(0)))
+	}
+	l := matrixLayout(m, newColorScale(m.counts(), opts), opts)
+	l.addFooter(matrixFooter(m, opts.Theme))
+
+	data, err := renderLayout(*format, l, opts)
+	if err != nil {
+		return renderError(err)
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return renderError(err)
+	}
+	printf("Matrix generated successfully: %s\n", *output)
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Small multiples default to smaller cells and three grids a row, which
+// fits a team on a screen.
+const (
+	multiplesCell    = 6
+	multiplesColumns = 3
+)
+
+func runMultiples(args []string) error {
+	fs := newFlagSet("multiples", "input...")
+	source := addSourceFlags(fs)
+	render := addRenderFlags(fs)
+	output := fs.String("output", "multiples.png", "output image file")
+	fs.StringVar(output, "o", *output, "shorthand for -output")
+	format := fs.String("format", "", "output format: png or svg (default from the output file extension)")
+	labels := fs.String("labels", "", "comma-separated labels of the grids (default the input names, or the categories)")
+	columns := fs.Int("columns", multiplesColumns, "grids in each row")
+	byCategory := fs.Bool("by-category", false, "draw a grid for each category of one input with a category column")
+	byYear := fs.Bool("by-year", false, "draw a grid for each calendar year of one input, from January 1")
+	yearTable := fs.Bool("year-table", false, "with -by-year, add a table of the totals, means and best days of the years and their changes below the grids")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	inputs := fs.Args()
+	switch {
+	case *byCategory && *byYear:
+		return usageError(tr("-by-category and -by-year cannot be combined"))
+	case (*byCategory || *byYear) && len(inputs) != 1:
+		return usageError(tr("-by-category and -by-year need exactly one input"))
+	case *yearTable && !*byYear:
+		return usageError(tr("-year-table needs -by-year"))
+	case len(inputs) == 0:
+		return usageError(tr("multiples needs at least one input"))
+	}
+	if *columns < 1 {
+		return usageError(trf("columns must be at least 1, not %d", *columns))
+	}
+	if *format == "" {
+		*format = formatForFile(*output)
+	}
+
+	ctx := context.Background()
+	var (
+		datasets     [][]DailyTweet
+		names        []string
+		defaultTitle string
+	)
+	for _, input := range inputs {
+		tweets, title, err := source.loadInput(ctx, input)
+		if err != nil {
+			return err
+		}
+		if len(tweets) == 0 {
+			return inputError(errorf("%s: no data to render", input))
+		}
+		datasets = append(datasets, tweets)
+		names = append(names, filepath.Base(input))
+		defaultTitle = title
+	}
+	if *byCategory {
+		names, datasets = splitCategories(datasets[0])
+		if len(datasets) == 0 {
+			return inputError(errorf("%s: no category column to split by", inputs[0]))
+		}
+	}
+	var years []yearTotal
+	if *byYear {
+		years = yearTotals(datasets[0])
+		names, datasets = splitYears(datasets[0])
+	}
+	if *labels != "" {
+		given := strings.Split(*labels, ",")
+		if len(given) != len(datasets) {
+			return usageError(trf("-labels needs %d comma-separated labels, one for each grid", len(datasets)))
+		}
+		for i := range given {
+			names[i] = strings.TrimSpace(given[i])
+		}
+	}
+
+	opts, err := render.options(defaultTitle)
+	if err != nil {
+		return err
+	}
+	if opts.Card {
+		return usageError(tr("multiples draws no social cards"))
+	}
+	if opts.Layout != "" {
+		return usageError(tr("multiples draws years of weeks; -layout does not apply"))
+	}
+	if !flagSet(fs, "cell") {
+		opts.CellSize = multiplesCell
+	}
+	// Every grid ends on the last day any of them has data, so the same
+	// week lines up in each column, unless the options pin the grids.
+	// Years start on January 1 instead.
+	if *byYear {
+		opts.From, opts.To = time.Time{}, time.Time{}
+	} else if opts.From.IsZero() && opts.To.IsZero() {
+		for _, tweets := range datasets {
+			if last := tweets[len(tweets)-1].Date; last.After(opts.To) {
+				opts.To = last
+			}
+		}
+	}
+
+	scale := sharedScale(datasets, opts)
+	hms := make([]heatmap, len(datasets))
+	for i, tweets := range datasets {
+		gridOpts := opts
+		if *byYear {
+			gridOpts.From = time.Date(tweets[0].Date.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		}
+		hms[i] = newScaledHeatmap(tweets, gridOpts, scale)
+		names[i] = fmt.Sprintf("%s: %s", names[i], formatCount(gridTotal(hms[i])))
+	}
+
+	l := stackedLayout(hms, names, *columns, opts)
+	if *yearTable {
+		rows := yearRows(years)
+		for i, heading := range rows[0] {
+			rows[0][i] = opts.Theme.label(heading)
+		}
+		lines := alignColumns(rows)
+		for i, line := range lines {
+			l.labels = append(l.labels, layoutText{10, l.height + stackGap + 10 + i*panelLine, line})
+		}
+		l.height += stackGap + len(lines)*panelLine + 10
+	}
+	data, err := renderLayout(*format, l, opts)
+	if err != nil {
+		return renderError(err)
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return renderError(err)
+	}
+	printf("Small multiples generated successfully: %s\n", *output)
+	return nil
+}
+
+// splitYears returns each calendar year of tweets as a series of its own,
+// named by the year.
+func splitYears(tweets []DailyTweet) ([]string, [][]DailyTweet) {
+	var (
+		names    []string
+		datasets [][]DailyTweet
+	)
+	for _, tweet := range tweets {
+		name := strconv.Itoa(tweet.Date.Year())
+		if len(names) == 0 || names[len(names)-1] != name {
+			names = append(names, name)
+			datasets = append(datasets, nil)
+		}
+		datasets[len(datasets)-1] = append(datasets[len(datasets)-1], tweet)
+	}
+	return names, datasets
+}
+
+// alignColumns pads the cells of rows into lines of aligned columns, for
+// drawing tables in monospace text.
+func alignColumns(rows [][]string) []string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	lines := make([]string, len(rows))
+	for r, row := range rows {
+		var b strings.Builder
+		for i, cell := range row {
+			b.WriteString(cell)
+			if i < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+2))
+			}
+		}
+		lines[r] = b.String()
+	}
+	return lines
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
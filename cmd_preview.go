@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// previewInterval is how often preview checks its files for changes.
+const previewInterval = 500 * time.Millisecond
+
+func runPreview(args []string) error {
+	server, addr, err := parsePreview(args)
+	if err != nil {
+		return err
+	}
+	// Fail early on data that cannot be read; later failures are shown in
+	// the page instead.
+	if _, _, err := server.source.load(context.Background(), server.fs); err != nil {
+		return err
+	}
+
+	p := &preview{args: args, server: server, clients: make(map[chan string]bool)}
+	go p.watch()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", p.page)
+	mux.HandleFunc("/image", p.image)
+	mux.HandleFunc("/events", p.events)
+
+	slog.Info("serving preview", "url", "http://"+addr+"/")
+	if !isLoopback(addr) {
+		slog.Warn("preview has no authentication; activity data may be exposed", "addr", addr)
+	}
+	return (&http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}).ListenAndServe()
+}
+
+// parsePreview parses the preview flags into a server for the image. The
+// flags are parsed again whenever the config file changes.
+func parsePreview(args []string) (*heatmapServer, string, error) {
+	fs := newFlagSet("preview", "[input]")
+	source := addSourceFlags(fs)
+	render := addRenderFlags(fs)
+	addr := fs.String("addr", "localhost:8090", "address to listen on")
+	format := fs.String("format", "svg", "image format: png or svg")
+	if err := parseFlags(fs, args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() > 1 {
+		return nil, "", usageError(tr("at most one input may be given"))
+	}
+	if _, err := render.options(""); err != nil {
+		return nil, "", err
+	}
+	if _, ok := outputFormats[*format]; !ok || *format == "txt" || *format == "xlsx" {
+		return nil, "", usageError(trf("unknown image format %q", *format))
+	}
+
+	return &heatmapServer{
+		path:    "/image",
+		fs:      fs,
+		source:  source,
+		render:  render,
+		format:  *format,
+		metrics: newServerMetrics(),
+	}, *addr, nil
+}
+
+// preview serves a page showing the heatmap, and tells the page over
+// server-sent events to reload the image when the input file or the config
+// file changes.
+type preview struct {
+	args []string
+
+	mu      sync.Mutex
+	server  *heatmapServer
+	clients map[chan string]bool // event streams of open pages
+}
+
+// watch polls the files the preview depends on and notifies the pages of
+// changes. A changed config file changes the options, so the flags are
+// parsed again and the pages load afresh to pick up the new defaults.
+func (p *preview) watch() {
+	config, input := p.stamps()
+	for range time.Tick(previewInterval) {
+		newConfig, newInput := p.stamps()
+		if newConfig == config && newInput == input {
+			continue
+		}
+		configChanged := newConfig != config
+		config, input = newConfig, newInput
+
+		server, _, err := parsePreview(p.args)
+		if err != nil {
+			slog.Error("reloading options failed", "err", err)
+			p.broadcast("problem", err.Error())
+			continue
+		}
+		p.mu.Lock()
+		p.server = server
+		p.mu.Unlock()
+		slog.Info("change detected, reloading")
+		if configChanged {
+			p.broadcast("options", "")
+		} else {
+			p.broadcast("reload", "")
+		}
+	}
+}
+
+// stamps describes the config and input files by modification time and
+// size, so that any change to a file changes its stamp.
+func (p *preview) stamps() (config, input string) {
+	p.mu.Lock()
+	s := p.server
+	p.mu.Unlock()
+	return fileStamp(s.fs.Lookup("config").Value.String()), fileStamp(s.source.inputPath(s.fs))
+}
+
+func fileStamp(name string) string {
+	if name == "" {
+		return ""
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return "missing"
+	}
+	return fmt.Sprintf("%d %d", info.ModTime().UnixNano(), info.Size())
+}
+
+func (p *preview) broadcast(event, data string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for client := range p.clients {
+		select {
+		case client <- fmt.Sprintf("event: %s\ndata: %s\n\n", event, strings.ReplaceAll(data, "\n", " ")):
+		default: // the page is still busy with an earlier event
+		}
+	}
+}
+
+func (p *preview) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	client := make(chan string, 1)
+	p.mu.Lock()
+	p.clients[client] = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.clients, client)
+		p.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-client:
+			fmt.Fprint(w, event)
+			flusher.Flush()
+		}
+	}
+}
+
+// image serves the heatmap. The page adds a v parameter to bust the
+// browser's cache, which the server itself does not accept.
+func (p *preview) image(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	server := p.server
+	p.mu.Unlock()
+
+	query := r.URL.Query()
+	query.Del("v")
+	r.URL.RawQuery = query.Encode()
+	server.ServeHTTP(w, r)
+}
+
+func (p *preview) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	p.mu.Lock()
+	server := p.server
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := previewPage.Execute(w, struct {
+		Themes                 []string
+		Theme                  string
+		Cell, MinCell, MaxCell int
+	}{themeNames(), server.render.theme, server.render.cell, minCellSize, maxCellSize})
+	if err != nil {
+		slog.Error("rendering preview page failed", "err", err)
+	}
+}
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>heatmap preview</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+form { margin-bottom: 1em; }
+#problem { color: #b00; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<form>
+<label>Theme <select id="theme">
+{{range .Themes}}<option{{if eq . $.Theme}} selected{{end}}>{{.}}</option>
+{{end}}</select></label>
+<label>Cell <input id="cell" type="range" min="{{.MinCell}}" max="{{.MaxCell}}" value="{{.Cell}}"></label>
+</form>
+<p id="problem"></p>
+<img id="heatmap" alt="heatmap">
+<script>
+const img = document.getElementById("heatmap");
+const problem = document.getElementById("problem");
+const theme = document.getElementById("theme");
+const cell = document.getElementById("cell");
+let version = 0;
+
+function refresh() {
+  const query = new URLSearchParams({theme: theme.value, cell: cell.value, v: ++version});
+  img.src = "/image?" + query;
+}
+img.onload = () => { problem.textContent = ""; };
+img.onerror = () => fetch(img.src).then(r => r.text()).then(t => { problem.textContent = t; });
+theme.onchange = refresh;
+cell.onchange = refresh;
+
+const events = new EventSource("/events");
+events.addEventListener("reload", refresh);
+events.addEventListener("options", () => location.reload());
+events.addEventListener("problem", e => { problem.textContent = e.data; });
+refresh();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+func runPunchCard(args []string) error {
+	fs := newFlagSet("punchcard", "input")
+	render := addRenderFlags(fs)
+	var limits inputLimits
+	addLimitFlags(fs, &limits)
+	output := fs.String("output", "punchcard.png", "output image file")
+	fs.StringVar(output, "o", *output, "shorthand for -output")
+	format := fs.String("format", "", "output format: png or svg (default from the output file extension)")
+	tz := fs.String("tz", "", "time zone to count the hours in, e.g. Asia/Tokyo (default the zone each time was written in; zoneless times are read as local time)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError(tr("punchcard needs one input of timestamped events"))
+	}
+	if *format == "" {
+		*format = formatForFile(*output)
+	}
+	var loc *time.Location
+	if *tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(*tz); err != nil {
+			return usageError(trf("unknown time zone %q", *tz))
+		}
+	}
+
+	opts, err := render.options("Activity by Hour")
+	if err != nil {
+		return err
+	}
+	switch {
+	case opts.Card || opts.Layout != "":
+		return usageError(tr("punchcard draws its own grid; -card and -layout do not apply"))
+	case opts.Goal > 0 || opts.Forecast || opts.Smooth > 1 || opts.Normalize != "":
+		return usageError(tr("punchcard counts hours, not days: -goal, -forecast, -smooth and -normalize do not apply"))
+	}
+
+	readIn := loc
+	if readIn == nil {
+		readIn = time.Local
+	}
+	times, counts, err := readEvents(fs.Arg(0), readIn, limits)
+	if err != nil {
+		return classifyLoadError(err)
+	}
+	if len(times) == 0 {
+		return inputError(errorf("%s: no events to render", fs.Arg(0)))
+	}
+	card := tallyPunchCard(times, counts, loc, opts.From, opts.To)
+	scale := newColorScale(card.matrix(opts.Theme).counts(), opts)
+
+	data, err := renderLayout(*format, punchCardLayout(card, scale, opts), opts)
+	if err != nil {
+		return renderError(err)
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return renderError(err)
+	}
+	printf("Punch card generated successfully: %s\n", *output)
+	return nil
+}
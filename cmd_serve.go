@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func runServe(args []string) error {
+	fs := newFlagSet("serve", "[input]")
+	source := addSourceFlags(fs)
+	render := addRenderFlags(fs)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	format := fs.String("format", "png", "default image format: png or svg")
+	maxAge := fs.Duration("max-age", 5*time.Minute, "how long clients may cache an image before checking again")
+	requestTimeout := fs.Duration("request-timeout", 0, "give up loading and rendering an image after this long, answering 504, e.g. 30s (default no limit)")
+	tlsCert := fs.String("tls-cert", "", "serve HTTPS with this certificate file (requires -tls-key)")
+	tlsKey := fs.String("tls-key", "", "private key file for -tls-cert")
+	autocertHosts := fs.String("autocert", "", "serve HTTPS with certificates from Let's Encrypt for these comma-separated host names")
+	autocertCache := fs.String("autocert-cache", "", "directory to keep autocert certificates in (default in the user cache directory)")
+	authToken := fs.String("auth-token", os.Getenv("HEATMAP_AUTH_TOKEN"), "require this bearer token (default $HEATMAP_AUTH_TOKEN)")
+	webhook := fs.Bool("webhook", false, "accept data points POSTed to the image path and add them to the csv input file")
+	basicAuth := fs.String("basic-auth", os.Getenv("HEATMAP_BASIC_AUTH"), "require these user:password basic-auth credentials (default $HEATMAP_BASIC_AUTH)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return usageError(tr("at most one input may be given"))
+	}
+	// Check the flags once up front rather than failing every request.
+	if _, err := render.options(""); err != nil {
+		return err
+	}
+	if _, err := compileTransforms(source.transforms); err != nil {
+		return err
+	}
+	if _, ok := outputFormats[*format]; !ok {
+		return usageError(trf("unknown format %q", *format))
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return usageError(tr("-tls-cert and -tls-key must be given together"))
+	}
+	if *tlsCert != "" && *autocertHosts != "" {
+		return usageError(tr("-tls-cert and -autocert are mutually exclusive"))
+	}
+
+	var basicUser, basicPassword string
+	if *basicAuth != "" {
+		var ok bool
+		basicUser, basicPassword, ok = strings.Cut(*basicAuth, ":")
+		if !ok || basicUser == "" {
+			return usageError(tr("-basic-auth must be user:password"))
+		}
+	}
+
+	metrics := newServerMetrics()
+	base := &heatmapServer{
+		path:    "/",
+		fs:      fs,
+		source:  source,
+		render:  render,
+		format:  *format,
+		maxAge:  *maxAge,
+		timeout: *requestTimeout,
+		metrics: metrics,
+		webhook: *webhook,
+	}
+	routes, err := loadRoutes(fs, base)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	rootRouted := false
+	for _, route := range routes {
+		if route.path == "/metrics" {
+			return errorf("config: route /metrics conflicts with the metrics endpoint")
+		}
+		mux.Handle(route.path, route)
+		rootRouted = rootRouted || route.path == "/"
+		slog.Debug("route configured", "path", route.path, "source", route.source.name, "input", route.source.input, "format", route.format)
+	}
+	// Without a route of its own, / serves what the flags describe, if
+	// they describe any data beyond the routes.
+	describesData := fs.NArg() > 0 || source.input != "" || source.name != "csv"
+	if !rootRouted && (len(routes) == 0 || describesData) {
+		mux.Handle("/", base)
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           requireAuth(mux, *authToken, basicUser, basicPassword),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	useTLS := *tlsCert != "" || *autocertHosts != ""
+	if *autocertHosts != "" {
+		cacheDir := *autocertCache
+		if cacheDir == "" {
+			dir, err := os.UserCacheDir()
+			if err != nil {
+				return err
+			}
+			cacheDir = filepath.Join(dir, "heatmap-generator", "autocert")
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(*autocertHosts, ",")...),
+			Cache:      autocert.DirCache(cacheDir),
+		}
+		// The TLS-ALPN challenge is answered on the HTTPS port itself, so
+		// no plain HTTP listener is needed.
+		server.TLSConfig = manager.TLSConfig()
+	} else if useTLS {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if !isLoopback(*addr) && (!useTLS || (*authToken == "" && basicUser == "")) {
+		slog.Warn("serving beyond localhost without both TLS and authentication; activity data may be exposed", "addr", *addr)
+	}
+
+	// On interrupt, finish the requests in flight and return, so profiles
+	// and timings cover them.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if useTLS {
+		slog.Info("serving heatmap", "url", "https://"+*addr+"/")
+		err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		slog.Info("serving heatmap", "url", "http://"+*addr+"/")
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		slog.Info("server stopped")
+		return nil
+	}
+	return err
+}
+
+// isLoopback reports whether addr only listens on the loopback interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
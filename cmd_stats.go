@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func runStats(args []string) error {
+	fs := newFlagSet("stats", "[input]")
+	source := addSourceFlags(fs)
+	asJSON := fs.Bool("json", false, "print the statistics as a JSON object")
+	forecast := fs.Bool("forecast", false, trf("forecast the total of the year, assuming the rest of it averages the last %d days", forecastWindow))
+	k := fs.Float64("anomalies", defaultAnomalyK, trf("list days whose count is more than this many median absolute deviations from the median of the %d days before; 0 lists none", anomalyWindow))
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if _, err := checkAnomalies(*k); err != nil {
+		return err
+	}
+
+	tweets, _, err := source.load(context.Background(), fs)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeStatsJSON(os.Stdout, tweets, *k, *forecast)
+	}
+	if len(tweets) == 0 {
+		fmt.Println("no data")
+		return nil
+	}
+
+	sum := summarize(tweets)
+	fmt.Printf("range:           %s to %s (%d %s)\n", sum.from.Format("2006-01-02"), sum.to.Format("2006-01-02"), sum.days, plural(sum.days, "day", "days"))
+	fmt.Printf("total:           %d\n", sum.total)
+	fmt.Printf("active days:     %d\n", sum.active)
+	fmt.Printf("daily mean:      %.2f\n", sum.mean)
+	fmt.Printf("daily median:    %g\n", sum.median)
+	fmt.Printf("best day:        %s (%d)\n", sum.best.Date.Format("2006-01-02"), sum.best.Count)
+	fmt.Printf("busiest weekday: %s (%d)\n", sum.busiestWeekday, sum.weekdays[sum.busiestWeekday])
+	if sum.longestStreak > 0 {
+		fmt.Printf("longest streak:  %d %s (%s to %s)\n", sum.longestStreak, plural(sum.longestStreak, "day", "days"),
+			sum.longestStreakStart().Format("2006-01-02"), sum.longestStreakEnd.Format("2006-01-02"))
+	} else {
+		fmt.Printf("longest streak:  0 days\n")
+	}
+	fmt.Printf("current streak:  %d %s\n", sum.currentStreak, plural(sum.currentStreak, "day", "days"))
+
+	// The percentiles beside the color each scale would give them show
+	// which scale or thresholds spread skewed data over the colors.
+	fmt.Println()
+	scales := statsScales(tweets)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "percentile\tvalue")
+	for _, s := range scales {
+		fmt.Fprintf(tw, "\t%s", s.name)
+	}
+	fmt.Fprintln(tw)
+	for _, p := range statsPercentiles {
+		value := sum.percentile(p)
+		fmt.Fprintf(tw, "p%d\t%d", p, value)
+		for _, s := range scales {
+			fmt.Fprintf(tw, "\t%s", s.label(value))
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprint(tw, "thresholds\t")
+	for _, s := range scales {
+		fmt.Fprintf(tw, "\t%s", joinInts(s.thresholds))
+	}
+	fmt.Fprintln(tw)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// The weekday profile, with bars of up to profileBarWidth characters.
+	var most float64
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		most = math.Max(most, sum.weekdayMean(wd))
+	}
+	fmt.Println()
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "weekday\ttotal\tmean")
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		mean := sum.weekdayMean(wd)
+		bar := 0
+		if most > 0 {
+			bar = int(math.Round(mean / most * profileBarWidth))
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.2f\t%s\n", wd, sum.weekdays[wd], mean, strings.Repeat("#", bar))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	tr := computeTrend(tweets)
+	fmt.Println()
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "month\ttotal\t")
+	for _, m := range tr.months {
+		fmt.Fprintf(tw, "%s\t%d\t\n", m.month.Format("2006-01"), m.total)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("trend:           %+.2f a day each month\n", tr.slope*daysPerMonth)
+	if *forecast {
+		fmt.Printf("forecast:        %s for %d (%d so far, %.1f a day for %d more %s)\n",
+			formatCount(int(math.Round(tr.projected()))), tr.year, tr.yearToDate, tr.daily, tr.remaining, plural(tr.remaining, "day", "days"))
+	}
+
+	// Data of more than one calendar year compares them.
+	if years := yearTotals(tweets); len(years) > 1 {
+		fmt.Println()
+		tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, row := range yearRows(years) {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if *k > 0 {
+		anomalies := findAnomalies(tweets, *k)
+		fmt.Printf("\nunusual days: %d (more than %g MAD from the median of the %d days before)\n", len(anomalies), *k, anomalyWindow)
+		for i, a := range anomalies {
+			if i == maxListedAnomalies {
+				fmt.Printf("  ... and %d more\n", len(anomalies)-maxListedAnomalies)
+				break
+			}
+			fmt.Printf("  %s  %d (median %g)\n", a.Date.Format("2006-01-02"), a.Count, a.baseline)
+		}
+	}
+	return nil
+}
+
+// daysPerMonth turns the slope of the trend, per day, into a monthly
+// change of the daily count, which reads better.
+const daysPerMonth = 30
+
+// profileBarWidth is the length of the bar of the busiest weekday.
+const profileBarWidth = 30
+
+// maxListedAnomalies limits how many unusual days stats lists; -json gives
+// them all.
+const maxListedAnomalies = 20
+
+// statsPercentiles are the percentiles of the daily counts stats reports.
+var statsPercentiles = []int{50, 75, 90, 99}
+
+// statsScale is a kind of scale as it would color the data.
+type statsScale struct {
+	name string
+	bucketScale
+}
+
+// statsScales returns every kind of scale over tweets with the colors of
+// the default theme, as generate would draw them.
+func statsScales(tweets []DailyTweet) []statsScale {
+	counts := make([]int, len(tweets))
+	for i, tweet := range tweets {
+		counts[i] = tweet.Count
+	}
+	sort.Ints(counts)
+	var scales []statsScale
+	for _, name := range scaleNames() {
+		thresholds := scaleKinds[name](counts, len(baseColors)-1)
+		scales = append(scales, statsScale{name, bucketScale{thresholds: thresholds, colors: baseColors}})
+	}
+	return scales
+}
+
+// label returns the legend label of the color count takes. The legend
+// calls the first color 0 whatever else it covers, so here it gets its
+// range too.
+func (s statsScale) label(count int) string {
+	b := s.bucket(count)
+	if b == 0 && s.thresholds[0] > 0 {
+		return fmt.Sprintf("0-%d", s.thresholds[0])
+	}
+	return s.legendEntries()[b].label
+}
+
+func joinInts(ns []int) string {
+	fields := make([]string, len(ns))
+	for i, n := range ns {
+		fields[i] = strconv.Itoa(n)
+	}
+	return strings.Join(fields, ",")
+}
+
+// statsJSON is what stats -json prints. Without data only days and the
+// zero totals are given.
+type statsJSON struct {
+	From           string         `json:"from,omitempty"`
+	To             string         `json:"to,omitempty"`
+	Days           int            `json:"days"`
+	Total          int            `json:"total"`
+	ActiveDays     int            `json:"active_days"`
+	Mean           float64        `json:"mean"`
+	Median         float64        `json:"median"`
+	BestDay        *statsDay      `json:"best_day,omitempty"`
+	BusiestWeekday string         `json:"busiest_weekday,omitempty"`
+	Weekdays       map[string]int `json:"weekdays,omitempty"`
+	// WeekdayMeans are the average counts of each weekday over the range.
+	WeekdayMeans  map[string]float64 `json:"weekday_means,omitempty"`
+	LongestStreak statsStreak        `json:"longest_streak"`
+	CurrentStreak statsStreak        `json:"current_streak"`
+	// Percentiles of the daily counts, each with the legend label of its
+	// color in every kind of scale, and the thresholds of those scales.
+	Percentiles []statsPercentile `json:"percentiles,omitempty"`
+	Thresholds  map[string][]int  `json:"thresholds,omitempty"`
+	Anomalies   []statsAnomaly    `json:"anomalies,omitempty"`
+	// Monthly totals, the change of the daily count a month by the least
+	// squares line and, with -forecast, the forecast of the year.
+	Months   []statsMonth   `json:"months,omitempty"`
+	Trend    float64        `json:"trend_per_month"`
+	Forecast *statsForecast `json:"forecast,omitempty"`
+	// Years are the calendar years of data spanning more than one.
+	Years []statsYear `json:"years,omitempty"`
+}
+
+// statsYear is a calendar year; days counts those the data covers, fewer
+// in partial first and last years.
+type statsYear struct {
+	Year    int      `json:"year"`
+	Days    int      `json:"days"`
+	Total   int      `json:"total"`
+	Mean    float64  `json:"mean"`
+	BestDay statsDay `json:"best_day"`
+}
+
+type statsMonth struct {
+	Month string `json:"month"`
+	Total int    `json:"total"`
+}
+
+type statsForecast struct {
+	Year          int     `json:"year"`
+	ToDate        int     `json:"to_date"`
+	RemainingDays int     `json:"remaining_days"`
+	Daily         float64 `json:"daily"`
+	Total         int     `json:"total"`
+}
+
+type statsAnomaly struct {
+	Date     string  `json:"date"`
+	Count    int     `json:"count"`
+	Baseline float64 `json:"baseline"` // median of the days before
+}
+
+type statsPercentile struct {
+	Percentile int               `json:"percentile"`
+	Value      int               `json:"value"`
+	Buckets    map[string]string `json:"buckets"`
+}
+
+// statsStreak is a run of active days; its dates are left out when it is
+// zero days long.
+type statsStreak struct {
+	Days int    `json:"days"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+func newStatsStreak(days int, end time.Time) statsStreak {
+	if days == 0 {
+		return statsStreak{}
+	}
+	return statsStreak{days, addDate(end, 0, 0, 1-days).Format("2006-01-02"), end.Format("2006-01-02")}
+}
+
+type statsDay struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+func writeStatsJSON(w io.Writer, tweets []DailyTweet, k float64, forecast bool) error {
+	var out statsJSON
+	if len(tweets) > 0 {
+		sum := summarize(tweets)
+		out = statsJSON{
+			From:           sum.from.Format("2006-01-02"),
+			To:             sum.to.Format("2006-01-02"),
+			Days:           sum.days,
+			Total:          sum.total,
+			ActiveDays:     sum.active,
+			Mean:           math.Round(sum.mean*100) / 100,
+			Median:         sum.median,
+			BestDay:        &statsDay{sum.best.Date.Format("2006-01-02"), sum.best.Count},
+			BusiestWeekday: strings.ToLower(sum.busiestWeekday.String()),
+			Weekdays:       make(map[string]int),
+			WeekdayMeans:   make(map[string]float64),
+			LongestStreak:  newStatsStreak(sum.longestStreak, sum.longestStreakEnd),
+			CurrentStreak:  newStatsStreak(sum.currentStreak, sum.to),
+		}
+		for wd, total := range sum.weekdays {
+			out.Weekdays[strings.ToLower(time.Weekday(wd).String())] = total
+			out.WeekdayMeans[strings.ToLower(time.Weekday(wd).String())] = math.Round(sum.weekdayMean(time.Weekday(wd))*100) / 100
+		}
+		scales := statsScales(tweets)
+		for _, p := range statsPercentiles {
+			row := statsPercentile{Percentile: p, Value: sum.percentile(p), Buckets: make(map[string]string)}
+			for _, s := range scales {
+				row.Buckets[s.name] = s.label(row.Value)
+			}
+			out.Percentiles = append(out.Percentiles, row)
+		}
+		out.Thresholds = make(map[string][]int)
+		for _, s := range scales {
+			out.Thresholds[s.name] = s.thresholds
+		}
+		for _, a := range findAnomalies(tweets, k) {
+			out.Anomalies = append(out.Anomalies, statsAnomaly{a.Date.Format("2006-01-02"), a.Count, a.baseline})
+		}
+		tr := computeTrend(tweets)
+		for _, m := range tr.months {
+			out.Months = append(out.Months, statsMonth{m.month.Format("2006-01"), m.total})
+		}
+		out.Trend = math.Round(tr.slope*daysPerMonth*100) / 100
+		if forecast {
+			out.Forecast = &statsForecast{
+				Year:          tr.year,
+				ToDate:        tr.yearToDate,
+				RemainingDays: tr.remaining,
+				Daily:         math.Round(tr.daily*100) / 100,
+				Total:         int(math.Round(tr.projected())),
+			}
+		}
+		if years := yearTotals(tweets); len(years) > 1 {
+			for _, y := range years {
+				out.Years = append(out.Years, statsYear{y.year, y.covered, y.total, math.Round(y.mean()*100) / 100,
+					statsDay{y.best.Date.Format("2006-01-02"), y.best.Count}})
+			}
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// summary is the headline statistics of a non-empty series.
+type summary struct {
+	from, to time.Time
+	total    int
+	active   int // days with a count above zero
+	best     DailyTweet
+	// Days from the first to the last, with the days without data counting
+	// as zero in the mean and median.
+	days         int
+	mean, median float64
+	dayCounts    []int // the count of every day, sorted
+	// Totals of each weekday, and the weekday with the most; the earlier
+	// in the week on a tie.
+	weekdays       [7]int
+	busiestWeekday time.Weekday
+	weekdayDays    [7]int // how many of each weekday the range has
+	// Runs of consecutive active days: the longest, which ends on the
+	// first day it could, and the one ending on the last day, which is zero
+	// when that day was idle.
+	longestStreak, currentStreak int
+	longestStreakEnd             time.Time
+}
+
+func summarize(tweets []DailyTweet) summary {
+	if len(tweets) == 0 {
+		return summary{}
+	}
+	s := summary{from: tweets[0].Date, to: tweets[len(tweets)-1].Date, best: tweets[0]}
+	streak := 0
+	var last time.Time
+	for _, tweet := range tweets {
+		s.total += tweet.Count
+		s.weekdays[tweet.Date.Weekday()] += tweet.Count
+		if tweet.Count > s.best.Count {
+			s.best = tweet
+		}
+		if tweet.Count <= 0 {
+			streak = 0
+			continue
+		}
+		s.active++
+		if streak > 0 && tweet.Date.Equal(addDate(last, 0, 0, 1)) {
+			streak++
+		} else {
+			streak = 1
+		}
+		last = tweet.Date
+		if streak > s.longestStreak {
+			s.longestStreak = streak
+			s.longestStreakEnd = tweet.Date
+		}
+	}
+	if last.Equal(s.to) {
+		s.currentStreak = streak
+	}
+
+	var counts []int
+	i := 0
+	for d := s.from; !d.After(s.to); d = addDate(d, 0, 0, 1) {
+		n := 0
+		if i < len(tweets) && tweets[i].Date.Equal(d) {
+			n = tweets[i].Count
+			i++
+		}
+		counts = append(counts, n)
+		s.weekdayDays[d.Weekday()]++
+	}
+	sort.Ints(counts)
+	s.dayCounts = counts
+	s.days = len(counts)
+	s.mean = float64(s.total) / float64(s.days)
+	if mid := s.days / 2; s.days%2 == 1 {
+		s.median = float64(counts[mid])
+	} else {
+		s.median = float64(counts[mid-1]+counts[mid]) / 2
+	}
+	for wd := range s.weekdays {
+		if s.weekdays[wd] > s.weekdays[s.busiestWeekday] {
+			s.busiestWeekday = time.Weekday(wd)
+		}
+	}
+	return s
+}
+
+// weekdayMean returns the average count of the weekday over the range.
+func (s summary) weekdayMean(wd time.Weekday) float64 {
+	if s.weekdayDays[wd] == 0 {
+		return 0
+	}
+	return float64(s.weekdays[wd]) / float64(s.weekdayDays[wd])
+}
+
+// longestStreakStart returns the first day of the longest streak.
+func (s summary) longestStreakStart() time.Time {
+	return addDate(s.longestStreakEnd, 0, 0, 1-s.longestStreak)
+}
+
+// percentile returns the nearest-rank p-th percentile of the daily counts:
+// the smallest count at least p percent of the days do not exceed.
+func (s summary) percentile(p int) int {
+	rank := (p*len(s.dayCounts) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return s.dayCounts[rank-1]
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math/rand"
+	"os"
+	"time"
+)
+
+func runThemes(args []string) error {
+	fs := newFlagSet("themes", "")
+	preview := fs.String("preview", "", "render a sample heatmap in every theme to this PNG file")
+	show := fs.String("show", "", "print the file of this theme, to share it or start a new one from")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError(tr("themes takes no arguments"))
+	}
+
+	if *show != "" {
+		if _, err := lookupTheme(*show); err != nil {
+			return err
+		}
+		data, _, err := readThemeFile(*show)
+		if err != nil {
+			return inputError(err)
+		}
+		os.Stdout.Write(data)
+		return nil
+	}
+	if *preview == "" {
+		for _, name := range themeNames() {
+			fmt.Println(name)
+		}
+		return nil
+	}
+
+	img, err := renderThemePreview()
+	if err != nil {
+		return renderError(err)
+	}
+	if err := savePNG(img, *preview); err != nil {
+		return renderError(err)
+	}
+	printf("Theme preview generated successfully: %s\n", *preview)
+	return nil
+}
+
+// renderThemePreview stacks one heatmap per theme, built in or the user's,
+// all drawn from the same sample data so only the looks differ.
+func renderThemePreview() (*image.RGBA, error) {
+	tweets := generateSample(rand.New(rand.NewSource(1)), time.Date(2024, time.December, 31, 0, 0, 0, 0, time.UTC), 365)
+
+	var panels []*image.RGBA
+	width, height := 0, 0
+	for _, name := range themeNames() {
+		t, err := lookupTheme(name)
+		if err != nil {
+			return nil, err
+		}
+		panel, err := generateHeatmap(tweets, renderOptions{Title: name, Theme: t})
+		if err != nil {
+			return nil, err
+		}
+		panels = append(panels, panel)
+		if w := panel.Bounds().Dx(); w > width {
+			width = w
+		}
+		height += panel.Bounds().Dy()
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	y := 0
+	for _, panel := range panels {
+		r := image.Rect(0, y, panel.Bounds().Dx(), y+panel.Bounds().Dy())
+		draw.Draw(img, r, panel, panel.Bounds().Min, draw.Src)
+		y += panel.Bounds().Dy()
+	}
+	return img, nil
+}
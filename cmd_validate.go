@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxListedGaps limits how many gaps validate lists individually.
+const maxListedGaps = 10
+
+type dateGap struct {
+	from, to time.Time // first and last missing day
+}
+
+func (g dateGap) days() int {
+	return daysBetween(g.from, g.to) + 1
+}
+
+func runValidate(args []string) error {
+	fs := newFlagSet("validate", "[input]")
+	source := addSourceFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var (
+		tweets           []DailyTweet
+		rows, duplicates int
+	)
+	merged, err := source.mergeSpecs(fs)
+	if err != nil {
+		return err
+	}
+	if input := source.inputPath(fs); source.name == "csv" && input != "" && fs.NArg() <= 1 && len(merged) == 0 {
+		// CSV is added up per day as it is read, so its reader counts the
+		// rows.
+		var stats csvStats
+		if tweets, stats, err = readCSVStats(input, source.options.Column, source.options.Limits); err != nil {
+			return classifyLoadError(err)
+		}
+		rows, duplicates = stats.rows, stats.duplicates
+	} else {
+		raw, _, err := source.loadRaw(context.Background(), fs)
+		if err != nil {
+			return err
+		}
+		tweets, duplicates = normalizeTweets(raw)
+		rows = len(raw)
+	}
+	if len(tweets) == 0 {
+		return inputError(errorf("no rows"))
+	}
+
+	first, last := tweets[0].Date, tweets[len(tweets)-1].Date
+	fmt.Printf("rows:       %d (%d duplicate dates)\n", rows, duplicates)
+	fmt.Printf("days:       %d\n", len(tweets))
+	fmt.Printf("range:      %s to %s\n", first.Format("2006-01-02"), last.Format("2006-01-02"))
+
+	gaps := findGaps(tweets)
+	missing, longest := 0, dateGap{}
+	for _, g := range gaps {
+		missing += g.days()
+		if g.days() > longest.days() || longest.from.IsZero() {
+			longest = g
+		}
+	}
+	fmt.Printf("gaps:       %d missing %s in %d %s\n", missing, plural(missing, "day", "days"), len(gaps), plural(len(gaps), "gap", "gaps"))
+	if len(gaps) > 0 {
+		fmt.Printf("longest:    %d %s, %s\n", longest.days(), plural(longest.days(), "day", "days"), formatGap(longest))
+		sort.SliceStable(gaps, func(i, j int) bool { return gaps[i].days() > gaps[j].days() })
+		for i, g := range gaps {
+			if i == maxListedGaps {
+				fmt.Printf("            ... and %d more\n", len(gaps)-maxListedGaps)
+				break
+			}
+			fmt.Printf("            %s (%d %s)\n", formatGap(g), g.days(), plural(g.days(), "day", "days"))
+		}
+	}
+
+	counts := make([]int, len(tweets))
+	for i, tweet := range tweets {
+		counts[i] = tweet.Count
+	}
+	sort.Ints(counts)
+	scale := bucketScale{thresholds: linearThresholds(counts, len(baseColors)-1), colors: baseColors}
+	var labels []string
+	for _, entry := range scale.legendEntries() {
+		if entry.label != "" {
+			labels = append(labels, entry.label)
+		}
+	}
+	thresholds := scale.thresholds
+	fmt.Printf("thresholds: %v\n", thresholds)
+	fmt.Printf("buckets:    %s\n", strings.Join(labels, ", "))
+
+	printf("ok\n")
+	return nil
+}
+
+// findGaps returns the runs of days without data between the first and
+// last day of tweets, which must be sorted and deduplicated.
+func findGaps(tweets []DailyTweet) []dateGap {
+	var gaps []dateGap
+	for i := 1; i < len(tweets); i++ {
+		next := addDate(tweets[i-1].Date, 0, 0, 1)
+		if tweets[i].Date.After(next) {
+			gaps = append(gaps, dateGap{from: next, to: addDate(tweets[i].Date, 0, 0, -1)})
+		}
+	}
+	return gaps
+}
+
+func formatGap(g dateGap) string {
+	if g.from.Equal(g.to) {
+		return g.from.Format("2006-01-02")
+	}
+	return g.from.Format("2006-01-02") + " to " + g.to.Format("2006-01-02")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"os"
+)
+
+// PNG output says what its colors mean, so browsers, image viewers and
+// print pipelines that manage color show the theme's colors alike: as sRGB,
+// the space theme colors are written in, unless -icc-profile embeds a
+// profile the colors were picked in. SVG colors are sRGB by definition.
+
+// pngColorChunks returns the chunks tagging a PNG's colors: an iCCP chunk
+// of profile, or else an sRGB chunk with the gAMA and cHRM chunks that the
+// PNG specification recommends alongside for decoders without sRGB.
+func pngColorChunks(profile []byte) ([]byte, error) {
+	if profile != nil {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(profile); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		// The profile's name, a null byte and compression method 0.
+		data := append([]byte("ICC profile\x00\x00"), compressed.Bytes()...)
+		return pngChunk("iCCP", data), nil
+	}
+	chunks := pngChunk("sRGB", []byte{0}) // perceptual rendering intent
+	chunks = append(chunks, pngChunk("gAMA", binary.BigEndian.AppendUint32(nil, 45455))...)
+	// The white point and the red, green and blue primaries of sRGB, in
+	// hundred-thousandths.
+	var chrm []byte
+	for _, v := range []uint32{31270, 32900, 64000, 33000, 30000, 60000, 15000, 6000} {
+		chrm = binary.BigEndian.AppendUint32(chrm, v)
+	}
+	return append(chunks, pngChunk("cHRM", chrm)...), nil
+}
+
+// maxICCProfile bounds -icc-profile; display profiles are a few kilobytes,
+// print profiles a few hundred.
+const maxICCProfile = 4 << 20
+
+// readICCProfile reads the ICC profile at path for -icc-profile, checking
+// its header: the size it gives, the acsp signature, and an RGB color
+// space, the only one PNG's colors can be in.
+func readICCProfile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, inputError(err)
+	}
+	if info.Size() > maxICCProfile {
+		return nil, usageError(trf("%s: ICC profiles over %d MB are not accepted", path, maxICCProfile>>20))
+	}
+	profile, err := os.ReadFile(path)
+	if err != nil {
+		return nil, inputError(err)
+	}
+	switch {
+	case len(profile) < 128 || string(profile[36:40]) != "acsp" || binary.BigEndian.Uint32(profile) != uint32(len(profile)):
+		return nil, malformedf("%s: not an ICC profile", path)
+	case string(profile[16:20]) != "RGB ":
+		return nil, malformedf("%s: the profile is for %q, not RGB", path, bytes.TrimSpace(profile[16:20]))
+	}
+	return profile, nil
+}
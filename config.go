@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// envPrefix starts the names of environment variables that set flags:
+// HEATMAP_THEME sets -theme and HEATMAP_MAX_AGE sets -max-age.
+const envPrefix = "HEATMAP_"
+
+// defaultConfigFile is read when present in the working directory and no
+// -config flag is given.
+const defaultConfigFile = "heatmap.toml"
+
+// loadConfig reads a TOML config file. A missing default config file is not
+// an error; a missing file named explicitly is.
+func loadConfig(path string) (map[string]interface{}, error) {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigFile
+	}
+
+	config := make(map[string]interface{})
+	if _, err := toml.DecodeFile(path, &config); err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyConfig sets every flag of fs that was not given on the command line
+// from the config file named by its -config flag, first from the table
+// named after command, as [generate], and then from the top level. Config
+// keys are flag names; keys that are not flags of this command, and other
+// tables, are ignored so one file can serve every command.
+func applyConfig(fs *flag.FlagSet, command string) error {
+	config, err := loadConfig(fs.Lookup("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	set := setFlags(fs)
+	apply := func(values map[string]interface{}, prefix string) error {
+		// Keys go in order so that, of aliases both given, the same one
+		// always wins.
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := values[key]
+			if set[key] || fs.Lookup(key) == nil {
+				continue
+			}
+			if _, ok := value.(map[string]interface{}); ok {
+				continue
+			}
+			if err := setFlag(fs, key, value); err != nil {
+				return errorf("config: %s%s: %w", prefix, key, err)
+			}
+			markSet(fs, set, key)
+		}
+		return nil
+	}
+	if table, ok := config[command].(map[string]interface{}); ok {
+		if err := apply(table, command+"."); err != nil {
+			return err
+		}
+	}
+	return apply(config, "")
+}
+
+// setFlags returns the names of the flags of fs that have been set, with
+// their aliases.
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		markSet(fs, set, f.Name)
+	})
+	return set
+}
+
+// markSet records the flag name as set, along with the flags sharing its
+// Value, as -o shares that of -output: they are one flag under two names,
+// so a value for either must not reach it once the other is set.
+func markSet(fs *flag.FlagSet, set map[string]bool, name string) {
+	value := reflect.ValueOf(fs.Lookup(name).Value)
+	fs.VisitAll(func(f *flag.Flag) {
+		other := reflect.ValueOf(f.Value)
+		if f.Name == name || (value.Kind() == reflect.Pointer && other.Kind() == reflect.Pointer &&
+			value.Type() == other.Type() && value.Pointer() == other.Pointer()) {
+			set[f.Name] = true
+		}
+	})
+}
+
+// setFlag sets a flag from a config value. An array sets a repeatable
+// flag once per element.
+func setFlag(fs *flag.FlagSet, name string, value interface{}) error {
+	if values, ok := value.([]interface{}); ok {
+		for _, v := range values {
+			if err := fs.Set(name, fmt.Sprint(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fs.Set(name, fmt.Sprint(value))
+}
+
+// applyEnv sets every flag of fs that was not given on the command line
+// from its HEATMAP_ environment variable, if that is set and not empty.
+// The environment takes precedence over the config file, which suits CI
+// jobs where a step's settings arrive as variables.
+func applyEnv(fs *flag.FlagSet) error {
+	set := setFlags(fs)
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value := os.Getenv(name); value != "" {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = errorf("%s: %w", name, setErr)
+			}
+			markSet(fs, set, f.Name)
+		}
+	})
+	return err
+}
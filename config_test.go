@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestOutputPrecedence checks the order in which the command line, the
+// environment and the config file set -output, given as itself or as -o.
+func TestOutputPrecedence(t *testing.T) {
+	const config = `
+output = "top.png"
+theme = "sunset"
+
+[generate]
+output = "table.png"
+`
+	tests := []struct {
+		name string
+		args []string
+		env  string // HEATMAP_OUTPUT
+		want []string
+	}{
+		{"config table", nil, "", []string{"table.png"}},
+		{"environment", nil, "env.png", []string{"env.png"}},
+		{"-output", []string{"-output", "flag.png"}, "env.png", []string{"flag.png"}},
+		{"-o", []string{"-o", "flag.png"}, "", []string{"flag.png"}},
+		{"-o over the environment", []string{"-o", "flag.png"}, "env.png", []string{"flag.png"}},
+	}
+	configFile := filepath.Join(t.TempDir(), "heatmap.toml")
+	if err := os.WriteFile(configFile, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HEATMAP_OUTPUT", tt.env)
+			fs := newFlagSet("generate", "[input]")
+			g := addGenerateFlags(fs)
+			if err := parseFlags(fs, append([]string{"-config", configFile}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+			if got := append([]string{g.output}, g.also...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outputs %q, want %q", got, tt.want)
+			}
+			if g.render.theme != "sunset" {
+				t.Errorf("theme %q, want the top level's sunset", g.render.theme)
+			}
+		})
+	}
+}
+
+// TestConfigTableScope checks that the keys of a command's table reach
+// that command alone: convert, whose -output is a CSV file, keeps writing
+// to standard output.
+func TestConfigTableScope(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "heatmap.toml")
+	if err := os.WriteFile(configFile, []byte("[generate]\noutput = \"heatmap.png\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs := newFlagSet("convert", "[input]")
+	addSourceFlags(fs)
+	output := fs.String("output", "-", "")
+	fs.StringVar(output, "o", *output, "")
+	if err := parseFlags(fs, []string{"-config", configFile}); err != nil {
+		t.Fatal(err)
+	}
+	if *output != "-" {
+		t.Errorf("convert writes to %q, want standard output", *output)
+	}
+}
+
+// TestRouteRepeatedFlags checks that a route starts from each -transform
+// serve was given, commas and all, before adding its own.
+func TestRouteRepeatedFlags(t *testing.T) {
+	fs := newFlagSet("serve", "[input]")
+	addSourceFlags(fs)
+	addRenderFlags(fs)
+	if err := fs.Parse([]string{"-transform", "min(count, 5)", "-transform", "!weekend"}); err != nil {
+		t.Fatal(err)
+	}
+	route, err := newRoute(fs, &heatmapServer{}, "/a.png", map[string]interface{}{"transform": []interface{}{"count * 2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := stringList{"min(count, 5)", "!weekend", "count * 2"}
+	if !reflect.DeepEqual(route.source.transforms, want) {
+		t.Errorf("route transforms %q, want %q", route.source.transforms, want)
+	}
+}
+
+// TestStarterConfigInput checks that config init quotes the sample's path
+// as TOML, so paths with quotes and backslashes read back as they were.
+func TestStarterConfigInput(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "heatmap.toml")
+	sample := filepath.Join(dir, `my "data"\input.csv`)
+	if err := runConfigInit([]string{"-sample", sample, configFile}); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config["input"] != sample {
+		t.Errorf("input %q, want %q", config["input"], sample)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gapPolicies are how correlate treats a day one series has no data for:
+// leave the day out, or count it as zero, as a day without a run is.
+var gapPolicies = []string{"skip", "zero"}
+
+// checkGapPolicy validates -gaps.
+func checkGapPolicy(policy string) error {
+	for _, p := range gapPolicies {
+		if policy == p {
+			return nil
+		}
+	}
+	return usageError(trf("unknown gap policy %q (available: %s)", policy, strings.Join(gapPolicies, ", ")))
+}
+
+// pairedDay is a day of the first series with the day lag days later of
+// the second.
+type pairedDay struct {
+	date time.Time
+	x, y float64
+}
+
+// pairDays lines up a with b shifted by lag days, over the days both
+// cover: the first day of a is paired with the day lag days after it in b.
+// With the zero policy days missing from one series count as zero; with
+// skip only days both have data for are paired.
+func pairDays(a, b []DailyTweet, lag int, gaps string) []pairedDay {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	countsA, countsB := make(map[civilDate]int, len(a)), make(map[civilDate]int, len(b))
+	for _, t := range a {
+		countsA[civil(t.Date)] = t.Count
+	}
+	for _, t := range b {
+		countsB[civil(t.Date)] = t.Count
+	}
+	first, last := a[0].Date, a[len(a)-1].Date
+	if d := addDate(b[0].Date, 0, 0, -lag); d.After(first) {
+		first = d
+	}
+	if d := addDate(b[len(b)-1].Date, 0, 0, -lag); d.Before(last) {
+		last = d
+	}
+	var days []pairedDay
+	for d := first; !d.After(last); d = addDate(d, 0, 0, 1) {
+		x, okX := countsA[civil(d)]
+		y, okY := countsB[civil(addDate(d, 0, 0, lag))]
+		if gaps == "skip" && (!okX || !okY) {
+			continue
+		}
+		days = append(days, pairedDay{d, float64(x), float64(y)})
+	}
+	return days
+}
+
+// correlation describes how two paired series move together. Pearson's r
+// measures a straight-line relation; Spearman's rho, Pearson's r of the
+// ranks, any relation where more of one goes with more of the other. Both
+// are NaN when either series never changes.
+type correlation struct {
+	n        int
+	pearson  float64
+	spearman float64
+	slope    float64 // of the least-squares line of y on x
+}
+
+func correlate(days []pairedDay) correlation {
+	xs, ys := make([]float64, len(days)), make([]float64, len(days))
+	for i, d := range days {
+		xs[i], ys[i] = d.x, d.y
+	}
+	r, slope := pearson(xs, ys)
+	rho, _ := pearson(ranks(xs), ranks(ys))
+	return correlation{n: len(days), pearson: r, spearman: rho, slope: slope}
+}
+
+// pearson returns Pearson's r of xs and ys and the slope of the
+// least-squares line of ys on xs.
+func pearson(xs, ys []float64) (float64, float64) {
+	n := float64(len(xs))
+	if n < 2 {
+		return math.NaN(), math.NaN()
+	}
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX, meanY = meanX/n, meanY/n
+	var sxx, syy, sxy float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sxx += dx * dx
+		syy += dy * dy
+		sxy += dx * dy
+	}
+	if sxx == 0 || syy == 0 {
+		slope := math.NaN()
+		if sxx != 0 {
+			slope = 0
+		}
+		return math.NaN(), slope
+	}
+	return sxy / math.Sqrt(sxx*syy), sxy / sxx
+}
+
+// ranks returns the rank of each value, from 1, ties sharing the mean of
+// the ranks they span.
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return values[order[i]] < values[order[j]] })
+	r := make([]float64, len(values))
+	for i := 0; i < len(order); {
+		j := i
+		for j+1 < len(order) && values[order[j+1]] == values[order[i]] {
+			j++
+		}
+		mean := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			r[order[k]] = mean
+		}
+		i = j + 1
+	}
+	return r
+}
+
+// formatCoefficient writes a correlation coefficient, or "undefined".
+func formatCoefficient(r float64) string {
+	if math.IsNaN(r) {
+		return "undefined"
+	}
+	return fmt.Sprintf("%.3f", r)
+}
+
+// strength names the strength of a correlation coefficient by the usual
+// rule of thumb.
+func strength(r float64) string {
+	switch a := math.Abs(r); {
+	case math.IsNaN(r):
+		return ""
+	case a < 0.1:
+		return "none"
+	case a < 0.3:
+		return "weak"
+	case a < 0.5:
+		return "moderate"
+	default:
+		return "strong"
+	}
+}
+
+// The scatter plot of correlate is a square of scatterSize pixels with room
+// left of and below it for the axis labels.
+const (
+	scatterSize   = 320
+	scatterMargin = 60
+	scatterDot    = 4
+)
+
+// scatterLayout plots each paired day as a dot, x right and y up, from zero
+// to the largest value of each series, with the name of the first series
+// below the plot, the second above it and the coefficients at the bottom.
+func scatterLayout(days []pairedDay, names []string, c correlation, opts renderOptions) layout {
+	t := opts.Theme
+	left, top := scatterMargin, titleHeight+25
+	bottom := top + scatterSize
+	l := layout{width: left + scatterSize + 40, height: bottom + scatterMargin + 20}
+	l.labels = append(l.labels, layoutText{10, 25, opts.Title})
+
+	var maxX, maxY float64
+	for _, d := range days {
+		maxX, maxY = max(maxX, d.x), max(maxY, d.y)
+	}
+	maxX, maxY = max(maxX, 1), max(maxY, 1)
+
+	axis := mix(t.Text, t.Background, 0.6)
+	l.bars = append(l.bars,
+		layoutSwatch{rect: image.Rect(left, top, left+1, bottom+1), color: axis},
+		layoutSwatch{rect: image.Rect(left, bottom, left+scatterSize+1, bottom+1), color: axis})
+	l.labels = append(l.labels,
+		layoutText{left - 10, bottom + 15, "0"},
+		layoutText{left + scatterSize - 20, bottom + 15, formatValue(maxX)},
+		layoutText{left + scatterSize/2 - 30, bottom + 30, names[0]},
+		layoutText{10, top + 10, formatValue(maxY)},
+		layoutText{left + 5, top - 10, names[1]},
+		layoutText{10, bottom + 50, t.labeln("%d day   Pearson r %s   Spearman rho %s", "%d days   Pearson r %s   Spearman rho %s",
+			c.n, c.n, formatCoefficient(c.pearson), formatCoefficient(c.spearman))})
+
+	dot := t.Colors[len(t.Colors)-1]
+	for _, d := range days {
+		x := left + int(math.Round(d.x/maxX*float64(scatterSize-scatterDot)))
+		y := bottom - scatterDot - int(math.Round(d.y/maxY*float64(scatterSize-scatterDot)))
+		l.bars = append(l.bars, layoutSwatch{rect: image.Rect(x+1, y, x+1+scatterDot, y+scatterDot), color: dot})
+	}
+	return l
+}
+
+// formatValue writes an axis value without needless decimals.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
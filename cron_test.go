@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// cronBits returns the bit set of the values from lo to hi, every step.
+func cronBits(lo, hi, step int) uint64 {
+	var bits uint64
+	for n := lo; n <= hi; n += step {
+		bits |= 1 << n
+	}
+	return bits
+}
+
+func TestParseSchedule(t *testing.T) {
+	every := func(n int) uint64 { return 1 << n }
+	tests := []struct {
+		spec string
+		want schedule
+	}{
+		{"* * * * *", cronSchedule{cronBits(0, 59, 1), cronBits(0, 23, 1), cronBits(1, 31, 1), cronBits(1, 12, 1), cronBits(0, 7, 1), true, true}},
+		{"30 6 * * mon-fri", cronSchedule{every(30), every(6), cronBits(1, 31, 1), cronBits(1, 12, 1), cronBits(1, 5, 1), true, false}},
+		{"*/15 9-17/2 1,15 * *", cronSchedule{cronBits(0, 59, 15), cronBits(9, 17, 2), every(1) | every(15), cronBits(1, 12, 1), cronBits(0, 7, 1), false, true}},
+		{"5/20 0 ? JAN,Jul-sep ?", cronSchedule{cronBits(5, 59, 20), every(0), cronBits(1, 31, 1), every(1) | cronBits(7, 9, 1), cronBits(0, 7, 1), true, true}},
+		// 7 is Sunday as well as 0.
+		{"0 0 * * 7", cronSchedule{every(0), every(0), cronBits(1, 31, 1), cronBits(1, 12, 1), every(0) | every(7), true, false}},
+		{"0 0 * * sat,sun", cronSchedule{every(0), every(0), cronBits(1, 31, 1), cronBits(1, 12, 1), every(0) | every(6), true, false}},
+		{"  @daily ", cronSchedule{every(0), every(0), cronBits(1, 31, 1), cronBits(1, 12, 1), cronBits(0, 7, 1), true, true}},
+		{"@yearly", cronSchedule{every(0), every(0), every(1), every(1), cronBits(0, 7, 1), false, true}},
+		{"@every 90m", everySchedule(90 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseSchedule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("schedule %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"", "want 5 fields"},
+		{"0 0 * *", "want 5 fields"},
+		{"0 0 * * * *", "want 5 fields"},
+		{"60 * * * *", `minute: "60" is not in 0-59`},
+		{"* 24 * * *", `hour: "24" is not in 0-23`},
+		{"* * 0 * *", `day of month: "0" is not in 1-31`},
+		{"* * * 13 * ", `month: "13" is not in 1-12`},
+		{"* * * * 8", `day of week: "8" is not in 0-7`},
+		{"* * * * monday", `day of week: "monday" is not in 0-7`},
+		{"17-5 * * * *", `range "17-5" runs backwards`},
+		{"*/0 * * * *", `invalid step "0"`},
+		{"*/x * * * *", `invalid step "x"`},
+		{"1-/2 * * * *", `"" is not in 0-59`},
+		{"1,,2 * * * *", `"" is not in 0-59`},
+		{"@every 30s", "@every needs a duration of at least 1m"},
+		{"@every soon", "@every needs a duration of at least 1m"},
+		{"@weekdays", "want 5 fields"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := parseSchedule(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want one with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// A Friday afternoon.
+	from := time.Date(2024, time.March, 1, 16, 20, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"30 6 * * mon-fri", time.Date(2024, time.March, 4, 6, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.March, 1, 16, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// With both day fields restricted, either runs, as in cron.
+		{"0 12 15 * sun", time.Date(2024, time.March, 3, 12, 0, 0, 0, time.UTC)},
+		{"@every 6h", time.Date(2024, time.March, 1, 22, 20, 30, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.next(from); !got.Equal(tt.want) {
+				t.Errorf("next run %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+)
+
+// dataSource is anything daily counts can be read from: a file, an API, or
+// a mix of the two.
+type dataSource interface {
+	Fetch(ctx context.Context) ([]DailyTweet, error)
+}
+
+// titledSource is a source that names the data it read, such as a plugin.
+// Its title, when not empty, replaces the default of its kind.
+type titledSource interface {
+	dataSource
+	sourceTitle() string
+}
+
+// sourceFunc adapts a function to dataSource.
+type sourceFunc func(ctx context.Context) ([]DailyTweet, error)
+
+func (f sourceFunc) Fetch(ctx context.Context) ([]DailyTweet, error) { return f(ctx) }
+
+// sourceKind is a kind of source -source selects. open makes the source of
+// an input file, which may be empty, and the source options, failing when
+// the kind cannot read what it was given.
+type sourceKind struct {
+	name  string
+	title string // default title of its heatmaps
+	open  func(input string, opts sourceOptions) (dataSource, error)
+}
+
+// sourceKinds is the registry of sources, in the order -help lists them.
+// Adding a source means adding it here.
+var sourceKinds = []sourceKind{
+	{"csv", "Tweet Activity Heatmap", fileOnly("csv source requires an input file", readCSVInput)},
+	{"toggl", "Time Tracked (minutes)", fileOrAPI(readTimeTrackingCSV, "TOGGL_API_TOKEN", fetchToggl)},
+	{"clockify", "Time Tracked (minutes)", fileOrAPI(readTimeTrackingCSV, "CLOCKIFY_API_KEY", fetchClockify)},
+	{"wakatime", "Coding Time (minutes)", fileOrAPI(readWakaTimeExport, "WAKATIME_API_KEY", fetchWakaTime)},
+	{"lastfm", "Scrobbles", apiOnly("lastfm source reads from the API; omit the input file", "LASTFM_API_KEY", fetchLastfm)},
+	{"anki", "Anki Reviews", fileOnly("anki source requires a collection file or exported package", readAnkiInput)},
+	{"todoist", "Completed Tasks", fileOrAPI(readTodoistCSV, "TODOIST_API_TOKEN", fetchTodoist)},
+	{"steam", "Playtime (minutes)", openSteam},
+}
+
+// findSource returns the registered source of the given name, or else the
+// heatmap-source-NAME plugin.
+func findSource(name string) (sourceKind, bool) {
+	for _, kind := range sourceKinds {
+		if kind.name == name {
+			return kind, true
+		}
+	}
+	if path, ok := findPlugin("source", name); ok {
+		return sourceKind{name, "Activity Heatmap", openPluginSource(path)}, true
+	}
+	return sourceKind{}, false
+}
+
+func sourceNames() []string {
+	names := make([]string, len(sourceKinds))
+	for i, kind := range sourceKinds {
+		names[i] = kind.name
+	}
+	return names
+}
+
+// fileReader reads an input file; apiFetcher reads an API with the
+// credential taken from the environment, giving up when ctx ends.
+type (
+	fileReader func(input string, opts sourceOptions) ([]DailyTweet, error)
+	apiFetcher func(ctx context.Context, credential string, opts sourceOptions) ([]DailyTweet, error)
+)
+
+// fileOnly opens sources that read an input file and nothing else.
+func fileOnly(missing string, read fileReader) func(string, sourceOptions) (dataSource, error) {
+	return func(input string, opts sourceOptions) (dataSource, error) {
+		if input == "" {
+			return nil, errorf("%s", missing)
+		}
+		return sourceFunc(func(ctx context.Context) ([]DailyTweet, error) {
+			return read(input, opts)
+		}), nil
+	}
+}
+
+// apiOnly opens sources that read an API and take no input file.
+func apiOnly(given string, env string, fetch apiFetcher) func(string, sourceOptions) (dataSource, error) {
+	return func(input string, opts sourceOptions) (dataSource, error) {
+		if input != "" {
+			return nil, errorf("%s", given)
+		}
+		return sourceFunc(func(ctx context.Context) ([]DailyTweet, error) {
+			return fetch(ctx, os.Getenv(env), opts)
+		}), nil
+	}
+}
+
+// fileOrAPI opens sources that read an export file when given one and
+// fall back to their API.
+func fileOrAPI(read fileReader, env string, fetch apiFetcher) func(string, sourceOptions) (dataSource, error) {
+	return func(input string, opts sourceOptions) (dataSource, error) {
+		if input != "" {
+			return fileOnly("", read)(input, opts)
+		}
+		return apiOnly("", env, fetch)(input, opts)
+	}
+}
+
+func readCSVInput(input string, opts sourceOptions) ([]DailyTweet, error) {
+	return readCSV(input, opts.Column, opts.Limits)
+}
+
+func readAnkiInput(input string, opts sourceOptions) ([]DailyTweet, error) {
+	return readAnkiRevlog(input, opts.Limits)
+}
+
+// openSteam opens the steam source, whose input file, if any, is the
+// playtime state file.
+func openSteam(input string, opts sourceOptions) (dataSource, error) {
+	return sourceFunc(func(ctx context.Context) ([]DailyTweet, error) {
+		return loadSteamPlaytime(ctx, os.Getenv("STEAM_API_KEY"), opts, input)
+	}), nil
+}
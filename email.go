@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// emailFlags are the SMTP settings of -email-to.
+type emailFlags struct {
+	to      string
+	from    string
+	subject string
+	smtp    string
+	user    string
+}
+
+func addEmailFlags(fs *flag.FlagSet) *emailFlags {
+	e := &emailFlags{}
+	fs.StringVar(&e.to, "email-to", "", "email the image with a summary to these comma-separated addresses")
+	fs.StringVar(&e.from, "email-from", "", "sender address of emails (default -smtp-user)")
+	fs.StringVar(&e.subject, "email-subject", "", "subject of emails (default the title)")
+	fs.StringVar(&e.smtp, "smtp", "localhost:25", "SMTP server as host:port; port 465 uses implicit TLS, others STARTTLS when offered")
+	fs.StringVar(&e.user, "smtp-user", "", "SMTP user name (password in $SMTP_PASSWORD)")
+	return e
+}
+
+// recipients parses the -email-to addresses.
+func (e *emailFlags) recipients() ([]string, error) {
+	list, err := mail.ParseAddressList(e.to)
+	if err != nil {
+		return nil, usageError(trf("invalid -email-to: %v", err))
+	}
+	addrs := make([]string, len(list))
+	for i, a := range list {
+		addrs[i] = a.Address
+	}
+	return addrs, nil
+}
+
+// sender parses the -email-from address, which defaults to -smtp-user.
+func (e *emailFlags) sender() (*mail.Address, error) {
+	from := e.from
+	if from == "" {
+		from = e.user
+	}
+	if from == "" {
+		return nil, usageError(tr("-email-from or -smtp-user is required to send email"))
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, usageError(trf("invalid -email-from: %v", err))
+	}
+	return addr, nil
+}
+
+// sendEmail sends the image inline in an HTML message with a plain-text
+// alternative.
+func (e *emailFlags) sendEmail(n notification) error {
+	to, err := e.recipients()
+	if err != nil {
+		return err
+	}
+	from, err := e.sender()
+	if err != nil {
+		return err
+	}
+	subject := e.subject
+	if subject == "" {
+		subject = n.title
+	}
+
+	msg, err := buildEmail(from, to, subject, n)
+	if err != nil {
+		return err
+	}
+
+	host, port, err := net.SplitHostPort(e.smtp)
+	if err != nil {
+		return usageError(trf("invalid -smtp: %v", err))
+	}
+	var auth smtp.Auth
+	if e.user != "" {
+		auth = smtp.PlainAuth("", e.user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	if port != "465" {
+		// SendMail upgrades to TLS when the server offers STARTTLS.
+		return smtp.SendMail(e.smtp, auth, from.Address, to, msg)
+	}
+
+	conn, err := tls.Dial("tcp", e.smtp, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildEmail assembles the message: multipart/alternative of the plain
+// text and a multipart/related HTML part that shows the image by
+// Content-ID.
+func buildEmail(from *mail.Address, to []string, subject string, n notification) ([]byte, error) {
+	if len(to) == 0 {
+		return nil, errors.New(tr("no recipients"))
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+
+	alt := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", alt.Boundary())
+
+	text, err := alt.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(text, []byte(n.text()))
+
+	var related bytes.Buffer
+	rel := multipart.NewWriter(&related)
+	relPart, err := alt.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/related; boundary=" + rel.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	title, rest, _ := strings.Cut(n.text(), "\n")
+	body := fmt.Sprintf(`<html><body><h2>%s</h2><p>%s</p><img src="cid:heatmap" alt="%s"></body></html>`,
+		html.EscapeString(title), strings.ReplaceAll(html.EscapeString(rest), "\n", "<br>"), html.EscapeString(n.title))
+	htmlPart, err := rel.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(htmlPart, []byte(body))
+
+	image, err := rel.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {n.contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-ID":                {"<heatmap>"},
+		"Content-Disposition":       {fmt.Sprintf(`inline; filename="%s"`, n.filename)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(image, n.data)
+	if err := rel.Close(); err != nil {
+		return nil, err
+	}
+	relPart.Write(related.Bytes())
+
+	if err := alt.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// writeBase64 writes data base64-encoded in lines of 76 characters, as
+// MIME requires.
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		fmt.Fprintf(w, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(w, "%s\r\n", encoded)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Exit codes, so scripts can tell kinds of failure apart.
+const (
+	exitFailure = 1 // anything not covered below
+	exitUsage   = 2 // bad flags or arguments
+	exitInput   = 3 // input missing or unreadable, or no data
+	exitParse   = 4 // input read but malformed
+	exitRender  = 5 // drawing or writing the output failed
+	exitPublish = 6 // uploading or sending the output failed
+)
+
+// exitError attaches an exit code and a kind, used in JSON error reports,
+// to an error.
+type exitError struct {
+	kind string
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func withExitCode(err error, kind string, code int) error {
+	if err == nil {
+		return nil
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return err
+	}
+	return &exitError{kind: kind, code: code, err: err}
+}
+
+func inputError(err error) error   { return withExitCode(err, "input", exitInput) }
+func parseError(err error) error   { return withExitCode(err, "parse", exitParse) }
+func renderError(err error) error  { return withExitCode(err, "render", exitRender) }
+func publishError(err error) error { return withExitCode(err, "publish", exitPublish) }
+
+// malformedf formats an error describing malformed input.
+func malformedf(format string, args ...interface{}) error {
+	return parseError(errorf(format, args...))
+}
+
+// classifyLoadError marks an error from reading a source as a parse error
+// when it stems from malformed content, and as an input error otherwise.
+func classifyLoadError(err error) error {
+	err = trOpenError(err)
+	var (
+		csvErr     *csv.ParseError
+		numErr     *strconv.NumError
+		timeErr    *time.ParseError
+		syntaxErr  *json.SyntaxError
+		jsonTypErr *json.UnmarshalTypeError
+	)
+	if errors.As(err, &csvErr) || errors.As(err, &numErr) || errors.As(err, &timeErr) ||
+		errors.As(err, &syntaxErr) || errors.As(err, &jsonTypErr) {
+		return parseError(err)
+	}
+	return inputError(err)
+}
+
+// translatedError is an error of another package with its message
+// translated. It unwraps to the error it translates.
+type translatedError struct {
+	message string
+	err     error
+}
+
+func (e *translatedError) Error() string { return e.message }
+func (e *translatedError) Unwrap() error { return e.err }
+
+// trOpenError translates the errors of opening a file that inputs meet
+// most, which the os package makes in English, from their fields.
+func trOpenError(err error) error {
+	var pe *fs.PathError
+	if !errors.As(err, &pe) || error(pe) != err || pe.Op != "open" {
+		return err
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return &translatedError{trf("open %s: no such file or directory", pe.Path), err}
+	case errors.Is(err, fs.ErrPermission):
+		return &translatedError{trf("open %s: permission denied", pe.Path), err}
+	}
+	return err
+}
+
+// reportError prints err for the command name in the format chosen with
+// -error-format and returns the exit code to use.
+func reportError(name string, err error) int {
+	kind, code := "error", exitFailure
+	var ue usageError
+	var ee *exitError
+	switch {
+	case errors.As(err, &ue):
+		kind, code = "usage", exitUsage
+	case errors.As(err, &ee):
+		kind, code = ee.kind, ee.code
+	}
+
+	if logging.errorFormat == "json" {
+		json.NewEncoder(os.Stderr).Encode(struct {
+			Command  string `json:"command"`
+			Kind     string `json:"kind"`
+			ExitCode int    `json:"exit_code"`
+			Error    string `json:"error"`
+		}{name, kind, code, err.Error()})
+	} else if inGitHubActions() {
+		// A workflow command turns the error into an annotation of the run.
+		fmt.Fprintf(os.Stderr, "::error title=heatmap %s::%s\n", name, githubEscape(err.Error()))
+	} else {
+		fmt.Fprintf(os.Stderr, "heatmap %s: %s\n", name, err)
+	}
+	return code
+}
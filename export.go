@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+)
+
+// gridExport is the layout -export-json writes: the size of the image, the
+// legend of the scale and every cell where the image draws it, so other
+// tools can place their own pictures on the same grid.
+type gridExport struct {
+	Title  string         `json:"title"`
+	Width  int            `json:"width"`
+	Height int            `json:"height"`
+	Legend []exportBucket `json:"legend"`
+	Cells  []exportCell   `json:"cells"`
+}
+
+// exportBucket is a color of the scale and the counts it stands for.
+type exportBucket struct {
+	Color string `json:"color"`
+	Label string `json:"label"`
+}
+
+// exportCell is a cell of the grid: a day, by its date, or what else the
+// layout counts, by its label. Bucket is the index of its color in the
+// legend, or -1 when something else colors it, such as a forecast or a
+// category.
+type exportCell struct {
+	Date   string     `json:"date,omitempty"`
+	Label  string     `json:"label,omitempty"`
+	Value  int        `json:"value"`
+	Bucket int        `json:"bucket"`
+	Color  string     `json:"color"`
+	Rect   exportRect `json:"rect"`
+}
+
+// exportRect is a rectangle of pixels from the top left of the image; for
+// the sectors of polar layouts, the box around them.
+type exportRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// exportGrid returns the layout of the heatmap of tweets as JSON.
+func exportGrid(tweets []DailyTweet, opts renderOptions) ([]byte, error) {
+	hm := newHeatmap(tweets, opts)
+	l, err := arrange(hm, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := gridExport{Title: opts.Title, Width: l.width, Height: l.height, Legend: []exportBucket{}, Cells: []exportCell{}}
+	buckets := make(map[color.RGBA]int)
+	for i, entry := range hm.scale.legendEntries() {
+		out.Legend = append(out.Legend, exportBucket{hexColor(entry.color), entry.label})
+		if _, ok := buckets[entry.color]; !ok {
+			buckets[entry.color] = i
+		}
+	}
+	add := func(c layoutCell) {
+		bucket, ok := buckets[c.color]
+		if !ok {
+			bucket = -1
+		}
+		cell := exportCell{Label: c.label, Value: c.count, Bucket: bucket, Color: hexColor(c.color), Rect: exportRectOf(c.rect)}
+		if c.label == "" {
+			cell.Date = c.date.Format("2006-01-02")
+		}
+		out.Cells = append(out.Cells, cell)
+	}
+	for _, c := range l.cells {
+		add(c)
+	}
+	for _, s := range l.sectors {
+		if !s.date.IsZero() || s.label != "" {
+			add(s.layoutCell)
+		}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func exportRectOf(r image.Rectangle) exportRect {
+	return exportRect{r.Min.X, r.Min.Y, r.Dx(), r.Dy()}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// errBadFlags is returned by commands whose flags failed to parse. The flag
+// package has already reported the problem by then.
+var errBadFlags = errors.New("invalid flags")
+
+// usageError reports a mistake in how a command was invoked, as opposed to
+// a failure while carrying it out.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// newFlagSet creates the flag set for a subcommand. argsUsage describes the
+// positional arguments in the usage line.
+func newFlagSet(name, argsUsage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	addLogFlags(fs)
+	addProfileFlags(fs)
+	addLocaleFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), tr("Usage: heatmap %s [flags] %s\n\nFlags:\n"), name, argsUsage)
+		fs.VisitAll(func(f *flag.Flag) { f.Usage = tr(f.Usage) })
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args and fills in flags not given on the command line
+// from HEATMAP_ environment variables and then, for commands with a -config
+// flag, from the config file. It then sets up logging and profiling as the
+// flags ask.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errBadFlags
+	}
+	if err := applyEnv(fs); err != nil {
+		return err
+	}
+	if fs.Lookup("config") != nil {
+		if err := applyConfig(fs, fs.Name()); err != nil {
+			return err
+		}
+	}
+	if err := logging.setup(); err != nil {
+		return err
+	}
+	return profiling.start()
+}
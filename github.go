@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// inGitHubActions reports whether the command runs as a GitHub Actions step.
+func inGitHubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// reportGitHub publishes the result of generate to the workflow: the image
+// path, its shared URL if any, and statistics as step outputs, and a
+// Markdown table in the job summary. Files the runner does not provide are
+// skipped.
+func reportGitHub(output, sharedURL string, tweets []DailyTweet) error {
+	sum := summarize(tweets)
+
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		outputs := stepOutput("path", output) +
+			stepOutput("from", sum.from.Format("2006-01-02")) +
+			stepOutput("to", sum.to.Format("2006-01-02")) +
+			stepOutput("total", strconv.Itoa(sum.total)) +
+			stepOutput("active-days", strconv.Itoa(sum.active)) +
+			stepOutput("best-day", sum.best.Date.Format("2006-01-02")) +
+			stepOutput("best-count", strconv.Itoa(sum.best.Count))
+		if sharedURL != "" {
+			outputs += stepOutput("url", sharedURL)
+		}
+		if err := appendFile(path, outputs); err != nil {
+			return errorf("writing step outputs: %w", err)
+		}
+	}
+
+	if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+		var b strings.Builder
+		fmt.Fprintf(&b, "### Heatmap\n\n")
+		fmt.Fprintf(&b, "Rendered `%s`.\n\n", output)
+		if sharedURL != "" {
+			fmt.Fprintf(&b, "![heatmap](%s)\n\n", sharedURL)
+		}
+		fmt.Fprintf(&b, "| | |\n| --- | --- |\n")
+		fmt.Fprintf(&b, "| Range | %s to %s |\n", sum.from.Format("2006-01-02"), sum.to.Format("2006-01-02"))
+		fmt.Fprintf(&b, "| Total | %d |\n", sum.total)
+		fmt.Fprintf(&b, "| Active days | %d |\n", sum.active)
+		fmt.Fprintf(&b, "| Best day | %s (%d) |\n\n", sum.best.Date.Format("2006-01-02"), sum.best.Count)
+		if err := appendFile(path, b.String()); err != nil {
+			return errorf("writing job summary: %w", err)
+		}
+	}
+	return nil
+}
+
+// stepOutput formats a step output for $GITHUB_OUTPUT: name=value, or,
+// for a value of several lines, which would start outputs of its own, the
+// value between lines of a random delimiter, as the Actions toolkit writes
+// it.
+func stepOutput(name, value string) string {
+	if !strings.ContainsAny(value, "\r\n") {
+		return name + "=" + value + "\n"
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	delimiter := "ghadelimiter_" + hex.EncodeToString(b[:])
+	return fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
+}
+
+func appendFile(path, text string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// githubEscape escapes a message for a workflow command such as ::error::.
+func githubEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
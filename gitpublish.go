@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultGitMessage is the commit message template of -git-repo.
+const defaultGitMessage = "Update heatmap ({{.To}}: {{.Total}} total)"
+
+// gitFlags are the flags that commit the image to a Git repository, such
+// as the one behind a GitHub profile README.
+type gitFlags struct {
+	repo    string
+	branch  string
+	path    string
+	message string
+}
+
+func addGitFlags(fs *flag.FlagSet) *gitFlags {
+	g := &gitFlags{}
+	fs.StringVar(&g.repo, "git-repo", "", "commit the image to this Git repository URL or path and push it (HTTPS uses $GIT_TOKEN, or $GITHUB_TOKEN on github.com)")
+	fs.StringVar(&g.branch, "git-branch", "", "branch to commit to (default the repository's default branch)")
+	fs.StringVar(&g.path, "git-path", "", "path of the image in the repository (default the output file name)")
+	fs.StringVar(&g.message, "git-message", defaultGitMessage, "Go template of the commit message, with the fields of -caption")
+	return g
+}
+
+func (g *gitFlags) check() error {
+	if g.repo == "" {
+		return nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return usageError(tr("-git-repo needs the git command"))
+	}
+	_, err := parseTemplate("git-message", g.message)
+	return err
+}
+
+// commit clones the repository shallowly, replaces the image and pushes a
+// commit when the image changed. The author is taken from GIT_AUTHOR_NAME
+// and GIT_AUTHOR_EMAIL, defaulting to a bot identity.
+func (g *gitFlags) commit(output string, data []byte, caption captionData) error {
+	tmpl, err := parseTemplate("git-message", g.message)
+	if err != nil {
+		return err
+	}
+	var message strings.Builder
+	if err := tmpl.Execute(&message, caption); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "heatmap-git-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	clone := []string{"clone", "--quiet", "--depth", "1"}
+	if g.branch != "" {
+		clone = append(clone, "--branch", g.branch)
+	}
+	if err := g.git("", append(clone, "--", g.repo, dir)...); err != nil {
+		return err
+	}
+
+	name := g.path
+	if name == "" {
+		name = filepath.Base(output)
+	}
+	// Cleaning the path as if rooted keeps it inside the clone.
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(target, data, 0o644); err != nil {
+		return err
+	}
+
+	if err := g.git(dir, "add", "--", target); err != nil {
+		return err
+	}
+	// diff --quiet succeeds when nothing is staged.
+	if err := g.git(dir, "diff", "--cached", "--quiet"); err == nil {
+		slog.Info("image unchanged, nothing to commit", "repo", redactURL(g.repo))
+		return nil
+	}
+
+	author, email := os.Getenv("GIT_AUTHOR_NAME"), os.Getenv("GIT_AUTHOR_EMAIL")
+	if author == "" {
+		author = "heatmap-generator"
+	}
+	if email == "" {
+		email = "heatmap-generator@users.noreply.github.com"
+	}
+	if err := g.git(dir, "-c", "user.name="+author, "-c", "user.email="+email, "commit", "--quiet", "-m", message.String()); err != nil {
+		return err
+	}
+	if err := g.git(dir, "push", "--quiet", "origin", "HEAD"); err != nil {
+		return err
+	}
+	slog.Info("image committed", "repo", redactURL(g.repo), "path", name)
+	return nil
+}
+
+// git runs a git command in dir. For HTTPS repositories a token from
+// GIT_TOKEN, or from GITHUB_TOKEN for repositories on github.com, is sent
+// as an extra header. The header reaches git through its environment,
+// which other users cannot read as they can its command line, so it never
+// lands in the process list, the clone's config or error messages.
+func (g *gitFlags) git(dir string, args ...string) error {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if token := g.token(); token != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+		// Settings already in the environment keep their indexes.
+		n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+		env = append(env,
+			"GIT_CONFIG_COUNT="+strconv.Itoa(n+1),
+			"GIT_CONFIG_KEY_"+strconv.Itoa(n)+"=http.extraHeader",
+			"GIT_CONFIG_VALUE_"+strconv.Itoa(n)+"=Authorization: Basic "+credentials)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errorf("git %s: %s", gitSubcommand(args), msg)
+		}
+		return errorf("git %s: %w", gitSubcommand(args), err)
+	}
+	return nil
+}
+
+// token returns the token to authenticate to the repository with, if any:
+// GIT_TOKEN for any HTTPS repository, or GITHUB_TOKEN, which GitHub issues
+// for itself alone, for those on github.com.
+func (g *gitFlags) token() string {
+	u, err := url.Parse(g.repo)
+	if err != nil || u.Scheme != "https" {
+		return ""
+	}
+	if token := os.Getenv("GIT_TOKEN"); token != "" {
+		return token
+	}
+	if strings.EqualFold(u.Hostname(), "github.com") {
+		return os.Getenv("GITHUB_TOKEN")
+	}
+	return ""
+}
+
+// gitSubcommand returns the name of the git command args run, skipping
+// -c options.
+func gitSubcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-c" {
+			i++
+			continue
+		}
+		return args[i]
+	}
+	return ""
+}
+
+// redactURL drops the user information, which may hold a password, from a
+// repository URL.
+func redactURL(repo string) string {
+	if i := strings.Index(repo, "://"); i >= 0 {
+		if at := strings.Index(repo[i+3:], "@"); at >= 0 {
+			return repo[:i+3] + repo[i+3+at+1:]
+		}
+	}
+	return repo
+}
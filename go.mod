@@ -2,4 +2,13 @@ module heatmap-generator
 
 go 1.22.5
 
-require golang.org/x/image v0.20.0
+require (
+	github.com/BurntSushi/toml v1.6.0
+	golang.org/x/crypto v0.31.0
+	golang.org/x/image v0.20.0
+)
+
+require (
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Grafana's image panels ask for an image of a panel with the time range
+// of the dashboard, as ${__from} and ${__to}, in epoch milliseconds, with
+// its zone as tz, and the size of the panel as width and height. serve
+// takes those as they come: from and to in milliseconds become the days
+// they fall on in tz, and width and height choose the largest cell that
+// fits the image in them.
+
+// maxPanelSize bounds the width and height query parameters.
+const maxPanelSize = 8192
+
+// isEpochMillis reports whether s is a time in epoch milliseconds rather
+// than a YYYY-MM-DD date.
+func isEpochMillis(s string) bool {
+	if len(s) <= len("20060102") {
+		return false
+	}
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+// grafanaRange returns from and to as YYYY-MM-DD dates when they are epoch
+// milliseconds, the days they fall on in the zone tz names: an IANA zone
+// such as Asia/Tokyo, or UTC when empty or browser, which the server cannot
+// know. Since the grid always spans a year, a range with both ends keeps
+// the day of to, where the dashboard's range ends.
+func grafanaRange(from, to, tz string) (string, string, error) {
+	if !isEpochMillis(from) && !isEpochMillis(to) {
+		return from, to, nil
+	}
+	zone := time.UTC
+	if tz != "" && tz != "browser" {
+		var err error
+		if zone, err = time.LoadLocation(tz); err != nil {
+			return "", "", errorf("unknown time zone %q", tz)
+		}
+	}
+	date := func(s string) string {
+		if !isEpochMillis(s) {
+			return s
+		}
+		ms, _ := strconv.ParseInt(s, 10, 64)
+		return time.UnixMilli(ms).In(zone).Format("2006-01-02")
+	}
+	from, to = date(from), date(to)
+	if from != "" && to != "" {
+		from = ""
+	}
+	return from, to, nil
+}
+
+// parsePanelSize parses the width or height query parameter, returning
+// zero for none.
+func parsePanelSize(name, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxPanelSize {
+		return 0, errorf("%s must be a number of pixels from 1 to %d", name, maxPanelSize)
+	}
+	return n, nil
+}
+
+// fitPanel sets the cell size of opts to the largest whose image of tweets
+// fits in width by height pixels, either of them empty for no bound, or
+// the smallest when none fits.
+func fitPanel(tweets []DailyTweet, opts renderOptions, widthParam, heightParam string) (renderOptions, error) {
+	if opts.Card {
+		return renderOptions{}, errors.New(tr("social cards are 1200x630; width and height do not apply"))
+	}
+	width, err := parsePanelSize("width", widthParam)
+	if err != nil {
+		return renderOptions{}, err
+	}
+	height, err := parsePanelSize("height", heightParam)
+	if err != nil {
+		return renderOptions{}, err
+	}
+	hm := newHeatmap(tweets, opts)
+	fits := func(cell int) bool {
+		sized := opts
+		sized.CellSize = cell
+		l, err := arrange(hm, sized)
+		return err == nil && (width == 0 || l.width <= width) && (height == 0 || l.height <= height)
+	}
+	// Images grow with their cells, so the cells that fit come first.
+	n := sort.Search(maxCellSize-minCellSize+1, func(i int) bool { return !fits(minCellSize + i) })
+	opts.CellSize = minCellSize + max(n-1, 0)
+	return opts, nil
+}
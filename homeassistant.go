@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Home Assistant shows the heatmap on a dashboard either as an entity set
+// through its REST API, whose entity_picture a picture entity card draws
+// when the image has a public URL, or as an MQTT camera that MQTT discovery creates. Both carry the summary
+// as attributes, and the daemon refreshes them on its schedule.
+
+// hassDiscoveryPrefix is the topic prefix Home Assistant's MQTT discovery
+// listens on by default.
+const hassDiscoveryPrefix = "homeassistant"
+
+// hassFlags are the flags that send the finished heatmap to Home Assistant.
+type hassFlags struct {
+	url       string
+	entity    string
+	mqtt      string
+	mqttUser  string
+	mqttTopic string
+}
+
+func addHassFlags(fs *flag.FlagSet) *hassFlags {
+	h := &hassFlags{}
+	fs.StringVar(&h.url, "hass-url", "", "set a Home Assistant entity to the total, with the summary as attributes and the image at -image-url as its picture, through the REST API at this URL, e.g. http://homeassistant.local:8123 (needs a long-lived access token in $HASS_TOKEN)")
+	fs.StringVar(&h.entity, "hass-entity", "sensor.heatmap", "entity ID -hass-url sets")
+	fs.StringVar(&h.mqtt, "mqtt", "", "publish the PNG image and the summary, retained, to this MQTT broker as mqtt://host:port or mqtts://host:port, announced to Home Assistant's MQTT discovery as a camera")
+	fs.StringVar(&h.mqttUser, "mqtt-user", "", "MQTT user name (password in $MQTT_PASSWORD)")
+	fs.StringVar(&h.mqttTopic, "mqtt-topic", "heatmap", "topic -mqtt publishes under: the image to TOPIC/image and the summary to TOPIC/attributes")
+	return h
+}
+
+// hassEntityID matches Home Assistant entity IDs, a domain and an object
+// ID.
+var hassEntityID = regexp.MustCompile(`^[a-z0-9_]+\.[a-z0-9_]+$`)
+
+// check reports mistakes in the flags before anything is rendered in
+// format.
+func (h *hassFlags) check(format string) error {
+	if h.url != "" {
+		if u, err := url.Parse(h.url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return usageError(trf("invalid -hass-url %q: need an http or https URL", h.url))
+		}
+		if !hassEntityID.MatchString(h.entity) {
+			return usageError(trf("invalid -hass-entity %q: need an entity ID such as sensor.heatmap", h.entity))
+		}
+	}
+	if h.mqtt != "" {
+		if _, err := parseBroker(h.mqtt); err != nil {
+			return usageError(trf("invalid -mqtt: %v", err))
+		}
+		if h.mqttTopic == "" || strings.ContainsAny(h.mqttTopic, "#+") {
+			return usageError(tr("-mqtt-topic must be a topic without wildcards"))
+		}
+		if format != "png" {
+			return usageError(tr("Home Assistant's MQTT camera shows PNG images; -mqtt needs -format png"))
+		}
+	}
+	return nil
+}
+
+func (h *hassFlags) enabled() bool {
+	return h.url != "" || h.mqtt != ""
+}
+
+// send delivers the notification to Home Assistant as the flags ask.
+func (h *hassFlags) send(n notification, caption captionData) error {
+	attributes := hassAttributes(caption)
+	if h.url != "" {
+		if err := h.setState(n, caption.Total, attributes); err != nil {
+			return publishError(errorf("updating Home Assistant: %w", err))
+		}
+		slog.Info("updated Home Assistant", "entity", h.entity)
+	}
+	if h.mqtt != "" {
+		if err := h.publishMQTT(n, attributes); err != nil {
+			return publishError(errorf("publishing to MQTT: %w", err))
+		}
+		slog.Info("published to MQTT", "topic", h.mqttTopic)
+	}
+	return nil
+}
+
+// hassAttributes returns the summary as entity attributes, named as Home
+// Assistant names them.
+func hassAttributes(c captionData) map[string]any {
+	return map[string]any{
+		"friendly_name":  c.Title,
+		"from":           c.From,
+		"to":             c.To,
+		"total":          c.Total,
+		"active_days":    c.ActiveDays,
+		"best_day":       c.BestDay,
+		"best_count":     c.BestCount,
+		"longest_streak": c.LongestStreak,
+		"current_streak": c.CurrentStreak,
+	}
+}
+
+// setState sets the entity of -hass-entity to the total, with the image at
+// its public URL, if it has one, as its picture. Home Assistant keeps the
+// attributes of every state in its database, too much for the image itself.
+func (h *hassFlags) setState(n notification, total int, attributes map[string]any) error {
+	token := os.Getenv("HASS_TOKEN")
+	if token == "" {
+		return errors.New(tr("HASS_TOKEN must be set"))
+	}
+	withPicture := map[string]any{}
+	for name, value := range attributes {
+		withPicture[name] = value
+	}
+	if n.imageURL != "" {
+		withPicture["entity_picture"] = n.imageURL
+	}
+	body, err := json.Marshal(map[string]any{"state": strconv.Itoa(total), "attributes": withPicture})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(h.url, "/")+"/api/states/"+h.entity, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	return send(req)
+}
+
+// publishMQTT publishes the discovery config of a camera showing the image,
+// then the attributes and the image, all retained so Home Assistant finds
+// them when it restarts.
+func (h *hassFlags) publishMQTT(n notification, attributes map[string]any) error {
+	objectID := hassObjectID(h.mqttTopic)
+	config, err := json.Marshal(map[string]any{
+		"name":                  n.title,
+		"unique_id":             "heatmap_generator_" + objectID,
+		"topic":                 h.mqttTopic + "/image",
+		"json_attributes_topic": h.mqttTopic + "/attributes",
+	})
+	if err != nil {
+		return err
+	}
+	state, err := json.Marshal(attributes)
+	if err != nil {
+		return err
+	}
+	c, err := dialMQTT(h.mqtt, h.mqttUser, os.Getenv("MQTT_PASSWORD"))
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	for _, m := range []struct {
+		topic   string
+		payload []byte
+	}{
+		{hassDiscoveryPrefix + "/camera/" + objectID + "/config", config},
+		{h.mqttTopic + "/attributes", state},
+		{h.mqttTopic + "/image", n.data},
+	} {
+		if err := c.publish(m.topic, m.payload, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hassObjectIDRunes matches what object IDs cannot hold.
+var hassObjectIDRunes = regexp.MustCompile(`[^a-z0-9]+`)
+
+// hassObjectID turns topic into an object ID of letters, digits and
+// underscores.
+func hassObjectID(topic string) string {
+	return strings.Trim(hassObjectIDRunes.ReplaceAllString(strings.ToLower(topic), "_"), "_")
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Messages are written in English and translated through catalogs: TOML
+// files of locales/, one a language, each mapping an English message to its
+// translation. Messages with fmt verbs are keyed by their format and
+// translated as they are formatted, by trf, errorf and printf, and a
+// translation may reorder the arguments with explicit indexes, as in %[2]s.
+// What a catalog lacks stays English.
+//
+//go:embed locales/*.toml
+var localeFiles embed.FS
+
+const defaultLocale = "en"
+
+var (
+	catalogsOnce sync.Once
+	catalogs     map[string]catalog
+	// locale is the language of messages: that of -locale, else that of
+	// the environment.
+	locale = localeFromEnv()
+)
+
+// catalog is the translations of one language.
+type catalog struct {
+	messages map[string]string
+}
+
+func loadCatalogs() {
+	catalogs = map[string]catalog{defaultLocale: {}}
+	files, _ := fs.Glob(localeFiles, "locales/*.toml")
+	for _, file := range files {
+		data, _ := localeFiles.ReadFile(file)
+		var messages map[string]string
+		if _, err := toml.Decode(string(data), &messages); err != nil {
+			panic(fmt.Sprintf("%s: %v", file, err))
+		}
+		catalogs[strings.TrimSuffix(path.Base(file), ".toml")] = catalog{messages: messages}
+	}
+}
+
+// localeNames returns the languages there are messages in.
+func localeNames() []string {
+	catalogsOnce.Do(loadCatalogs)
+	names := make([]string, 0, len(catalogs))
+	for name := range catalogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseLocale returns the language of a locale name such as ja, ja_JP or
+// ja_JP.UTF-8, and whether there are messages in it. C and POSIX are
+// English.
+func parseLocale(name string) (string, bool) {
+	lang := strings.ToLower(name)
+	if i := strings.IndexAny(lang, "_-.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if lang == "c" || lang == "posix" {
+		lang = defaultLocale
+	}
+	catalogsOnce.Do(loadCatalogs)
+	_, ok := catalogs[lang]
+	return lang, ok
+}
+
+// localeFromEnv returns the language of the first of LC_ALL, LC_MESSAGES
+// and LANG that is set, as POSIX orders them, or English when it has no
+// messages.
+func localeFromEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			if lang, ok := parseLocale(value); ok {
+				return lang
+			}
+			break
+		}
+	}
+	return defaultLocale
+}
+
+// localeFlag is -locale, which sets the language of messages.
+type localeFlag struct{}
+
+func (localeFlag) String() string { return "" }
+
+func (localeFlag) Set(name string) error {
+	lang, ok := parseLocale(name)
+	if !ok {
+		return errorf("no messages in %q (available: %s)", name, strings.Join(localeNames(), ", "))
+	}
+	locale = lang
+	return nil
+}
+
+func addLocaleFlag(fs *flag.FlagSet) {
+	fs.Var(localeFlag{}, "locale", trf("language of messages: %s (default from LC_ALL, LC_MESSAGES or LANG)", strings.Join(localeNames(), ", ")))
+}
+
+// tr returns the translation of message, or message when there is none.
+func tr(message string) string {
+	catalogsOnce.Do(loadCatalogs)
+	if t, ok := catalogs[locale].messages[message]; ok {
+		return t
+	}
+	return message
+}
+
+// trf formats the translation of format with args, as fmt.Sprintf does.
+func trf(format string, args ...interface{}) string {
+	if t := tr(format); t != format {
+		return fmt.Sprintf(t, args...)
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// trn formats the translation of one when n is 1 and of other otherwise,
+// as trf does. The English forms key the catalogs, so a language that
+// counts without plurals translates both alike.
+func trn(one, other string, n int, args ...interface{}) string {
+	return trf(plural(n, one, other), args...)
+}
+
+// plural returns one when n is 1 and other otherwise, for counts in output
+// that stays English.
+func plural(n int, one, other string) string {
+	if n == 1 {
+		return one
+	}
+	return other
+}
+
+// errorf is fmt.Errorf with the translation of format, so errors are
+// translated as they are made, from the format they are written with.
+func errorf(format string, args ...interface{}) error {
+	if t := tr(format); t != format {
+		return fmt.Errorf(t, args...)
+	}
+	return fmt.Errorf(format, args...)
+}
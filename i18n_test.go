@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// withCatalog translates messages through the given catalog, as if it were
+// the language of the locale, until the test ends.
+func withCatalog(t *testing.T, messages map[string]string) {
+	t.Helper()
+	catalogsOnce.Do(loadCatalogs)
+	catalogs["xx"] = catalog{messages: messages}
+	previous := locale
+	locale = "xx"
+	t.Cleanup(func() {
+		locale = previous
+		delete(catalogs, "xx")
+	})
+}
+
+func TestTranslatedLabels(t *testing.T) {
+	withCatalog(t, map[string]string{
+		"Total":   "Summe",
+		"Longest": "最長連続",
+		"%d days": "%d Tage",
+		"Sun":     "So",
+		"Jan 2":   "2.1.",
+	})
+	sum := summary{total: 1234, longestStreak: 3, currentStreak: 5}
+	sum.best.Count = 7
+	sum.best.Date = time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	for _, font := range []string{"basic", "go"} {
+		th := theme{Font: font}
+		got := panelLines(sum, th)
+		want := []string{
+			"Summe     1,234",
+			"Per day   0.0",
+			"Best day  7 (1.3.)",
+			// The fonts cannot draw the Japanese, so it stays English.
+			"Longest   3 Tage",
+			"Current   5 Tage",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s font: panel lines %q, want %q", font, got, want)
+		}
+		if got := th.label(weekdayNames[0]); got != "So" {
+			t.Errorf("%s font: Sunday labeled %q, want So", font, got)
+		}
+	}
+}
+
+func TestTranslatedErrors(t *testing.T) {
+	withCatalog(t, map[string]string{
+		"no value column %q in the header %q": "keine Spalte %[1]q in %[2]q",
+	})
+	err := errorf("no value column %q in the header %q", "steps", "date,count")
+	if got, want := err.Error(), `keine Spalte "steps" in "date,count"`; got != want {
+		t.Errorf("error %q, want %q", got, want)
+	}
+	if got, want := trf("unknown format %q", "gif"), `unknown format "gif"`; got != want {
+		t.Errorf("untranslated message %q, want %q", got, want)
+	}
+}
+
+func TestPluralForms(t *testing.T) {
+	withCatalog(t, map[string]string{"%d day": "%d Tag", "%d days": "%d Tage"})
+	for n, want := range map[int]string{0: "0 Tage", 1: "1 Tag", 2: "2 Tage"} {
+		if got := trn("%d day", "%d days", n, n); got != want {
+			t.Errorf("trn with %d: %q, want %q", n, got, want)
+		}
+		if got := streakDays(n, theme{Font: "basic"}); got != want {
+			t.Errorf("streakDays(%d): %q, want %q", n, got, want)
+		}
+	}
+}
+
+// formatArgs returns the verb each argument of a format takes, by position.
+// The space flag is left out, as labels such as "% of max" are no formats.
+func formatArgs(format string) map[int]string {
+	verb := regexp.MustCompile(`%(?:\[(\d+)\])?[-+#0]*\d*(?:\.\d+)?([a-zA-Z%])`)
+	args := map[int]string{}
+	n := 0
+	for _, m := range verb.FindAllStringSubmatch(format, -1) {
+		if m[2] == "%" {
+			continue
+		}
+		if m[1] != "" {
+			n, _ = strconv.Atoi(m[1])
+		} else {
+			n++
+		}
+		args[n] += m[2]
+	}
+	return args
+}
+
+// TestCatalogVerbs checks that every translation formats the arguments of
+// its message with the same verbs, so none goes missing or prints as
+// %!v(MISSING).
+func TestCatalogVerbs(t *testing.T) {
+	catalogsOnce.Do(loadCatalogs)
+	for lang, c := range catalogs {
+		for message, translation := range c.messages {
+			if got, want := formatArgs(translation), formatArgs(message); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %q takes the arguments %v, want %v as in %q", lang, translation, got, want, message)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// imageMap returns an HTML fragment of the heatmap of tweets as the image
+// at src with a <map> over it: an area for each cell, a rectangle or, for
+// the sectors of polar layouts, a polygon, with the date or label and the
+// count in its title and data attributes, for pages to add click and hover
+// behavior to the static image.
+func imageMap(tweets []DailyTweet, opts renderOptions, src string) ([]byte, error) {
+	hm := newHeatmap(tweets, opts)
+	l, err := arrange(hm, opts)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<img src=\"%s\" width=\"%d\" height=\"%d\" alt=\"%s\" usemap=\"#%s\">\n",
+		html.EscapeString(src), l.width, l.height, html.EscapeString(describeHeatmap(hm, opts)), html.EscapeString(name))
+	fmt.Fprintf(&buf, "<map name=\"%s\">\n", html.EscapeString(name))
+	area := func(c layoutCell, shape, coords string) {
+		key, attr := c.name(), "data-label"
+		if c.label == "" {
+			attr = "data-date"
+		}
+		title := html.EscapeString(fmt.Sprintf("%s: %d", key, c.count))
+		fmt.Fprintf(&buf, "  <area shape=\"%s\" coords=\"%s\" alt=\"%s\" title=\"%s\" %s=\"%s\" data-count=\"%d\">\n",
+			shape, coords, title, title, attr, html.EscapeString(key), c.count)
+	}
+	for _, c := range l.cells {
+		r := c.rect
+		area(c, "rect", fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y))
+	}
+	for _, s := range l.sectors {
+		if s.date.IsZero() && s.label == "" {
+			continue // a tick
+		}
+		points := s.path()
+		coords := make([]string, 0, 2*len(points))
+		for _, p := range points {
+			coords = append(coords, fmt.Sprint(int(math.Round(p[0]))), fmt.Sprint(int(math.Round(p[1]))))
+		}
+		area(s.layoutCell, "poly", strings.Join(coords, ","))
+	}
+	buf.WriteString("</map>\n")
+	return buf.Bytes(), nil
+}
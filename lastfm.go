@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type lastfmTrack struct {
+	Date *struct {
+		UTS string `json:"uts"`
+	} `json:"date"`
+}
+
+type lastfmRecentTracks struct {
+	RecentTracks struct {
+		// A page holding a single track returns an object rather than an
+		// array, so decoding is deferred until the shape is known.
+		Track json.RawMessage `json:"track"`
+		Attr  struct {
+			TotalPages string `json:"totalPages"`
+		} `json:"@attr"`
+	} `json:"recenttracks"`
+}
+
+func (r lastfmRecentTracks) tracks() ([]lastfmTrack, error) {
+	raw := r.RecentTracks.Track
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	if raw[0] == '{' {
+		var t lastfmTrack
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, err
+		}
+		return []lastfmTrack{t}, nil
+	}
+	var tracks []lastfmTrack
+	err := json.Unmarshal(raw, &tracks)
+	return tracks, err
+}
+
+// fetchLastfm pages through a user's scrobbles from the past year via the
+// Last.fm API and returns the number of tracks played per day.
+func fetchLastfm(ctx context.Context, apiKey string, opts sourceOptions) ([]DailyTweet, error) {
+	if apiKey == "" {
+		return nil, errorf("lastfm: set LASTFM_API_KEY")
+	}
+	if opts.User == "" {
+		return nil, errorf("lastfm: -user is required")
+	}
+
+	from, end := lastYear()
+	query := url.Values{}
+	query.Set("method", "user.getrecenttracks")
+	query.Set("user", opts.User)
+	query.Set("api_key", apiKey)
+	query.Set("format", "json")
+	query.Set("limit", "200")
+	query.Set("from", strconv.FormatInt(from.Unix(), 10))
+	query.Set("to", strconv.FormatInt(end.Unix(), 10))
+
+	totals := make(map[civilDate]int)
+	records := 0
+	for page, totalPages := 1, 1; page <= totalPages; page++ {
+		query.Set("page", strconv.Itoa(page))
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://ws.audioscrobbler.com/2.0/?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp lastfmRecentTracks
+		if err := opts.Limits.getJSON(req, &resp); err != nil {
+			return nil, err
+		}
+		tracks, err := resp.tracks()
+		if err != nil {
+			return nil, err
+		}
+
+		records += len(tracks)
+		if err := opts.Limits.checkRows(records); err != nil {
+			return nil, errorf("lastfm: %w", err)
+		}
+		for _, t := range tracks {
+			// The track currently playing has no date yet.
+			if t.Date == nil {
+				continue
+			}
+			uts, err := strconv.ParseInt(t.Date.UTS, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			totals[civil(time.Unix(uts, 0))]++
+		}
+
+		if n, err := strconv.Atoi(resp.RecentTracks.Attr.TotalPages); err == nil {
+			totalPages = n
+		}
+	}
+
+	return dailyTotals(totals), nil
+}
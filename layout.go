@@ -0,0 +1,497 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+)
+
+// layout is a measured heatmap: the size of the image and where every
+// piece of it goes, in pixels. Layouts are computed without drawing, and
+// renderers draw them without measuring, so a new arrangement of the days
+// is a new layout function and nothing else.
+type layout struct {
+	width, height int
+	labels        []layoutText // title and axis labels, drawn before the cells
+	cells         []layoutCell
+	sectors       []layoutSector // ring sectors of polar layouts, drawn with the cells
+	legend        []layoutSwatch
+	bars          []layoutSwatch  // bars of charts, each labelled with its value
+	lines         []layoutLine    // lines of charts, drawn over the bars
+	outlines      []layoutOutline // drawn over the cells and legend
+	borders       []layoutOutline // of the theme around every cell, under the outlines
+	parts         []layoutSwatch  // bands of cells split by category, drawn over them
+	numbers       []layoutSwatch  // labels over the cells, as day numbers, each in its color
+	marks         []layoutSwatch  // pattern marks, drawn over the cells and legend
+	desc          string          // what the image shows, for screen readers
+}
+
+// layoutOutline is a border in the text color, as around unusual days.
+type layoutOutline struct {
+	rect  image.Rectangle
+	width int
+}
+
+// layoutText is a line of text with its baseline starting at x, y.
+type layoutText struct {
+	x, y int
+	text string
+}
+
+// bounds returns the box the text covers when set in face.
+func (t layoutText) bounds(face font.Face) image.Rectangle {
+	m := face.Metrics()
+	top := t.y - m.Ascent.Ceil()
+	return image.Rect(t.x, top, t.x+font.MeasureString(face, t.text).Ceil(), top+m.Height.Ceil())
+}
+
+// layoutCell is the square of one day, or of what else a layout counts,
+// which label names in place of the date.
+type layoutCell struct {
+	rect  image.Rectangle
+	date  time.Time
+	count int
+	color color.RGBA
+	label string
+}
+
+// name returns what the tooltip of the cell calls it.
+func (c layoutCell) name() string {
+	if c.label != "" {
+		return c.label
+	}
+	return c.date.Format("2006-01-02")
+}
+
+// layoutSwatch is an entry of the legend: a square of a color and its label.
+type layoutSwatch struct {
+	rect  image.Rectangle
+	color color.RGBA
+	label layoutText
+}
+
+// layoutKind is an arrangement -layout offers besides the year of weeks.
+// Those of monthly or other totals, not days, draw none of the extras of
+// days; bare ones draw the days alone, without text or outlines, and polar
+// ones draw them as ring sectors instead of cells. Those that grow with the
+// span of the data check it before they are arranged.
+type layoutKind struct {
+	arrange func(hm heatmap, opts renderOptions) layout
+	check   func(hm heatmap, opts renderOptions) error
+	days    bool
+	bare    bool
+	polar   bool
+}
+
+var layoutKinds = map[string]layoutKind{
+	"months":   {arrange: monthsLayout},
+	"calendar": {arrange: calendarLayout, days: true},
+	"strip":    {arrange: stripLayout, days: true, bare: true},
+	"radial":   {arrange: radialLayout, days: true, polar: true},
+	"spiral":   {arrange: spiralLayout, check: checkSpiral, days: true, polar: true},
+}
+
+// layoutNames lists year, the default, and then the other layouts.
+func layoutNames() []string {
+	names := make([]string, 0, len(layoutKinds))
+	for name := range layoutKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{"year"}, names...)
+}
+
+// parseLayout validates -layout against the other options, returning ""
+// for the year of weeks.
+func parseLayout(name string, opts renderOptions) (string, error) {
+	if name == "year" {
+		return "", nil
+	}
+	kind, ok := layoutKinds[name]
+	switch {
+	case !ok:
+		return "", usageError(trf("unknown layout %q (available: %s)", name, strings.Join(layoutNames(), ", ")))
+	case opts.Card:
+		return "", usageError(tr("social cards draw the year of weeks; -layout does not apply"))
+	case kind.days && opts.Profile:
+		return "", usageError(trf("-weekday-chart charts the rows of the year of weeks; it does not apply to -layout %s", name))
+	case kind.polar && (opts.Categories != "" || opts.Anomalies > 0):
+		return "", usageError(trf("-layout %s draws days as ring sectors: -categories and -anomalies, which split and outline square cells, do not apply", name))
+	case kind.bare && (opts.Anomalies > 0 || opts.Streaks || opts.Panel != ""):
+		return "", usageError(trf("-layout %s draws the days alone: -anomalies, -streaks and -panel do not apply", name))
+	case !kind.days && (opts.Goal > 0 || opts.Forecast || opts.Smooth > 1 || opts.Normalize != "" || opts.Categories != "" ||
+		opts.Anomalies > 0 || opts.Streaks || opts.Panel != "" || opts.Profile):
+		return "", usageError(trf("-layout %s draws totals, not days: -goal, -forecast, -smooth, -normalize, -categories, -anomalies, -streaks, -panel and -weekday-chart do not apply", name))
+	}
+	return name, nil
+}
+
+// arrange lays out hm as -layout asks, or returns a usage error when the
+// layout cannot hold the data.
+func arrange(hm heatmap, opts renderOptions) (layout, error) {
+	var l layout
+	if opts.Layout == "" {
+		l = yearLayout(hm, opts)
+	} else {
+		kind := layoutKinds[opts.Layout]
+		if kind.check != nil {
+			if err := kind.check(hm, opts); err != nil {
+				return layout{}, err
+			}
+		}
+		l = kind.arrange(hm, opts)
+	}
+	if opts.Patterns {
+		l.addPatterns(hm.scale, opts.Theme)
+	}
+	if opts.Theme.Border > 0 {
+		l.addBorders(opts.Theme.Border)
+	}
+	if len(hm.counts) == 0 {
+		// An empty grid could be mistaken for a year without activity.
+		l.addFooter(opts.Theme.label("no data"))
+	}
+	if opts.RTL {
+		l.mirror(opts.Theme.newFace())
+	}
+	return l, nil
+}
+
+// yearLayout arranges the year of hm as weeks in columns of days, with the
+// title above, the month names between them and the legend to the right.
+func yearLayout(hm heatmap, opts renderOptions) layout {
+	cell, gap := opts.cellSize(), opts.Theme.Gap
+	face := opts.Theme.newFace()
+	width, height := imageSize(cell, gap)
+	l := layout{width: width, height: height}
+
+	l.labels = append(l.labels, layoutText{10, 25, opts.Title})
+	l.addMonths(face, opts.Theme, hm.start, 0, titleHeight+15, cell, gap)
+	if opts.WeekNumbers > 0 && opts.WeekNumbersAt == "top" {
+		l.addWeekNumbers(face, hm, opts, titleHeight)
+	}
+
+	l.cells = gridCells(hm, 0, titleHeight+monthHeight, cell, gap)
+	l.colorCategories(hm, l.cells, opts)
+
+	sum := summary{}
+	if shown := hm.shown(); len(shown) > 0 {
+		sum = summarize(shown)
+	}
+
+	legendX := gridWidth(cell, gap) + 10
+	legendY := titleHeight + monthHeight + 10
+	if opts.Profile {
+		l.addProfile(sum, hm.start, legendX, cell, gap, opts.Theme)
+		legendX += profileWidth
+		l.width += profileWidth
+	}
+	l.addLegend(face, hm, opts, legendX, legendY)
+	l.outlineUnusual(hm, l.cells, cell)
+	below := gridBottom(cell, gap)
+	if opts.WeekNumbers > 0 && opts.WeekNumbersAt == "bottom" {
+		below = l.addWeekNumbers(face, hm, opts, below)
+	}
+	if opts.MonthTotals != "" {
+		below = l.addMonthTotals(face, hm, opts, below)
+	}
+	if opts.Sparkline != "" {
+		l.addSparkline(hm, opts, below)
+	}
+	l.addSummary(face, sum, opts, legendX)
+	return l
+}
+
+// addSummary adds the panel and the streaks of sum the options ask for:
+// the panel right of the legend, which starts at legendX, or below the
+// grid, and the streaks below that.
+func (l *layout) addSummary(face font.Face, sum summary, opts renderOptions, legendX int) {
+	switch opts.Panel {
+	case "right":
+		// The panel starts past the widest legend label and widens the
+		// image to fit.
+		x := legendX
+		for _, s := range l.legend {
+			x = max(x, s.label.bounds(face).Max.X)
+		}
+		x += 30
+		for i, line := range panelLines(sum, opts.Theme) {
+			t := layoutText{x, titleHeight + monthHeight + 25 + i*panelLine, line}
+			l.labels = append(l.labels, t)
+			l.width = max(l.width, t.bounds(face).Max.X+10)
+		}
+	case "below":
+		lines := panelLines(sum, opts.Theme)
+		for i, line := range lines {
+			l.labels = append(l.labels, layoutText{10, l.height + 15 + i*panelLine, line})
+		}
+		l.height += len(lines)*panelLine + 10
+	}
+	if opts.Streaks {
+		l.labels = append(l.labels, layoutText{10, l.height + stripHeight - 8,
+			opts.Theme.labelf("Longest streak: %s   Current streak: %s", streakDays(sum.longestStreak, opts.Theme), streakDays(sum.currentStreak, opts.Theme))})
+		l.height += stripHeight
+	}
+}
+
+// stackedLayout arranges the years of several heatmaps in rows of the
+// given number of columns, filled left to right, each grid under its label
+// and month names. Grids in a column line up week by week. The title goes
+// above them all and the legend, of the color scale they share, to the
+// right of the first row.
+func stackedLayout(hms []heatmap, labels []string, columns int, opts renderOptions) layout {
+	cell, gap := opts.cellSize(), opts.Theme.Gap
+	face := opts.Theme.newFace()
+	gridHeight := cell*daysInWeek + gap*(daysInWeek-1)
+	block := stackLabelHeight + monthHeight + gridHeight + stackGap
+	column := gridWidth(cell, gap) + stackGap
+	columns = min(columns, len(hms))
+	rows := (len(hms) + columns - 1) / columns
+	l := layout{width: columns*column - stackGap + legendWidth, height: titleHeight + rows*block - stackGap}
+
+	l.labels = append(l.labels, layoutText{10, 25, opts.Title})
+	for i, hm := range hms {
+		left, top := i%columns*column, titleHeight+i/columns*block
+		l.labels = append(l.labels, layoutText{left + 10, top + 15, labels[i]})
+		l.addMonths(face, opts.Theme, hm.start, left, top+stackLabelHeight+15, cell, gap)
+		cells := gridCells(hm, left, top+stackLabelHeight+monthHeight, cell, gap)
+		l.colorCategories(hm, cells, opts)
+		l.cells = append(l.cells, cells...)
+		l.outlineUnusual(hm, cells, cell)
+	}
+	l.addLegend(face, hms[0], opts, columns*column-stackGap+10, titleHeight+stackLabelHeight+monthHeight+10)
+	return l
+}
+
+// addMonths labels the months of the grid starting on start, whose left
+// edge is x, with their names, baseline at y, above the week each starts
+// in.
+func (l *layout) addMonths(face font.Face, t theme, start time.Time, x, y, cell, gap int) {
+	currentMonth := start.Month()
+	for week := 0; week < numWeeks; week++ {
+		date := addDate(start, 0, 0, week*7)
+		if date.Month() != currentMonth {
+			currentMonth = date.Month()
+			l.addLabel(face, layoutText{x + week*(cell+gap), y, t.label(monthNames[currentMonth-1])})
+		}
+	}
+}
+
+// addLegend lists the colors of hm's scale, or of its categories when it
+// has them, from x, y down, headed by what the colors stand for when that
+// is not simply the counts, and then the keys of forecast and unusual days
+// when hm has them. The image grows to fit.
+func (l *layout) addLegend(face font.Face, hm heatmap, opts renderOptions, x, y int) {
+	if heading := legendHeading(hm, opts); heading != "" {
+		l.labels = append(l.labels, layoutText{x, y - 15, heading})
+	}
+	swatch := func(c color.RGBA, label string) image.Rectangle {
+		top := y + len(l.legend)*30
+		r := image.Rect(x, top, x+20, top+20)
+		l.legend = append(l.legend, layoutSwatch{rect: r, color: c, label: layoutText{x + 30, top + 15, label}})
+		l.height = max(l.height, top+20)
+		return r
+	}
+	if len(hm.categoryNames) > 0 {
+		for i, name := range hm.categoryNames {
+			swatch(categoryColors[i], name)
+		}
+	} else {
+		for _, entry := range hm.scale.legendEntries() {
+			if entry.label != "" {
+				swatch(entry.color, entry.in(opts.Theme))
+			}
+		}
+	}
+	if len(hm.projected) > 0 {
+		strongest := opts.Theme.Colors[len(opts.Theme.Colors)-1]
+		swatch(mix(strongest, opts.Theme.Background, forecastFade), opts.Theme.label("forecast"))
+	}
+	if len(hm.unusual) > 0 {
+		l.outlines = append(l.outlines, layoutOutline{swatch(opts.Theme.Background, opts.Theme.label("unusual")), 2})
+	}
+}
+
+// legendHeading says what the colors of the legend stand for when it is
+// not the counts themselves, or when the scale was clipped.
+func legendHeading(hm heatmap, opts renderOptions) string {
+	t := opts.Theme
+	var parts []string
+	if opts.Layout == "months" {
+		parts = append(parts, t.label("monthly totals"))
+	}
+	if opts.Smooth > 1 {
+		parts = append(parts, t.labelf("%d-day average", opts.Smooth))
+	}
+	switch opts.Normalize {
+	case "percent":
+		parts = append(parts, t.label("% of max"))
+	case "minmax":
+		parts = append(parts, t.label("% of range"))
+	case "zscore":
+		parts = append(parts, t.label("z-score"))
+	}
+	if s, ok := hm.scale.(bucketScale); ok && s.clip > 0 {
+		parts = append(parts, t.labelf("clipped at %s", formatCount(s.clip)))
+	}
+	return strings.Join(parts, t.label(", "))
+}
+
+// addBorders puts a border of the given width around the cells and legend
+// swatches of l, leaving out cells too small to show anything inside one.
+func (l *layout) addBorders(width int) {
+	for _, c := range l.cells {
+		if min(c.rect.Dx(), c.rect.Dy()) > 2*width {
+			l.borders = append(l.borders, layoutOutline{c.rect, width})
+		}
+	}
+	for _, s := range l.legend {
+		l.borders = append(l.borders, layoutOutline{s.rect, width})
+	}
+}
+
+// outlineUnusual outlines the cells of the days -anomalies found in hm.
+func (l *layout) outlineUnusual(hm heatmap, cells []layoutCell, cell int) {
+	for _, c := range cells {
+		if hm.unusual[civil(c.date)] {
+			l.outlines = append(l.outlines, layoutOutline{c.rect, outlineWidth(cell)})
+		}
+	}
+}
+
+// addProfile charts the average count of each weekday of sum as a bar
+// level with its row of the grid, which starts on the weekday of start.
+// The weekday and value follow each bar when rows are tall enough for text.
+func (l *layout) addProfile(sum summary, start time.Time, x, cell, gap int, t theme) {
+	l.labels = append(l.labels, layoutText{x, titleHeight + 15, t.label("avg/day")})
+	var most float64
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		most = max(most, sum.weekdayMean(wd))
+	}
+	for row := 0; row < daysInWeek; row++ {
+		wd := (start.Weekday() + time.Weekday(row)) % daysInWeek
+		mean := sum.weekdayMean(wd)
+		width := 0
+		if most > 0 {
+			width = int(math.Round(mean / most * profileBar))
+		}
+		y := titleHeight + monthHeight + row*(cell+gap)
+		bar := layoutSwatch{rect: image.Rect(x, y, x+width, y+cell), color: t.Colors[len(t.Colors)-1]}
+		if cell >= t.newFace().Metrics().Height.Ceil() {
+			bar.label = layoutText{x + width + 4, y + cell/2 + 4, fmt.Sprintf("%s %.1f", t.label(weekdayNames[wd]), mean)}
+		}
+		l.bars = append(l.bars, bar)
+	}
+}
+
+// panelLines are the lines of the summary panel of images of t: the total,
+// the average per day, the best day and the streaks of sum.
+func panelLines(sum summary, t theme) []string {
+	best := "-"
+	if sum.best.Count > 0 {
+		best = fmt.Sprintf("%s (%s)", formatCount(sum.best.Count), sum.best.Date.Format(t.label("Jan 2")))
+	}
+	lines := [][2]string{
+		{t.label("Total"), formatCount(sum.total)},
+		{t.label("Per day"), fmt.Sprintf("%.1f", sum.mean)},
+		{t.label("Best day"), best},
+		{t.label("Longest"), streakDays(sum.longestStreak, t)},
+		{t.label("Current"), streakDays(sum.currentStreak, t)},
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = fmt.Sprintf("%-10s%s", line[0], line[1])
+	}
+	return out
+}
+
+// streakDays writes a streak length on images of t, as in 1 day or 12
+// days.
+func streakDays(n int, t theme) string {
+	return t.labeln("%d day", "%d days", n, n)
+}
+
+// addLabel adds an axis label unless it would overlap one already placed,
+// as names of short months could with small cells.
+func (l *layout) addLabel(face font.Face, t layoutText) {
+	for _, other := range l.labels {
+		if other.bounds(face).Overlaps(t.bounds(face)) {
+			return
+		}
+	}
+	l.labels = append(l.labels, t)
+}
+
+// gridCells places the days of hm in weeks of cell-sized squares with their
+// top left corner at x0, y0.
+func gridCells(hm heatmap, x0, y0, cell, gap int) []layoutCell {
+	cells := make([]layoutCell, 0, numWeeks*daysInWeek)
+	for week := 0; week < numWeeks; week++ {
+		for day := 0; day < daysInWeek; day++ {
+			x, y := x0+week*(cell+gap), y0+day*(cell+gap)
+			cells = append(cells, dayCell(hm, addDate(hm.start, 0, 0, week*7+day), image.Rect(x, y, x+cell, y+cell)))
+		}
+	}
+	return cells
+}
+
+// dayCell returns the cell of a day of hm covering rect, in the color of
+// its forecast or its shade.
+func dayCell(hm heatmap, date time.Time, rect image.Rectangle) layoutCell {
+	c, ok := hm.projected[civil(date)]
+	if !ok {
+		shade, shaded := hm.shades[civil(date)]
+		c = hm.scale.colorFor(shade)
+		if !shaded && hm.empty != nil {
+			c = *hm.empty
+		}
+	}
+	return layoutCell{rect: rect, date: date, count: hm.counts[civil(date)], color: c}
+}
+
+// draw hands the pieces of the layout to r.
+func (l layout) draw(r renderer, t theme) {
+	if l.desc != "" {
+		r.describe(l.desc)
+	}
+	r.begin(l.width, l.height, t)
+	for _, label := range l.labels {
+		r.text(label.x, label.y, label.text, t.Text)
+	}
+	r.cells(l.cells)
+	r.sectors(l.sectors)
+	for _, p := range l.parts {
+		r.rect(p.rect, p.color)
+	}
+	for _, n := range l.numbers {
+		r.text(n.label.x, n.label.y, n.label.text, n.color)
+	}
+	for _, b := range l.bars {
+		r.rect(b.rect, b.color)
+		if b.label.text != "" {
+			r.text(b.label.x, b.label.y, b.label.text, t.Text)
+		}
+	}
+	for _, line := range l.lines {
+		r.line(line)
+	}
+	for _, s := range l.legend {
+		r.rect(s.rect, s.color)
+		r.text(s.label.x, s.label.y, s.label.text, t.Text)
+	}
+	for _, m := range l.marks {
+		r.rect(m.rect, m.color)
+	}
+	for _, b := range l.borders {
+		r.outline(b.rect, b.width, t.BorderColor)
+	}
+	for _, o := range l.outlines {
+		r.outline(o.rect, o.width, t.Text)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// leapDayPolicies are where -leap-day puts Feb 29 in layouts that give
+// every year the same places, the wheel, the strip and the turns of the
+// spiral, and in the days compare -diff pairs: extra gives it a place of
+// its own in leap years, which moves the days after it one place on from
+// where they fall in other years; skip drops it and merge adds it to Feb
+// 28, so each year has 365 places and a date keeps its place from year to
+// year. In the grids of weeks, whose places are the days of the week, skip
+// and merge change the data alone and leave the cell of Feb 29 empty.
+var leapDayPolicies = []string{"extra", "skip", "merge"}
+
+// checkLeapDay validates -leap-day, returning "" for extra.
+func checkLeapDay(policy string) (string, error) {
+	switch {
+	case !slices.Contains(leapDayPolicies, policy):
+		return "", usageError(trf("unknown leap day policy %q (available: %s)", policy, strings.Join(leapDayPolicies, ", ")))
+	case policy == "extra":
+		return "", nil
+	}
+	return policy, nil
+}
+
+func isLeapDay(t time.Time) bool {
+	_, month, day := t.Date()
+	return month == time.February && day == 29
+}
+
+// placed reports whether the day of t has a place of its own under policy.
+func placed(t time.Time, policy string) bool {
+	return policy == "" || !isLeapDay(t)
+}
+
+// foldLeapDays applies policy to the Feb 29s of tweets: skip drops them
+// and merge adds their counts to Feb 28.
+func foldLeapDays(tweets []DailyTweet, policy string) []DailyTweet {
+	if policy == "" || !slices.ContainsFunc(tweets, func(t DailyTweet) bool { return isLeapDay(t.Date) }) {
+		return tweets
+	}
+	folded := make([]DailyTweet, 0, len(tweets))
+	for _, tweet := range tweets {
+		if !isLeapDay(tweet.Date) {
+			folded = append(folded, tweet)
+			continue
+		}
+		if policy == "skip" {
+			continue
+		}
+		eve := addDate(tweet.Date, 0, 0, -1)
+		if n := len(folded); n > 0 && folded[n-1].Date.Equal(eve) {
+			folded[n-1] = mergeDays(folded[n-1], tweet)
+			continue
+		}
+		tweet.Date = eve
+		folded = append(folded, tweet)
+	}
+	return folded
+}
+
+// mergeDays returns day with the count and categories of other added.
+func mergeDays(day, other DailyTweet) DailyTweet {
+	day.Count += other.Count
+	if len(other.Categories) > 0 {
+		categories := make(map[string]int, len(day.Categories)+len(other.Categories))
+		for name, count := range day.Categories {
+			categories[name] = count
+		}
+		for name, count := range other.Categories {
+			categories[name] += count
+		}
+		day.Categories = categories
+	}
+	return day
+}
+
+// places returns how many places the days from from up to to take under
+// policy, negative when to comes first.
+func places(from, to time.Time, policy string) int {
+	n := daysBetween(from, to)
+	if policy == "" {
+		return n
+	}
+	if n < 0 {
+		return -places(to, from, policy)
+	}
+	for year := from.Year(); year <= to.Year(); year++ {
+		leap := time.Date(year, time.February, 29, 0, 0, 0, 0, time.UTC)
+		if isLeapDay(leap) && daysBetween(from, leap) >= 0 && daysBetween(leap, to) > 0 {
+			n--
+		}
+	}
+	return n
+}
+
+// placedDays returns the n days from start on that have places of their
+// own under policy.
+func placedDays(start time.Time, n int, policy string) []time.Time {
+	days := make([]time.Time, 0, n)
+	for date := start; len(days) < n; date = addDate(date, 0, 0, 1) {
+		if placed(date, policy) {
+			days = append(days, date)
+		}
+	}
+	return days
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// inputLimits bound what a source may read, so that a malformed or hostile
+// input, above all an API or URL answering with endless data, fails with a
+// clear error instead of exhausting memory.
+type inputLimits struct {
+	MaxRows  int   // rows of an input file, or records fetched from an API
+	MaxCount int   // magnitude of a day's count
+	MaxBytes int64 // size of an API response or of a file read whole
+}
+
+var defaultLimits = inputLimits{
+	MaxRows:  100_000_000,
+	MaxCount: 1_000_000_000,
+	MaxBytes: 256 << 20,
+}
+
+func addLimitFlags(fs *flag.FlagSet, l *inputLimits) {
+	*l = defaultLimits
+	fs.IntVar(&l.MaxRows, "max-rows", defaultLimits.MaxRows, "fail on inputs with more rows, or API sources returning more records")
+	fs.IntVar(&l.MaxCount, "max-count", defaultLimits.MaxCount, "fail on days counting more than this")
+	fs.Int64Var(&l.MaxBytes, "max-bytes", defaultLimits.MaxBytes, "fail on API responses, and files read whole, larger than this many bytes")
+}
+
+// checkRows fails once n rows or records have been read.
+func (l inputLimits) checkRows(n int) error {
+	if n > l.MaxRows {
+		return inputError(errorf("more than %d rows; raise -max-rows to read them", l.MaxRows))
+	}
+	return nil
+}
+
+// checkCounts fails on a day whose count is beyond -max-count either way.
+func (l inputLimits) checkCounts(tweets []DailyTweet) error {
+	for _, tweet := range tweets {
+		if tweet.Count > l.MaxCount || tweet.Count < -l.MaxCount {
+			return malformedf("%s: count %d is beyond -max-count %d", tweet.Date.Format("2006-01-02"), tweet.Count, l.MaxCount)
+		}
+	}
+	return nil
+}
+
+// readFile reads a whole file after checking its size.
+func (l inputLimits) readFile(filename string) ([]byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return l.readAll(file, filename)
+}
+
+// readAll reads r to the end, failing once it goes past -max-bytes.
+func (l inputLimits) readAll(r io.Reader, name string) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, l.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > l.MaxBytes {
+		return nil, inputError(errorf("%s: larger than %d bytes; raise -max-bytes to read it", name, l.MaxBytes))
+	}
+	return data, nil
+}
+
+// getJSON performs a request and decodes the JSON response into v. The
+// response is read whole first, so one larger than -max-bytes fails before
+// it is decoded.
+func (l inputLimits) getJSON(req *http.Request, v interface{}) error {
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	slog.Debug("api request", "host", req.URL.Host, "path", req.URL.Path, "status", resp.StatusCode, "elapsed", time.Since(start))
+
+	if resp.StatusCode != http.StatusOK {
+		return errorf("%s %s%s: %s", req.Method, req.URL.Host, req.URL.Path, resp.Status)
+	}
+
+	data, err := l.readAll(resp.Body, req.URL.Host+req.URL.Path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// getJSON is inputLimits.getJSON with the default limits, for requests
+// other than those of sources.
+func getJSON(req *http.Request, v interface{}) error {
+	return defaultLimits.getJSON(req, v)
+}
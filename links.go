@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cellLinkField matches the fields of a -cell-link template: {{date}}, the
+// day of the cell, {{date+N}} and {{date-N}}, the day N days after or
+// before it, {{count}} and {{label}}, the name of cells that are not days.
+var cellLinkField = regexp.MustCompile(`\{\{\s*(date(?:\s*[+-]\s*\d+)?|count|label)\s*\}\}`)
+
+// checkCellLink validates a -cell-link template: its fields must be known
+// and, so a served image cannot carry a script, it must be a web address
+// or one relative to the page.
+func checkCellLink(template string) (string, error) {
+	if template == "" {
+		return "", nil
+	}
+	rest := cellLinkField.ReplaceAllString(template, "")
+	if i := strings.Index(rest, "{{"); i >= 0 {
+		return "", usageError(trf("unknown field in cell-link %q (available: {{date}}, {{date+N}}, {{date-N}}, {{count}}, {{label}})", template))
+	}
+	u, err := url.Parse(strings.ReplaceAll(rest, " ", "+"))
+	if err != nil || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") {
+		return "", usageError(trf("cell-link must be an http, https or relative URL, not %q", template))
+	}
+	return template, nil
+}
+
+// cellLink fills template in for the cell c. It returns "" for cells the
+// template has nothing to link, such as ticks, or cells without a date
+// when it asks for one.
+func cellLink(template string, c layoutCell) string {
+	if template == "" || (c.date.IsZero() && c.label == "") {
+		return ""
+	}
+	ok := true
+	link := cellLinkField.ReplaceAllStringFunc(template, func(field string) string {
+		name := strings.Join(strings.Fields(strings.Trim(field, "{}")), "")
+		switch {
+		case name == "count":
+			return strconv.Itoa(c.count)
+		case name == "label":
+			return url.QueryEscape(c.name())
+		case c.date.IsZero():
+			ok = false
+			return ""
+		}
+		days, _ := strconv.Atoi(strings.TrimPrefix(name, "date"))
+		return addDate(c.date, 0, 0, days).Format("2006-01-02")
+	})
+	if !ok {
+		return ""
+	}
+	return link
+}
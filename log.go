@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// logFlags holds the logging flags every command accepts.
+type logFlags struct {
+	verbose     bool
+	quiet       bool
+	format      string
+	errorFormat string
+}
+
+// logging holds the logging flags of the command being run.
+var logging logFlags
+
+func addLogFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&logging.verbose, "verbose", false, "log progress details")
+	fs.BoolVar(&logging.quiet, "quiet", false, "log errors only and print nothing on success")
+	fs.StringVar(&logging.format, "log-format", "text", "log format: text or json")
+	fs.StringVar(&logging.errorFormat, "error-format", "text", "format of the error report on failure: text or json")
+}
+
+// setup installs the default slog logger, which writes to standard error.
+func (f *logFlags) setup() error {
+	if f.verbose && f.quiet {
+		return usageError(tr("-verbose and -quiet are mutually exclusive"))
+	}
+
+	level := slog.LevelInfo
+	switch {
+	case f.verbose:
+		level = slog.LevelDebug
+	case f.quiet:
+		level = slog.LevelError
+	}
+
+	if f.errorFormat != "text" && f.errorFormat != "json" {
+		return usageError(trf("unknown error format %q", f.errorFormat))
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch f.format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return usageError(trf("unknown log format %q", f.format))
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// printf prints a message for the user on standard output unless -quiet is
+// set.
+func printf(format string, args ...interface{}) {
+	if !logging.quiet {
+		fmt.Printf(tr(format), args...)
+	}
+}
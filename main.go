@@ -1,23 +1,16 @@
 package main
 
 import (
-	"encoding/csv"
-	"fmt"
+	"context"
 	"image"
 	"image/color"
-	"image/draw"
 	"image/png"
-	"io"
-	"log"
-	"math"
+	"log/slog"
 	"os"
+	"runtime"
 	"sort"
-	"strconv"
+	"sync"
 	"time"
-
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
 )
 
 const (
@@ -29,6 +22,13 @@ const (
 	legendWidth  = 200
 	titleHeight  = 40
 	monthHeight  = 20
+	stripHeight  = 25  // a line of statistics below the grid
+	panelLine    = 20  // height of a line of the summary panel
+	profileWidth = 130 // the weekday chart between the grid and legend
+	profileBar   = 60  // longest bar of the weekday chart
+
+	stackLabelHeight = 20 // the label above each grid of a stacked layout
+	stackGap         = 20 // between the grids of a stacked layout, both ways
 )
 
 var baseColors = []color.RGBA{
@@ -42,212 +42,243 @@ var baseColors = []color.RGBA{
 type DailyTweet struct {
 	Date  time.Time
 	Count int
+	// Categories break Count down by category, when the input names them.
+	Categories map[string]int
 }
 
-func main() {
-	if len(os.Args) != 3 {
-		log.Fatal("Usage: go run main.go input.csv output.png")
-	}
+// command is a subcommand of the CLI. run receives the arguments following
+// the command name.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
 
-	inputFile := os.Args[1]
-	outputFile := os.Args[2]
+var commands = []command{
+	{"generate", "render a heatmap image", runGenerate},
+	{"batch", "render heatmaps of many inputs concurrently", runBatch},
+	{"serve", "serve a heatmap image over HTTP", runServe},
+	{"preview", "preview the heatmap in a browser as the data changes", runPreview},
+	{"daemon", "run the jobs of the config file on their schedules", runDaemon},
+	{"compare", "render two datasets as aligned grids on one color scale", runCompare},
+	{"multiples", "render many datasets, or the categories of one, as small grids on one color scale", runMultiples},
+	{"correlate", "report how two datasets correlate day by day, with lags and a scatter plot", runCorrelate},
+	{"punchcard", "render events as a grid of weekdays by hours of the day", runPunchCard},
+	{"matrix", "render counts by any two labels, such as service by day, as a grid", runMatrix},
+	{"stats", "print summary statistics of the data", runStats},
+	{"convert", "write the data as date,count CSV", runConvert},
+	{"validate", "check that the data can be read", runValidate},
+	{"config", "create a starter config file (config init)", runConfig},
+	{"demo", "write a year of synthetic sample data", runDemo},
+	{"themes", "list the color themes or preview them", runThemes},
+}
 
-	tweets, err := readCSV(inputFile)
-	if err != nil {
-		log.Fatal(err)
-	}
+// heatmap is the data a heatmap is drawn from: the first day of the grid,
+// the count for each date, and the color scale.
+type heatmap struct {
+	start  time.Time
+	counts map[civilDate]int
+	// shades are the values the colors stand for: the counts, or their
+	// moving average when smoothing.
+	shades map[civilDate]int
+	scale  colorScale
+	// unusual are the days -anomalies outlines.
+	unusual map[civilDate]bool
+	// projected are the faded colors of the days -forecast fills.
+	projected map[civilDate]color.RGBA
+	// categories break the days down when -categories draws them, and
+	// categoryNames are theirs in the order of categoryColors.
+	categories    map[civilDate]map[string]int
+	categoryNames []string
+	// empty, when set, colors the days without a shade, where the scale's
+	// color of zero would say something.
+	empty *color.RGBA
+}
 
-	img, err := generateHeatmap(tweets)
-	if err != nil {
-		log.Fatal(err)
-	}
+func newHeatmap(tweets []DailyTweet, opts renderOptions) heatmap {
+	return newScaledHeatmap(tweets, opts, sharedScale([][]DailyTweet{tweets}, opts))
+}
 
-	if err := savePNG(img, outputFile); err != nil {
-		log.Fatal(err)
+// shaded returns the values the days of tweets are colored by: the counts,
+// or their moving average when smoothing.
+func shaded(tweets []DailyTweet, opts renderOptions) []DailyTweet {
+	if opts.Smooth > 1 {
+		tweets = movingAverage(tweets, opts.Smooth)
 	}
-
-	fmt.Println("Heatmap generated successfully:", outputFile)
+	if opts.Normalize != "" {
+		tweets = normalize(tweets, opts.Normalize)
+	}
+	return tweets
 }
 
-func readCSV(filename string) ([]DailyTweet, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+// sharedScale returns the color scale the options ask for over every day
+// of the datasets, so heatmaps drawn side by side with it compare fairly.
+func sharedScale(datasets [][]DailyTweet, opts renderOptions) colorScale {
+	var counts []int
+	for _, tweets := range datasets {
+		for _, tweet := range shaded(foldLeapDays(tweets, opts.LeapDay), opts) {
+			counts = append(counts, tweet.Count)
+		}
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
+	sort.Ints(counts)
+	return newColorScale(counts, opts)
+}
 
-	// Skip header
-	if _, err := reader.Read(); err != nil {
-		return nil, err
+// newScaledHeatmap is newHeatmap with the given color scale.
+func newScaledHeatmap(tweets []DailyTweet, opts renderOptions, scale colorScale) heatmap {
+	tweets = foldLeapDays(tweets, opts.LeapDay)
+	tweetMap := make(map[civilDate]int)
+	for _, tweet := range tweets {
+		tweetMap[civil(tweet.Date)] = tweet.Count
 	}
-
-	var tweets []DailyTweet
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
+	shades := tweetMap
+	if opts.Smooth > 1 || opts.Normalize != "" {
+		shades = make(map[civilDate]int)
+		for _, tweet := range shaded(tweets, opts) {
+			shades[civil(tweet.Date)] = tweet.Count
 		}
+	}
 
-		date, err := time.Parse("20060102", record[0])
-		if err != nil {
-			return nil, err
-		}
+	// The grid covers the year up to the last day with data, or up to
+	// today when there is none, unless the options pin it.
+	var startDate time.Time
+	switch {
+	case !opts.From.IsZero():
+		startDate = day(opts.From)
+	case !opts.To.IsZero():
+		startDate = addDate(opts.To, -1, 0, 1)
+	case len(tweets) == 0:
+		startDate = addDate(time.Now(), -1, 0, 1)
+	default:
+		startDate = addDate(tweets[len(tweets)-1].Date, -1, 0, 1)
+	}
+	slog.Debug("window computed", "start", startDate.Format("2006-01-02"), "thresholds", scale)
 
-		count, err := strconv.Atoi(record[1])
-		if err != nil {
-			return nil, err
+	hm := heatmap{start: startDate, counts: tweetMap, shades: shades, scale: scale,
+		unusual: anomalyDates(findAnomalies(tweets, opts.Anomalies))}
+	if opts.Normalize == "zscore" {
+		// A z-score of zero is the mean, not a day without data.
+		hm.empty = &opts.Theme.Colors[0]
+	}
+	if opts.Categories != "" {
+		hm.categories, hm.categoryNames = categoryMaps(tweets), categoryNames(tweets)
+	}
+	if opts.Forecast {
+		hm.projected = make(map[civilDate]color.RGBA)
+		for _, day := range forecastDays(tweets) {
+			hm.projected[civil(day.Date)] = mix(scale.colorFor(day.Count), opts.Theme.Background, forecastFade)
 		}
-
-		tweets = append(tweets, DailyTweet{Date: date, Count: count})
 	}
-
-	return tweets, nil
+	return hm
 }
 
-func generateHeatmap(tweets []DailyTweet) (*image.RGBA, error) {
-	width := cellSize*numWeeks + cellGap*(numWeeks-1) + legendWidth
-	height := cellSize*daysInWeek + cellGap*(daysInWeek-1) + titleHeight + monthHeight
+// forecastFade is how far forecast days fade toward the background.
+const forecastFade = 0.6
 
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
-
-	tweetMap := make(map[time.Time]int)
-	var counts []int
-	maxCount := 0
-	for _, tweet := range tweets {
-		tweetMap[tweet.Date] = tweet.Count
-		counts = append(counts, tweet.Count)
-		if tweet.Count > maxCount {
-			maxCount = tweet.Count
+// shown returns the days of the grid with data, in date order.
+func (hm heatmap) shown() []DailyTweet {
+	var days []DailyTweet
+	for i := 0; i < numWeeks*daysInWeek; i++ {
+		date := addDate(hm.start, 0, 0, i)
+		if count, ok := hm.counts[civil(date)]; ok {
+			days = append(days, DailyTweet{Date: date, Count: count})
 		}
 	}
+	return days
+}
 
-	sort.Ints(counts)
-	thresholds := calculateThresholds(counts)
-
-	lastTweetDate := tweets[len(tweets)-1].Date
-	startDate := lastTweetDate.AddDate(-1, 0, 1)
+// imageSize returns the width and height of a heatmap drawn with cells of
+// the given size and gap. The legend sets a minimum height for small cells.
+func imageSize(cell, gap int) (int, int) {
+	width := gridWidth(cell, gap) + legendWidth
+	gridHeight := cell*daysInWeek + gap*(daysInWeek-1)
+	legendHeight := 10 + 30*(len(baseColors)-1) + 20
+	if legendHeight > gridHeight {
+		gridHeight = legendHeight
+	}
+	return width, gridHeight + titleHeight + monthHeight
+}
 
-	for week := 0; week < numWeeks; week++ {
-		for day := 0; day < daysInWeek; day++ {
-			date := startDate.AddDate(0, 0, week*7+day)
-			count := tweetMap[date]
+func gridWidth(cell, gap int) int {
+	return cell*numWeeks + gap*(numWeeks-1)
+}
 
-			colorIndex := getColorIndex(count, thresholds)
+func generateHeatmap(tweets []DailyTweet, opts renderOptions) (*image.RGBA, error) {
+	p := &pngRenderer{}
+	if err := drawHeatmap(context.Background(), p, tweets, opts); err != nil {
+		return nil, err
+	}
+	return p.img, nil
+}
 
-			x := week * (cellSize + cellGap)
-			y := day*(cellSize+cellGap) + titleHeight + monthHeight
+// parallelGridPixels is the grid area from which drawCells splits the
+// cells among goroutines; below it starting them costs more than it saves.
+const parallelGridPixels = 1 << 18
 
-			drawRect(img, x, y, cellSize, cellSize, baseColors[colorIndex])
+// drawCells fills the cells of a layout. Cells cover disjoint pixels, so
+// large grids are drawn a range of cells per goroutine into the same image.
+func drawCells(img *image.RGBA, cells []layoutCell) {
+	fill := func(cells []layoutCell) {
+		for _, c := range cells {
+			drawRect(img, c.rect.Min.X, c.rect.Min.Y, c.rect.Dx(), c.rect.Dy(), c.color)
 		}
 	}
 
-	drawTitle(img, "Tweet Activity Heatmap")
-	drawMonths(img, startDate)
-	if err := drawLegend(img, thresholds); err != nil {
-		return nil, err
+	workers := runtime.GOMAXPROCS(0)
+	if workers == 1 || len(cells) == 0 || cells[0].rect.Dx()*cells[0].rect.Dy()*len(cells) < parallelGridPixels {
+		fill(cells)
+		return
 	}
-
-	return img, nil
-}
-
-func calculateThresholds(counts []int) []int {
-	if len(counts) == 0 {
-		return []int{0, 0, 0, 0}
+	if workers > len(cells) {
+		workers = len(cells)
 	}
-
-	maxCount := counts[len(counts)-1]
-	thresholds := make([]int, len(baseColors)-1)
-	for i := range thresholds {
-		thresholds[i] = int(math.Ceil(float64(maxCount) * float64(i+1) / float64(len(baseColors))))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(part []layoutCell) {
+			defer wg.Done()
+			fill(part)
+		}(cells[w*len(cells)/workers : (w+1)*len(cells)/workers])
 	}
+	wg.Wait()
+}
 
-	return thresholds
+// drawOutline draws a border of the given width just inside r.
+func drawOutline(img *image.RGBA, r image.Rectangle, width int, c color.Color) {
+	drawRect(img, r.Min.X, r.Min.Y, r.Dx(), width, c)
+	drawRect(img, r.Min.X, r.Max.Y-width, r.Dx(), width, c)
+	drawRect(img, r.Min.X, r.Min.Y, width, r.Dy(), c)
+	drawRect(img, r.Max.X-width, r.Min.Y, width, r.Dy(), c)
 }
 
-func getColorIndex(count int, thresholds []int) int {
-	for i, threshold := range thresholds {
-		if count <= threshold {
-			return i
-		}
-	}
-	return len(baseColors) - 1
+// outlineWidth is the width of the outline of cells of the given size.
+func outlineWidth(cell int) int {
+	return max(1, cell/8)
 }
 
+// drawRect fills a rectangle, clipped to the image, with an opaque or
+// translucent color replacing what is there, as img.Set would. It writes
+// the first row into Pix and copies it down rather than setting each pixel.
 func drawRect(img *image.RGBA, x, y, w, h int, c color.Color) {
-	for dy := 0; dy < h; dy++ {
-		for dx := 0; dx < w; dx++ {
-			img.Set(x+dx, y+dy, c)
-		}
+	r := image.Rect(x, y, x+w, y+h).Intersect(img.Bounds())
+	if r.Empty() {
+		return
 	}
-}
-
-func drawTitle(img *image.RGBA, title string) {
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.NewUniform(color.Black),
-		Face: basicfont.Face7x13,
-		Dot:  fixed.Point26_6{X: fixed.I(10), Y: fixed.I(25)},
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	first := img.Pix[img.PixOffset(r.Min.X, r.Min.Y):img.PixOffset(r.Max.X, r.Min.Y)]
+	for i := 0; i < len(first); i += 4 {
+		first[i], first[i+1], first[i+2], first[i+3] = rgba.R, rgba.G, rgba.B, rgba.A
 	}
-	d.DrawString(title)
-}
-
-func drawMonths(img *image.RGBA, startDate time.Time) {
-	monthNames := []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
-	currentMonth := startDate.Month()
-	for week := 0; week < numWeeks; week++ {
-		date := startDate.AddDate(0, 0, week*7)
-		if date.Month() != currentMonth {
-			currentMonth = date.Month()
-			x := week * (cellSize + cellGap)
-			d := &font.Drawer{
-				Dst:  img,
-				Src:  image.NewUniform(color.Black),
-				Face: basicfont.Face7x13,
-				Dot:  fixed.Point26_6{X: fixed.I(x), Y: fixed.I((titleHeight + 15))},
-			}
-			d.DrawString(monthNames[currentMonth-1])
-		}
+	for row := r.Min.Y + 1; row < r.Max.Y; row++ {
+		copy(img.Pix[img.PixOffset(r.Min.X, row):], first)
 	}
 }
 
-func drawLegend(img *image.RGBA, thresholds []int) error {
-	legendX := cellSize*numWeeks + cellGap*(numWeeks-1) + 10
-	legendY := titleHeight + monthHeight + 10
-
-	for i := 0; i < len(baseColors); i++ {
-		drawRect(img, legendX, legendY+i*30, 20, 20, baseColors[i])
-		var label string
-		if i == 0 {
-			label = "0"
-		} else if i == len(baseColors)-1 {
-			label = fmt.Sprintf("%d+", thresholds[i-1]+1)
-		} else {
-			if i-1 >= len(thresholds) {
-				return fmt.Errorf("index out of range for thresholds: %d", i-1)
-			}
-			if i >= len(thresholds) {
-				return fmt.Errorf("index out of range for thresholds: %d", i)
-			}
-			label = fmt.Sprintf("%d-%d", thresholds[i-1]+1, thresholds[i])
-		}
-
-		d := &font.Drawer{
-			Dst:  img,
-			Src:  image.NewUniform(color.Black),
-			Face: basicfont.Face7x13,
-			Dot:  fixed.Point26_6{X: fixed.I((legendX + 30)), Y: fixed.I((legendY + i*30 + 15))},
-		}
-		d.DrawString(label)
-	}
+// monthNames and weekdayNames are the names labels give months and
+// weekdays, in English; images translate them with theme.label.
+var monthNames = []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
 
-	return nil
-}
+var weekdayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
 
 func savePNG(img *image.RGBA, filename string) error {
 	file, err := os.Create(filename)
@@ -256,5 +287,5 @@ func savePNG(img *image.RGBA, filename string) error {
 	}
 	defer file.Close()
 
-	return png.Encode(file, img)
+	return encodePNG(file, img, png.DefaultCompression, versionString(), nil)
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"runtime"
+	"testing"
+)
+
+// benchGridCells returns the cells of a year of weeks of the given size, a
+// pixel apart.
+func benchGridCells(size int) ([]layoutCell, image.Rectangle) {
+	var cells []layoutCell
+	for week := 0; week < 53; week++ {
+		for weekday := 0; weekday < 7; weekday++ {
+			x, y := week*(size+1), weekday*(size+1)
+			cells = append(cells, layoutCell{
+				rect:  image.Rect(x, y, x+size, y+size),
+				color: color.RGBA{uint8(week), uint8(weekday), 0x80, 0xff},
+			})
+		}
+	}
+	return cells, image.Rect(0, 0, 53*(size+1), 7*(size+1))
+}
+
+// BenchmarkDrawCells compares drawing grids on one goroutine with drawing
+// them split among GOMAXPROCS, at cell sizes either side of
+// parallelGridPixels.
+func BenchmarkDrawCells(b *testing.B) {
+	for _, size := range []int{12, 20, 64, 128} {
+		cells, bounds := benchGridCells(size)
+		img := image.NewRGBA(bounds)
+		for _, mode := range []struct {
+			name  string
+			procs int
+		}{
+			{"serial", 1},
+			{"parallel", runtime.NumCPU()},
+		} {
+			b.Run(fmt.Sprintf("cell=%d/%s", size, mode.name), func(b *testing.B) {
+				defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(mode.procs))
+				b.SetBytes(int64(len(img.Pix)))
+				for i := 0; i < b.N; i++ {
+					drawCells(img, cells)
+				}
+			})
+		}
+	}
+}
+
+// TestDrawCellsParallel checks that the split grid matches the one drawn
+// on a single goroutine.
+func TestDrawCellsParallel(t *testing.T) {
+	cells, bounds := benchGridCells(64)
+	serial, parallel := image.NewRGBA(bounds), image.NewRGBA(bounds)
+	procs := runtime.GOMAXPROCS(1)
+	drawCells(serial, cells)
+	runtime.GOMAXPROCS(max(procs, 4))
+	drawCells(parallel, cells)
+	runtime.GOMAXPROCS(procs)
+	for i := range serial.Pix {
+		if serial.Pix[i] != parallel.Pix[i] {
+			t.Fatalf("pixel byte %d is %d drawn in parallel, %d serially", i, parallel.Pix[i], serial.Pix[i])
+		}
+	}
+}
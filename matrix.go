@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"image"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+)
+
+// maxMatrixLabels is the most distinct rows or columns a matrix input may
+// have, past which the picture would be too big to read.
+const maxMatrixLabels = 1000
+
+// matrix is a two-dimensional heatmap: a count for each row and column,
+// both named. The punch card is one, of weekdays by hours.
+type matrix struct {
+	rows, columns []string
+	values        [][]int // by row, then column
+	// columnStep labels every that many columns, from the first; 0 labels
+	// all of them that fit.
+	columnStep int
+	// cellName names the cell of a row and column in its tooltip, "row /
+	// column" when nil.
+	cellName func(row, column int) string
+}
+
+// newMatrix returns a matrix of zeros with the given rows and columns.
+func newMatrix(rows, columns []string) matrix {
+	m := matrix{rows: rows, columns: columns, values: make([][]int, len(rows))}
+	for r := range m.values {
+		m.values[r] = make([]int, len(columns))
+	}
+	return m
+}
+
+// readMatrix reads a matrix from a CSV file after a header row: a row
+// label, a column label and, if the row has a third column, the count to
+// add to their cell, otherwise one. Rows and columns keep the order they
+// first appear in.
+func readMatrix(filename string, limits inputLimits) (matrix, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return matrix{}, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(bufio.NewReaderSize(file, 1<<16))
+	reader.FieldsPerRecord = -1
+	if _, err := reader.Read(); err != nil {
+		return matrix{}, err
+	}
+	type entry struct{ row, column, count int }
+	var (
+		entries         []entry
+		rows, columns   []string
+		rowAt, columnAt = map[string]int{}, map[string]int{}
+	)
+	index := func(label string, labels *[]string, at map[string]int) int {
+		i, ok := at[label]
+		if !ok {
+			i = len(*labels)
+			at[label] = i
+			*labels = append(*labels, label)
+		}
+		return i
+	}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return matrix{}, err
+		}
+		if err := limits.checkRows(row); err != nil {
+			return matrix{}, err
+		}
+		if len(record) < 2 {
+			return matrix{}, malformedf("row %d: want a row label, a column label and optionally a count", row)
+		}
+		count := 1
+		if len(record) > 2 {
+			if count, err = strconv.Atoi(strings.TrimSpace(record[2])); err != nil || count < 0 || count > limits.MaxCount {
+				return matrix{}, malformedf("row %d: count %q is not a whole number from 0 to %d", row, record[2], limits.MaxCount)
+			}
+		}
+		e := entry{
+			row:    index(strings.TrimSpace(record[0]), &rows, rowAt),
+			column: index(strings.TrimSpace(record[1]), &columns, columnAt),
+			count:  count,
+		}
+		if len(rows) > maxMatrixLabels || len(columns) > maxMatrixLabels {
+			return matrix{}, malformedf("row %d: more than %d distinct rows or columns", row, maxMatrixLabels)
+		}
+		entries = append(entries, e)
+	}
+	m := newMatrix(rows, columns)
+	for _, e := range entries {
+		m.values[e.row][e.column] += e.count
+	}
+	return m, nil
+}
+
+// counts returns the counts of the cells of m, sorted, as color scales take
+// them.
+func (m matrix) counts() []int {
+	var counts []int
+	for _, row := range m.values {
+		counts = append(counts, row...)
+	}
+	sort.Ints(counts)
+	return counts
+}
+
+// total returns the sum of the cells of m.
+func (m matrix) total() int {
+	total := 0
+	for _, row := range m.values {
+		for _, n := range row {
+			total += n
+		}
+	}
+	return total
+}
+
+// largest returns the row and column of the cell of m with the most, the
+// first on ties, and its count.
+func (m matrix) largest() (int, int, int) {
+	var row, column, most int
+	for r, values := range m.values {
+		for c, n := range values {
+			if n > most {
+				row, column, most = r, c, n
+			}
+		}
+	}
+	return row, column, most
+}
+
+// name returns what the tooltip of the cell of a row and column calls it.
+func (m matrix) name(row, column int) string {
+	if m.cellName != nil {
+		return m.cellName(row, column)
+	}
+	return m.rows[row] + " / " + m.columns[column]
+}
+
+// matrixLayout arranges m as a grid of its rows, each under the last, with
+// their labels to the left and those of the columns above, colored by
+// scale, whose legend goes to the right.
+func matrixLayout(m matrix, scale colorScale, opts renderOptions) layout {
+	cell, gap := opts.cellSize(), opts.Theme.Gap
+	face := opts.Theme.newFace()
+	top := titleHeight + monthHeight
+	// Room for the widest row label, and no less than the weekday names
+	// of the punch card have.
+	left := weekdayWidth
+	for _, label := range m.rows {
+		left = max(left, font.MeasureString(face, label).Ceil()+15)
+	}
+	gridWidth := len(m.columns)*(cell+gap) - gap
+	l := layout{width: left + gridWidth + legendWidth, height: top + len(m.rows)*(cell+gap) - gap + 10}
+
+	l.labels = append(l.labels, layoutText{10, 25, opts.Title})
+	step := max(m.columnStep, 1)
+	for c := 0; c < len(m.columns); c += step {
+		l.addLabel(face, layoutText{left + c*(cell+gap), titleHeight + 15, m.columns[c]})
+	}
+	for r, values := range m.values {
+		y := top + r*(cell+gap)
+		l.addLabel(face, layoutText{10, y + cell/2 + 4, m.rows[r]})
+		for c, n := range values {
+			x := left + c*(cell+gap)
+			l.cells = append(l.cells, layoutCell{
+				rect:  image.Rect(x, y, x+cell, y+cell),
+				count: n,
+				color: scale.colorFor(n),
+				label: m.name(r, c),
+			})
+		}
+	}
+	l.addLegend(face, heatmap{scale: scale}, opts, left+gridWidth+10, top+10)
+	return l
+}
+
+// addFooter writes a line of statistics below everything else.
+func (l *layout) addFooter(line string) {
+	l.labels = append(l.labels, layoutText{10, l.height + stripHeight - 8, line})
+	l.height += stripHeight
+}
+
+// matrixFooter returns the total of m and its largest cell, for images of
+// t.
+func matrixFooter(m matrix, t theme) string {
+	line := t.labelf("Total: %s", formatCount(m.total()))
+	if r, c, most := m.largest(); most > 0 {
+		line += t.labelf("   Largest: %s (%s)", m.name(r, c), formatCount(most))
+	}
+	return line
+}
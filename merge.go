@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sourceSpec is one source of data: what loadTweets needs to read it, and
+// how long to wait for it.
+type sourceSpec struct {
+	label   string
+	name    string
+	input   string
+	options sourceOptions
+	timeout time.Duration
+}
+
+// fetched is the outcome of reading one source.
+type fetched struct {
+	tweets  []DailyTweet
+	title   string
+	err     error
+	elapsed time.Duration
+}
+
+// mergeSpecs returns the sources of the [[merge]] tables of the config file,
+// whose data is added to that of the command's own source:
+//
+//	[[merge]]
+//	name = "work"
+//	source = "toggl"
+//	timeout = "30s"
+//
+// Keys are the flags of the source, -source-timeout as timeout, and an
+// optional name used in messages; weight is the source's under the sum and
+// weighted strategies. Tables start from the flag defaults, not from the
+// command's own source.
+func (f *sourceFlags) mergeSpecs(fs *flag.FlagSet) ([]sourceSpec, error) {
+	config, err := loadConfig(fs.Lookup("config").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := config["merge"]
+	if !ok {
+		return nil, nil
+	}
+	tables, ok := raw.([]map[string]interface{})
+	if !ok {
+		return nil, errorf("config: merge must be an array of tables ([[merge]])")
+	}
+
+	var specs []sourceSpec
+	for i, table := range tables {
+		spec, err := f.newMergeSpec(table)
+		if err != nil {
+			return nil, errorf("config: merge %d: %w", i+1, err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func (f *sourceFlags) newMergeSpec(table map[string]interface{}) (sourceSpec, error) {
+	mergeFS := flag.NewFlagSet("merge", flag.ContinueOnError)
+	mergeFS.SetOutput(io.Discard)
+	source := addSourceFlags(mergeFS)
+	source.timeout = f.timeout
+
+	label := ""
+	for key, value := range table {
+		switch key {
+		case "name":
+			label = fmt.Sprint(value)
+			continue
+		case "timeout":
+			d, err := time.ParseDuration(fmt.Sprint(value))
+			if err != nil {
+				return sourceSpec{}, errorf("timeout: %w", err)
+			}
+			source.timeout = d
+			continue
+		}
+		if key == "config" || key == "source-timeout" || key == "on-source-error" || key == "merge-strategy" || key == "transform" || mergeFS.Lookup(key) == nil {
+			return sourceSpec{}, errorf("unknown setting %q", key)
+		}
+		if err := setFlag(mergeFS, key, value); err != nil {
+			return sourceSpec{}, errorf("%s: %w", key, err)
+		}
+	}
+	if err := checkMerge("sum", source.options.Weight); err != nil {
+		return sourceSpec{}, err
+	}
+	spec := source.spec(source.input)
+	if label != "" {
+		spec.label = label
+	}
+	return spec, nil
+}
+
+// spec describes the source of the flags reading input.
+func (f *sourceFlags) spec(input string) sourceSpec {
+	label := f.name
+	if input != "" {
+		label += " " + input
+	}
+	return sourceSpec{label: label, name: f.name, input: input, options: f.options, timeout: f.timeout}
+}
+
+// fetch reads the source, giving up after its timeout or when parent ends.
+// The source's context ends then too; a source that does not stop is left
+// to finish in the background and its result dropped.
+func (s sourceSpec) fetch(parent context.Context) fetched {
+	ctx, cancel := context.WithCancel(parent)
+	if s.timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, s.timeout)
+	}
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan fetched, 1)
+	go func() {
+		tweets, title, err := loadTweets(ctx, s.name, s.input, s.options)
+		if err == nil {
+			err = s.options.Limits.checkCounts(tweets)
+		}
+		done <- fetched{tweets: tweets, title: title, err: err, elapsed: time.Since(start)}
+	}()
+	select {
+	case r := <-done:
+		return r
+	case <-ctx.Done():
+		if err := parent.Err(); err != nil {
+			return fetched{err: inputError(err), elapsed: time.Since(start)}
+		}
+		return fetched{err: inputError(errorf("no data after %s", s.timeout)), elapsed: s.timeout}
+	}
+}
+
+// fetchAll reads the sources concurrently.
+func fetchAll(ctx context.Context, specs []sourceSpec) []fetched {
+	results := make([]fetched, len(specs))
+	var wg sync.WaitGroup
+	for i, s := range specs {
+		wg.Add(1)
+		go func(i int, s sourceSpec) {
+			defer wg.Done()
+			results[i] = s.fetch(ctx)
+		}(i, s)
+	}
+	wg.Wait()
+	return results
+}
+
+// mergeFetched combines the data of the sources per day by the strategy,
+// each source's days normalized first so a repeated day counts once as for
+// a single source. The title is that of the first source read. Under the
+// skip policy failed sources are logged and left out, as long as one
+// succeeded.
+func mergeFetched(specs []sourceSpec, results []fetched, policy, strategy string) ([]DailyTweet, string, error) {
+	days := make(map[civilDate][]mergedCount)
+	title := ""
+	var failures []string
+	var firstErr error
+	for i, r := range results {
+		s := specs[i]
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = errorf("%s: %w", s.label, classifyLoadError(r.err))
+			}
+			failures = append(failures, s.label)
+			if policy == "skip" {
+				slog.Warn("source skipped", "source", s.label, "err", r.err, "elapsed", r.elapsed)
+			}
+			continue
+		}
+		slog.Debug("data loaded", "source", s.label, "days", len(r.tweets), "elapsed", r.elapsed)
+		if title == "" {
+			title = r.title
+		}
+		tweets, _ := normalizeTweets(r.tweets)
+		for _, tweet := range tweets {
+			key := civil(tweet.Date)
+			days[key] = append(days[key], mergedCount{tweet.Count, s.options.Weight})
+		}
+	}
+
+	switch {
+	case len(failures) == 0:
+	case policy == "fail" || len(failures) == len(specs):
+		return nil, "", firstErr
+	default:
+		slog.Warn("merged data is incomplete", "failed", strings.Join(failures, ", "), "sources", len(specs))
+	}
+	totals := make(map[civilDate]int, len(days))
+	combine := mergeStrategies[strategy]
+	for date, counts := range days {
+		totals[date] = int(math.Round(combine(counts)))
+	}
+	return dailyTotals(totals), title, nil
+}
+
+// mergedCount is the count a source gives a day, with the source's weight.
+type mergedCount struct {
+	count  int
+	weight float64
+}
+
+// mergeStrategies combine the counts sources give a day, in the order of
+// the sources: the command's own first, then the [[merge]] tables. Mirrored
+// accounts that see the same events suit max or first; devices that each
+// see some suit sum; overlapping estimates suit weighted, the mean of the
+// counts by weight.
+var mergeStrategies = map[string]func([]mergedCount) float64{
+	"sum": func(counts []mergedCount) float64 {
+		total := 0.0
+		for _, c := range counts {
+			total += float64(c.count) * c.weight
+		}
+		return total
+	},
+	"max": func(counts []mergedCount) float64 {
+		most := counts[0].count
+		for _, c := range counts[1:] {
+			most = max(most, c.count)
+		}
+		return float64(most)
+	},
+	"min": func(counts []mergedCount) float64 {
+		least := counts[0].count
+		for _, c := range counts[1:] {
+			least = min(least, c.count)
+		}
+		return float64(least)
+	},
+	"first": func(counts []mergedCount) float64 {
+		return float64(counts[0].count)
+	},
+	"weighted": func(counts []mergedCount) float64 {
+		var total, weights float64
+		for _, c := range counts {
+			total += float64(c.count) * c.weight
+			weights += c.weight
+		}
+		if weights == 0 {
+			return 0
+		}
+		return total / weights
+	},
+}
+
+// mergeStrategyNames lists the strategies for flag help.
+var mergeStrategyNames = []string{"sum", "max", "min", "first", "weighted"}
+
+// checkMerge validates -merge-strategy and -weight.
+func checkMerge(strategy string, weight float64) error {
+	if _, ok := mergeStrategies[strategy]; !ok {
+		return usageError(trf("unknown merge strategy %q (available: %s)", strategy, strings.Join(mergeStrategyNames, ", ")))
+	}
+	if math.IsNaN(weight) || math.IsInf(weight, 0) || weight < 0 {
+		return usageError(trf("weight must be a number of at least 0, not %v", weight))
+	}
+	return nil
+}
+
+// sourceErrorPolicies are the values of -on-source-error.
+var sourceErrorPolicies = map[string]bool{"fail": true, "skip": true}
+
+func checkSourceErrorPolicy(policy string) error {
+	if !sourceErrorPolicies[policy] {
+		return usageError(trf("-on-source-error must be fail or skip, not %q", policy))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// renderBuckets are the upper bounds, in seconds, of the render latency
+// histogram.
+var renderBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// serverMetrics collects what the server exposes at /metrics in the
+// Prometheus text format.
+type serverMetrics struct {
+	mu           sync.Mutex
+	requests     map[int]uint64    // by status code
+	renders      map[string]uint64 // by format
+	renderCounts []uint64          // per bucket, not cumulative
+	renderSum    float64
+	renderTotal  uint64
+	dataErrors   uint64
+	cacheHits    uint64
+	cacheMisses  uint64
+	notModified  uint64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests:     make(map[int]uint64),
+		renders:      make(map[string]uint64),
+		renderCounts: make([]uint64, len(renderBuckets)+1),
+	}
+}
+
+func (m *serverMetrics) observeRender(format string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renders[format]++
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(renderBuckets, seconds)
+	m.renderCounts[i]++
+	m.renderSum += seconds
+	m.renderTotal++
+}
+
+func (m *serverMetrics) observeRequest(status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[status]++
+}
+
+func (m *serverMetrics) dataError() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dataErrors++
+}
+
+// cacheResult records how an image request was satisfied: from the client's
+// cache (304), the server's cache, or by rendering.
+func (m *serverMetrics) cacheResult(result string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch result {
+	case "not_modified":
+		m.notModified++
+	case "hit":
+		m.cacheHits++
+	case "miss":
+		m.cacheMisses++
+	}
+}
+
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+func (m *serverMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP heatmap_http_requests_total HTTP requests for images, by status code.")
+	fmt.Fprintln(w, "# TYPE heatmap_http_requests_total counter")
+	codes := make([]int, 0, len(m.requests))
+	for code := range m.requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "heatmap_http_requests_total{code=\"%d\"} %d\n", code, m.requests[code])
+	}
+
+	fmt.Fprintln(w, "# HELP heatmap_renders_total Images rendered, by format.")
+	fmt.Fprintln(w, "# TYPE heatmap_renders_total counter")
+	formats := make([]string, 0, len(m.renders))
+	for format := range m.renders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	for _, format := range formats {
+		fmt.Fprintf(w, "heatmap_renders_total{format=%q} %d\n", format, m.renders[format])
+	}
+
+	fmt.Fprintln(w, "# HELP heatmap_render_duration_seconds Time spent rendering and encoding an image.")
+	fmt.Fprintln(w, "# TYPE heatmap_render_duration_seconds histogram")
+	var cumulative uint64
+	for i, le := range renderBuckets {
+		cumulative += m.renderCounts[i]
+		fmt.Fprintf(w, "heatmap_render_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "heatmap_render_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.renderTotal)
+	fmt.Fprintf(w, "heatmap_render_duration_seconds_sum %g\n", m.renderSum)
+	fmt.Fprintf(w, "heatmap_render_duration_seconds_count %d\n", m.renderTotal)
+
+	fmt.Fprintln(w, "# HELP heatmap_data_errors_total Failures to load the data for a request.")
+	fmt.Fprintln(w, "# TYPE heatmap_data_errors_total counter")
+	fmt.Fprintf(w, "heatmap_data_errors_total %d\n", m.dataErrors)
+
+	fmt.Fprintln(w, "# HELP heatmap_cache_requests_total Image requests by how they were satisfied: not_modified (304), hit (server cache), or miss (rendered).")
+	fmt.Fprintln(w, "# TYPE heatmap_cache_requests_total counter")
+	fmt.Fprintf(w, "heatmap_cache_requests_total{result=\"not_modified\"} %d\n", m.notModified)
+	fmt.Fprintf(w, "heatmap_cache_requests_total{result=\"hit\"} %d\n", m.cacheHits)
+	fmt.Fprintf(w, "heatmap_cache_requests_total{result=\"miss\"} %d\n", m.cacheMisses)
+
+	fmt.Fprintln(w, "# HELP heatmap_cache_hit_ratio Share of image requests served without rendering.")
+	fmt.Fprintln(w, "# TYPE heatmap_cache_hit_ratio gauge")
+	ratio := 0.0
+	if total := m.notModified + m.cacheHits + m.cacheMisses; total > 0 {
+		ratio = float64(m.notModified+m.cacheHits) / float64(total)
+	}
+	fmt.Fprintf(w, "heatmap_cache_hit_ratio %g\n", ratio)
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
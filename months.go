@@ -0,0 +1,88 @@
+package main
+
+import (
+	"image"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// yearLabelWidth is the room left of the months layout for the years.
+const yearLabelWidth = 50
+
+// monthTotals adds up the days of hm from the month of its first day with
+// data, or of opts.From, to the month of its last, or of opts.To, and
+// returns the first day of each month with its total, months without data
+// counting zero.
+func monthTotals(hm heatmap, opts renderOptions) []DailyTweet {
+	var first, last time.Time
+	totals := make(map[time.Time]int)
+	for key, count := range hm.counts {
+		date := key.time()
+		if (!opts.From.IsZero() && date.Before(opts.From)) || (!opts.To.IsZero() && date.After(opts.To)) {
+			continue
+		}
+		month := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		totals[month] += count
+		if first.IsZero() || month.Before(first) {
+			first = month
+		}
+		if month.After(last) {
+			last = month
+		}
+	}
+	if first.IsZero() {
+		return nil
+	}
+	var months []DailyTweet
+	for m := first; !m.After(last); m = addDate(m, 0, 1, 0) {
+		months = append(months, DailyTweet{Date: m, Count: totals[m]})
+	}
+	return months
+}
+
+// monthsLayout arranges the monthly totals of hm as a row of twelve months
+// for each year, the oldest on top, colored by a scale of their own, so a
+// decade of data fits one picture where the year of weeks shows one year.
+// Months cells are twice as wide as day cells.
+func monthsLayout(hm heatmap, opts renderOptions) layout {
+	cell, gap := opts.cellSize(), opts.Theme.Gap
+	face := opts.Theme.newFace()
+	months := monthTotals(hm, opts)
+
+	counts := make([]int, len(months))
+	for i, m := range months {
+		counts[i] = m.Count
+	}
+	sort.Ints(counts)
+	scale := newColorScale(counts, opts)
+
+	width, top := 2*cell, titleHeight+monthHeight
+	gridWidth := monthsInYear*(width+gap) - gap
+	l := layout{width: yearLabelWidth + gridWidth + legendWidth, height: top}
+	l.labels = append(l.labels, layoutText{10, 25, opts.Title})
+	for m, name := range monthNames {
+		l.addLabel(face, layoutText{yearLabelWidth + m*(width+gap), titleHeight + 15, opts.Theme.label(name)})
+	}
+	firstYear := 0
+	if len(months) > 0 {
+		firstYear = months[0].Date.Year()
+	}
+	for _, m := range months {
+		row := m.Date.Year() - firstYear
+		x, y := yearLabelWidth+int(m.Date.Month()-1)*(width+gap), top+row*(cell+gap)
+		if m.Date.Month() == time.January || len(l.cells) == 0 {
+			l.addLabel(face, layoutText{10, y + cell/2 + 4, strconv.Itoa(m.Date.Year())})
+		}
+		l.cells = append(l.cells, layoutCell{
+			rect:  image.Rect(x, y, x+width, y+cell),
+			date:  m.Date,
+			count: m.Count,
+			color: scale.colorFor(m.Count),
+			label: m.Date.Format("2006-01"),
+		})
+		l.height = max(l.height, y+cell+10)
+	}
+	l.addLegend(face, heatmap{scale: scale}, opts, yearLabelWidth+gridWidth+10, top+10)
+	return l
+}
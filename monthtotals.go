@@ -0,0 +1,102 @@
+package main
+
+import (
+	"image"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+)
+
+// monthTotalStyles are how -month-totals gives the total of each month
+// under its columns: not at all, as a number, or as a cell of a scale of
+// the totals.
+var monthTotalStyles = []string{"none", "labels", "cells"}
+
+// monthTotalsHeight is the height of the row of month totals with the room
+// above it.
+const monthTotalsHeight = 20
+
+// checkMonthTotals validates -month-totals, returning "" for none. Only the
+// year of weeks has month columns to line them up with.
+func checkMonthTotals(style string, opts renderOptions) (string, error) {
+	switch style {
+	case "none":
+		return "", nil
+	case "labels", "cells":
+		if opts.Layout != "" || opts.Card {
+			return "", usageError(tr("-month-totals lines up with the weeks of the year layout; it does not apply to -layout or -card"))
+		}
+		return style, nil
+	}
+	return "", usageError(trf("unknown month totals style %q (available: %s)", style, strings.Join(monthTotalStyles, ", ")))
+}
+
+// gridBottom returns the bottom edge of the grid of the year layout.
+func gridBottom(cell, gap int) int {
+	return titleHeight + monthHeight + daysInWeek*(cell+gap) - gap
+}
+
+// addMonthTotals gives the total of the days of each month in the grid of
+// hm in a row from top down, under the columns of the weeks the month
+// falls in: as its number, centered, where it fits, or as a cell across
+// them colored by a scale of the totals. It returns the bottom of the row.
+func (l *layout) addMonthTotals(face font.Face, hm heatmap, opts renderOptions, top int) int {
+	cell, gap := opts.cellSize(), opts.Theme.Gap
+	type span struct {
+		month       time.Time
+		first, last int // weeks
+		total       int
+	}
+	var spans []span
+	for week := 0; week < numWeeks; week++ {
+		for day := 0; day < daysInWeek; day++ {
+			date := addDate(hm.start, 0, 0, week*7+day)
+			month := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+			if len(spans) == 0 || !spans[len(spans)-1].month.Equal(month) {
+				spans = append(spans, span{month: month, first: week})
+			}
+			s := &spans[len(spans)-1]
+			s.last = week
+			s.total += hm.counts[civil(date)]
+		}
+	}
+
+	bottom := top + monthTotalsHeight - 5
+	if opts.MonthTotals == "cells" {
+		counts := make([]int, len(spans))
+		for i, s := range spans {
+			counts[i] = s.total
+		}
+		sort.Ints(counts)
+		scale := newColorScale(counts, opts)
+		for i, s := range spans {
+			// Neighbouring months share the week they meet in; each keeps
+			// its half.
+			x0, x1 := s.first*(cell+gap), s.last*(cell+gap)+cell
+			if i > 0 && spans[i-1].last == s.first {
+				x0 += cell/2 + gap
+			}
+			if i < len(spans)-1 && spans[i+1].first == s.last {
+				x1 -= cell - cell/2
+			}
+			l.cells = append(l.cells, layoutCell{
+				rect:  image.Rect(x0, top+5, x1, bottom),
+				date:  s.month,
+				count: s.total,
+				color: scale.colorFor(s.total),
+				label: s.month.Format("2006-01"),
+			})
+		}
+	} else {
+		for _, s := range spans {
+			text := formatCount(s.total)
+			width := font.MeasureString(face, text).Ceil()
+			middle := (s.first*(cell+gap) + s.last*(cell+gap) + cell) / 2
+			l.addLabel(face, layoutText{max(middle-width/2, 0), bottom - 2, text})
+		}
+	}
+	l.height = max(l.height, bottom+5)
+	return bottom
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The MQTT client is the little of MQTT 3.1.1 that publishing takes:
+// connect, publish at QoS 1, waiting for each acknowledgement so nothing is
+// lost at disconnect, and disconnect.
+
+// MQTT control packet types, in the high nibble of the first byte.
+const (
+	mqttConnect    = 1 << 4
+	mqttConnack    = 2 << 4
+	mqttPublish    = 3 << 4
+	mqttPuback     = 4 << 4
+	mqttDisconnect = 14 << 4
+)
+
+// mqttTimeout bounds connecting to the broker and each exchange with it.
+const mqttTimeout = 30 * time.Second
+
+// mqttKeepAlive is the keep-alive the client asks for, in seconds; it never
+// stays connected long enough to need a ping.
+const mqttKeepAlive = 60
+
+type mqttClient struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	packetID uint16
+}
+
+// parseBroker parses an mqtt:// or mqtts:// broker URL, filling in the
+// default port of each.
+func parseBroker(broker string) (*url.URL, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+	var port string
+	switch u.Scheme {
+	case "mqtt":
+		port = "1883"
+	case "mqtts":
+		port = "8883"
+	default:
+		return nil, errorf("%q is not an mqtt:// or mqtts:// URL", broker)
+	}
+	if u.Hostname() == "" {
+		return nil, errorf("%q names no host", broker)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+// dialMQTT connects to the broker, over TLS for mqtts://, with the user and
+// password when user is given.
+func dialMQTT(broker, user, password string) (*mqttClient, error) {
+	u, err := parseBroker(broker)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	if u.Scheme == "mqtts" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", u.Host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", u.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &mqttClient{conn: conn, r: bufio.NewReader(conn)}
+
+	var body []byte
+	body = mqttString(body, "MQTT")
+	body = append(body, 4) // protocol level 3.1.1
+	flags := byte(0x02)    // clean session
+	if user != "" {
+		flags |= 0x80
+		if password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, mqttKeepAlive)
+	body = mqttString(body, "heatmap-generator-"+strconv.Itoa(os.Getpid()))
+	if user != "" {
+		body = mqttString(body, user)
+		if password != "" {
+			body = mqttString(body, password)
+		}
+	}
+	if err := c.write(mqttConnect, body); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	kind, reply, err := c.read()
+	switch {
+	case err != nil:
+	case kind != mqttConnack || len(reply) != 2:
+		err = errors.New(tr("broker did not acknowledge the connection"))
+	case reply[1] != 0:
+		err = errorf("broker refused the connection: %s", mqttRefusals[reply[1]])
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// mqttRefusals are the reasons of CONNACK return codes.
+var mqttRefusals = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// publish publishes payload to topic at QoS 1 and waits for the broker to
+// acknowledge it.
+func (c *mqttClient) publish(topic string, payload []byte, retain bool) error {
+	c.packetID++
+	body := mqttString(nil, topic)
+	body = binary.BigEndian.AppendUint16(body, c.packetID)
+	body = append(body, payload...)
+	kind := byte(mqttPublish | 0x02) // QoS 1
+	if retain {
+		kind |= 0x01
+	}
+	if err := c.write(kind, body); err != nil {
+		return err
+	}
+	reply, ack, err := c.read()
+	if err != nil {
+		return err
+	}
+	if reply != mqttPuback || len(ack) != 2 || binary.BigEndian.Uint16(ack) != c.packetID {
+		return errorf("broker did not acknowledge publishing to %s", topic)
+	}
+	return nil
+}
+
+// close disconnects from the broker.
+func (c *mqttClient) close() error {
+	c.write(mqttDisconnect, nil)
+	return c.conn.Close()
+}
+
+// write sends a packet of the given first byte and body.
+func (c *mqttClient) write(kind byte, body []byte) error {
+	packet := []byte{kind}
+	// The remaining length takes seven bits a byte, low bits first.
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	c.conn.SetDeadline(time.Now().Add(mqttTimeout))
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+// read receives a packet, returning its type and body.
+func (c *mqttClient) read() (byte, []byte, error) {
+	c.conn.SetDeadline(time.Now().Add(mqttTimeout))
+	kind, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New(tr("malformed packet from broker"))
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return kind & 0xf0, body, nil
+}
+
+// mqttString appends s to b as MQTT encodes strings, after their length.
+func mqttString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// notifyFlags are the flags that send the finished heatmap to a chat.
+type notifyFlags struct {
+	imageURL       string
+	caption        string
+	slackWebhook   string
+	slackChannel   string
+	discordWebhook string
+	telegramChat   string
+	email          *emailFlags
+	hass           *hassFlags
+}
+
+func addNotifyFlags(fs *flag.FlagSet) *notifyFlags {
+	n := &notifyFlags{}
+	fs.StringVar(&n.imageURL, "image-url", "", "public URL of the published image, shown in messages")
+	fs.StringVar(&n.caption, "caption", "", "Go template of the message text, e.g. '{{.Title}}: {{.Total}} ({{.CurrentStreak}}-day streak)'")
+	fs.StringVar(&n.slackWebhook, "slack-webhook", "", "post a summary to this Slack incoming webhook URL")
+	fs.StringVar(&n.slackChannel, "slack-channel", "", "upload the image with a summary to this Slack channel ID (needs $SLACK_BOT_TOKEN)")
+	fs.StringVar(&n.discordWebhook, "discord-webhook", "", "post the image with a summary to this Discord webhook URL")
+	fs.StringVar(&n.telegramChat, "telegram-chat", "", "send the image with a summary to this Telegram chat ID (needs $TELEGRAM_BOT_TOKEN)")
+	n.email = addEmailFlags(fs)
+	n.hass = addHassFlags(fs)
+	return n
+}
+
+// captionData is what -caption templates can refer to.
+type captionData struct {
+	Title                        string
+	From, To                     string
+	Total, ActiveDays            int
+	BestDay                      string
+	BestCount                    int
+	LongestStreak, CurrentStreak int
+	ImageURL                     string
+}
+
+// check reports mistakes in the flags before anything is rendered in
+// format.
+func (f *notifyFlags) check(format string) error {
+	if _, err := f.parseCaption(); err != nil {
+		return err
+	}
+	if f.email.to != "" {
+		if _, err := f.email.recipients(); err != nil {
+			return err
+		}
+		if _, err := f.email.sender(); err != nil {
+			return err
+		}
+	}
+	return f.hass.check(format)
+}
+
+// parseCaption parses the -caption template, if any.
+func (f *notifyFlags) parseCaption() (*template.Template, error) {
+	if f.caption == "" {
+		return nil, nil
+	}
+	return parseTemplate("caption", f.caption)
+}
+
+// parseTemplate parses the text of a template flag over captionData. The
+// commas function writes numbers with thousands separators.
+func parseTemplate(flagName, text string) (*template.Template, error) {
+	t, err := template.New(flagName).Funcs(template.FuncMap{"commas": formatCount}).Parse(text)
+	if err == nil {
+		// Fields that do not exist only show when the template runs.
+		err = t.Execute(io.Discard, captionData{})
+	}
+	if err != nil {
+		return nil, usageError(trf("invalid -%s: %v", flagName, err))
+	}
+	return t, nil
+}
+
+func newCaptionData(title string, sum summary, imageURL string) captionData {
+	return captionData{
+		Title:         title,
+		From:          sum.from.Format("2006-01-02"),
+		To:            sum.to.Format("2006-01-02"),
+		Total:         sum.total,
+		ActiveDays:    sum.active,
+		BestDay:       sum.best.Date.Format("2006-01-02"),
+		BestCount:     sum.best.Count,
+		LongestStreak: sum.longestStreak,
+		CurrentStreak: sum.currentStreak,
+		ImageURL:      imageURL,
+	}
+}
+
+// notification is a finished heatmap as messages present it.
+type notification struct {
+	title       string
+	caption     string // first line is the title
+	filename    string
+	contentType string
+	data        []byte
+	imageURL    string // empty when the image is not hosted anywhere
+}
+
+// text describes the heatmap in a few lines of plain text.
+func (n notification) text() string {
+	if n.imageURL != "" && !strings.Contains(n.caption, n.imageURL) {
+		return n.caption + "\n" + n.imageURL
+	}
+	return n.caption
+}
+
+// send delivers the notification to every destination the flags name.
+func (f *notifyFlags) send(title, output, contentType string, data []byte, tweets []DailyTweet) error {
+	if f.slackWebhook == "" && f.slackChannel == "" && f.discordWebhook == "" && f.telegramChat == "" && f.email.to == "" && !f.hass.enabled() {
+		return nil
+	}
+
+	sum := summarize(tweets)
+	n := notification{
+		title:       title,
+		filename:    filepath.Base(output),
+		contentType: contentType,
+		data:        data,
+		imageURL:    f.imageURL,
+	}
+
+	tmpl, err := f.parseCaption()
+	if err != nil {
+		return err
+	}
+	if tmpl == nil {
+		n.caption = fmt.Sprintf("%s\n%s to %s: %d in total over %d active %s, best day %s (%d), longest streak %d %s",
+			title, sum.from.Format("2006-01-02"), sum.to.Format("2006-01-02"),
+			sum.total, sum.active, plural(sum.active, "day", "days"), sum.best.Date.Format("2006-01-02"), sum.best.Count,
+			sum.longestStreak, plural(sum.longestStreak, "day", "days"))
+	} else {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, newCaptionData(title, sum, f.imageURL)); err != nil {
+			return usageError(trf("invalid -caption: %v", err))
+		}
+		n.caption = b.String()
+	}
+
+	if f.slackWebhook != "" {
+		if err := postSlackWebhook(f.slackWebhook, n); err != nil {
+			return publishError(errorf("posting to Slack: %w", err))
+		}
+		slog.Info("posted to Slack webhook")
+	}
+	if f.slackChannel != "" {
+		if err := uploadSlack(f.slackChannel, n); err != nil {
+			return publishError(errorf("uploading to Slack: %w", err))
+		}
+		slog.Info("uploaded to Slack", "channel", f.slackChannel)
+	}
+	if f.discordWebhook != "" {
+		if err := postDiscord(f.discordWebhook, n); err != nil {
+			return publishError(errorf("posting to Discord: %w", err))
+		}
+		slog.Info("posted to Discord webhook")
+	}
+	if f.telegramChat != "" {
+		if err := sendTelegram(f.telegramChat, n); err != nil {
+			return publishError(errorf("sending to Telegram: %w", err))
+		}
+		slog.Info("sent to Telegram", "chat", f.telegramChat)
+	}
+	if f.email.to != "" {
+		if err := f.email.sendEmail(n); err != nil {
+			var ue usageError
+			if errors.As(err, &ue) {
+				return err
+			}
+			return publishError(errorf("sending email: %w", err))
+		}
+		slog.Info("email sent", "to", f.email.to)
+	}
+	if f.hass.enabled() {
+		return f.hass.send(n, newCaptionData(title, sum, f.imageURL))
+	}
+	return nil
+}
+
+// postJSON sends v as the JSON body of a POST request to a webhook. Only
+// the host of the URL shows in logs and errors.
+func postJSON(rawURL string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", rawURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return sendAs(req, req.URL.Host)
+}
+
+// postMultipart sends fields and a file as a multipart/form-data POST.
+// name stands in for the URL in logs and errors.
+func postMultipart(rawURL, name string, fields [][2]string, fileField string, n notification) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, field := range fields {
+		if err := w.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, fileField, n.filename))
+	header.Set("Content-Type", n.contentType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(n.data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", rawURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return sendAs(req, name)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// outputFormats maps each supported output format to its content type.
+var outputFormats = map[string]string{
+	"png": "image/png",
+	"svg": "image/svg+xml",
+	"txt": "text/plain; charset=utf-8",
+	// A spreadsheet of the year grid with the scale as conditional
+	// formatting.
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	// Terminal escape sequences around the PNG, for cat-ing to a terminal.
+	"sixel": "application/octet-stream",
+	"iterm": "application/octet-stream",
+}
+
+// formatForFile picks the output format from a file name's extension,
+// defaulting to PNG.
+func formatForFile(filename string) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	if _, ok := outputFormats[ext]; ok {
+		return ext
+	}
+	return "png"
+}
+
+// renderHeatmap draws tweets in the given format, stopping with the error
+// of ctx when it ends.
+func renderHeatmap(ctx context.Context, format string, tweets []DailyTweet, opts renderOptions) ([]byte, error) {
+	if wrap, ok := terminalFormats[format]; ok {
+		data, err := renderHeatmap(ctx, "png", tweets, opts)
+		if err != nil {
+			return nil, err
+		}
+		return wrap(data)
+	}
+	if opts.Card {
+		if format != "png" {
+			return nil, usageError(tr("social cards are PNG only"))
+		}
+		start := time.Now()
+		img, err := generateCard(tweets, opts)
+		timings.record("draw", start)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		defer timings.record("encode", time.Now())
+		return encodeImage(img, opts)
+	}
+	switch format {
+	case "txt":
+		return renderText(tweets, opts)
+	case "xlsx":
+		return renderXLSX(tweets, opts)
+	}
+	return renderWith(ctx, format, tweets, opts)
+}
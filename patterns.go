@@ -0,0 +1,87 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// Patterns mark the levels of the scale between the least and the most
+// with marks of more ink the higher the level, so a heatmap printed or
+// photocopied in black and white, where shades run together, still reads:
+// a dot, then lines, then a grid. The lowest level and the highest, near
+// white and near black in the print theme, are left plain.
+var patternKinds = []func(r image.Rectangle, step int) []image.Rectangle{
+	patternDots,
+	patternLines,
+	patternGrid,
+}
+
+// checkPatterns validates -patterns, which marks square cells.
+func checkPatterns(on bool, opts renderOptions) (bool, error) {
+	if !on {
+		return false, nil
+	}
+	switch {
+	case opts.Card:
+		return false, usageError(tr("social cards draw their own grid; -patterns does not apply"))
+	case opts.Layout != "" && layoutKinds[opts.Layout].polar:
+		return false, usageError(trf("-layout %s draws days as ring sectors; -patterns marks square cells", opts.Layout))
+	}
+	return true, nil
+}
+
+// addPatterns marks the cells and legend swatches of l with the pattern of
+// their color's level in scale, in whichever of the theme's text and
+// background colors stands out more on them. Colors the scale has no level
+// for, such as categories, are left plain.
+func (l *layout) addPatterns(scale colorScale, t theme) {
+	entries := scale.legendEntries()
+	levels := make(map[color.RGBA]int, len(entries))
+	for i, entry := range entries {
+		if _, ok := levels[entry.color]; !ok {
+			levels[entry.color] = i
+		}
+	}
+	mark := func(r image.Rectangle, c color.RGBA) {
+		level, ok := levels[c]
+		if !ok || level == 0 || level == len(entries)-1 {
+			return
+		}
+		kind := patternKinds[(level-1)*len(patternKinds)/(len(entries)-2)]
+		ink := contrasting(t, c)
+		for _, m := range kind(r, max(3, r.Dx()/3)) {
+			l.marks = append(l.marks, layoutSwatch{rect: m, color: ink})
+		}
+	}
+	for _, c := range l.cells {
+		mark(c.rect, c.color)
+	}
+	for _, s := range l.legend {
+		mark(s.rect, s.color)
+	}
+}
+
+// patternDots puts a dot in the middle of r.
+func patternDots(r image.Rectangle, step int) []image.Rectangle {
+	size := max(1, r.Dx()/5)
+	c := r.Min.Add(image.Pt((r.Dx()-size)/2, (r.Dy()-size)/2))
+	return []image.Rectangle{image.Rectangle{Min: c, Max: c.Add(image.Pt(size, size))}.Intersect(r)}
+}
+
+// patternLines draws lines across r every step pixels.
+func patternLines(r image.Rectangle, step int) []image.Rectangle {
+	var marks []image.Rectangle
+	for y := r.Min.Y + step/2; y < r.Max.Y; y += step {
+		marks = append(marks, image.Rect(r.Min.X, y, r.Max.X, y+1))
+	}
+	return marks
+}
+
+// patternGrid draws the lines of patternLines and lines down r too.
+func patternGrid(r image.Rectangle, step int) []image.Rectangle {
+	marks := patternLines(r, step)
+	for x := r.Min.X + step/2; x < r.Max.X; x += step {
+		marks = append(marks, image.Rect(x, r.Min.Y, x+1, r.Max.Y))
+	}
+	return marks
+}
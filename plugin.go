@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+)
+
+// Plugins are executables on the PATH that add sources and publish
+// destinations: heatmap-source-NAME is the source NAME and
+// heatmap-publish-SCHEME publishes to SCHEME:// destinations. A plugin
+// reads one JSON request on its standard input and writes one JSON
+// response on its standard output; what it writes to standard error is
+// passed through. A response with an error, or a non-zero exit, is a
+// failure.
+const pluginProtocolVersion = 1
+
+// pluginNamePattern keeps plugin names from naming paths.
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// findPlugin returns the path of the plugin of the given kind and name.
+func findPlugin(kind, name string) (string, bool) {
+	if !pluginNamePattern.MatchString(name) {
+		return "", false
+	}
+	path, err := exec.LookPath("heatmap-" + kind + "-" + name)
+	return path, err == nil
+}
+
+// pluginSourceRequest asks a source plugin for its data, with the source
+// flags.
+type pluginSourceRequest struct {
+	Version int    `json:"version"`
+	Input   string `json:"input,omitempty"`
+	Project string `json:"project,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+	User    string `json:"user,omitempty"`
+}
+
+// pluginSourceResponse is the data of a source plugin, as points the
+// webhook would accept, and optionally the default title of its heatmaps.
+// Like every response it may instead carry an error, {"error": "..."}.
+type pluginSourceResponse struct {
+	Title  string         `json:"title"`
+	Points []webhookPoint `json:"points"`
+}
+
+// pluginPublishRequest asks a publish plugin to publish an image.
+type pluginPublishRequest struct {
+	Version      int    `json:"version"`
+	Destination  string `json:"destination"`
+	ContentType  string `json:"content_type"`
+	CacheControl string `json:"cache_control"`
+	Data         []byte `json:"data"` // base64 in JSON
+}
+
+// pluginPublishResponse optionally gives the URL the image is now at.
+type pluginPublishResponse struct {
+	URL string `json:"url"`
+}
+
+// pluginSource is a source served by a plugin. It remembers the title the
+// plugin gave, which loadTweets prefers to the default.
+type pluginSource struct {
+	path  string
+	input string
+	opts  sourceOptions
+	title string
+}
+
+func openPluginSource(path string) func(string, sourceOptions) (dataSource, error) {
+	return func(input string, opts sourceOptions) (dataSource, error) {
+		return &pluginSource{path: path, input: input, opts: opts}, nil
+	}
+}
+
+func (p *pluginSource) Fetch(ctx context.Context) ([]DailyTweet, error) {
+	req := pluginSourceRequest{
+		Version: pluginProtocolVersion,
+		Input:   p.input,
+		Project: p.opts.Project,
+		Tag:     p.opts.Tag,
+		User:    p.opts.User,
+	}
+	var resp pluginSourceResponse
+	if err := runPlugin(ctx, p.path, req, &resp, p.opts.Limits); err != nil {
+		return nil, err
+	}
+	if err := p.opts.Limits.checkRows(len(resp.Points)); err != nil {
+		return nil, errorf("%s: %w", filepath.Base(p.path), err)
+	}
+	totals, err := sumPoints(resp.Points)
+	if err != nil {
+		return nil, malformedf("%s: %v", filepath.Base(p.path), err)
+	}
+	p.title = resp.Title
+	return dailyTotals(totals), nil
+}
+
+func (p *pluginSource) sourceTitle() string { return p.title }
+
+// publishPlugin publishes through the plugin at path.
+func publishPlugin(path string) func(u *url.URL, up upload) error {
+	return func(u *url.URL, up upload) error {
+		req := pluginPublishRequest{
+			Version:      pluginProtocolVersion,
+			Destination:  u.String(),
+			ContentType:  up.contentType,
+			CacheControl: up.cacheControl,
+			Data:         up.data,
+		}
+		var resp pluginPublishResponse
+		if err := runPlugin(context.Background(), path, req, &resp, defaultLimits); err != nil {
+			return err
+		}
+		if resp.URL != "" {
+			slog.Info("plugin published image", "plugin", filepath.Base(path), "url", resp.URL)
+		}
+		return nil
+	}
+}
+
+// runPlugin runs the plugin at path with request as its input and decodes
+// its output, which may be at most limits.MaxBytes long, into response.
+// The plugin is killed when ctx ends.
+func runPlugin(ctx context.Context, path string, request, response interface{}, limits inputLimits) error {
+	name := filepath.Base(path)
+	in, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return errorf("%s: %w", name, err)
+	}
+	// Killing the plugin leaves what it started running, maybe holding
+	// its output open, so when ctx ends stop reading too.
+	stop := context.AfterFunc(ctx, func() { stdout.Close() })
+	out, readErr := limits.readAll(stdout, name)
+	stop()
+	if readErr != nil {
+		cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+	switch {
+	case ctx.Err() != nil:
+		return errorf("%s: %w", name, ctx.Err())
+	case readErr != nil:
+		return readErr
+	case waitErr != nil:
+		return errorf("%s: %w", name, waitErr)
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(out, &failure); err != nil {
+		return malformedf("%s: invalid response: %v", name, err)
+	}
+	if failure.Error != "" {
+		return errorf("%s: %s", name, failure.Error)
+	}
+	if err := json.Unmarshal(out, response); err != nil {
+		return malformedf("%s: invalid response: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// pngCompressionLevels maps the values of -png-compression to encoder
+// levels, trading encoding time against file size.
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"fast":    png.BestSpeed,
+	"best":    png.BestCompression,
+	"none":    png.NoCompression,
+}
+
+func pngCompressionNames() []string {
+	names := make([]string, 0, len(pngCompressionLevels))
+	for name := range pngCompressionLevels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parsePNGCompression(name string) (png.CompressionLevel, error) {
+	level, ok := pngCompressionLevels[name]
+	if !ok {
+		return 0, usageError(trf("unknown PNG compression %q (available: %s)", name, strings.Join(pngCompressionNames(), ", ")))
+	}
+	return level, nil
+}
+
+// pngBufferPool lets encoders reuse their scratch buffers, which the server
+// and batch go through for every image.
+type pngBufferPool struct{ pool sync.Pool }
+
+func (p *pngBufferPool) Get() *png.EncoderBuffer {
+	b, _ := p.pool.Get().(*png.EncoderBuffer)
+	return b
+}
+
+func (p *pngBufferPool) Put(b *png.EncoderBuffer) { p.pool.Put(b) }
+
+var (
+	pngBuffers pngBufferPool
+	pngWriters = sync.Pool{New: func() any { return bufio.NewWriterSize(nil, 32<<10) }}
+)
+
+// encodePNG encodes img as PNG at the given compression level, tagged with
+// the ICC profile given or else as sRGB, and with a Software text chunk
+// naming the build that produced it unless software is empty. The
+// encoder's many small chunk writes go through a pooled bufio.Writer.
+func encodePNG(w io.Writer, img image.Image, level png.CompressionLevel, software string, profile []byte) error {
+	bw := pngWriters.Get().(*bufio.Writer)
+	bw.Reset(w)
+	defer func() {
+		bw.Reset(nil)
+		pngWriters.Put(bw)
+	}()
+
+	enc := png.Encoder{CompressionLevel: level, BufferPool: &pngBuffers}
+	chunks, err := pngColorChunks(profile)
+	if err != nil {
+		return err
+	}
+	if software != "" {
+		chunks = append(chunks, pngTextChunk("Software", software)...)
+	}
+	if err := enc.Encode(&chunkInserter{w: bw, chunk: chunks}, img); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ihdrEnd is where the signature and IHDR chunk, which the encoder always
+// writes first, end.
+const ihdrEnd = 8 + 4 + 4 + 13 + 4
+
+// chunkInserter passes an encoded PNG through, writing chunk, which may be
+// several, right after the IHDR chunk.
+type chunkInserter struct {
+	w     io.Writer
+	n     int
+	chunk []byte // nil once written
+}
+
+func (c *chunkInserter) Write(p []byte) (int, error) {
+	written := 0
+	if c.chunk != nil && c.n+len(p) >= ihdrEnd {
+		head := ihdrEnd - c.n
+		if _, err := c.w.Write(p[:head]); err != nil {
+			return 0, err
+		}
+		if _, err := c.w.Write(c.chunk); err != nil {
+			return head, err
+		}
+		c.chunk = nil
+		c.n += head
+		written, p = head, p[head:]
+	}
+	n, err := c.w.Write(p)
+	c.n += n
+	return written + n, err
+}
+
+// toPaletted converts img to 8-bit indexed color. Heatmaps use a handful
+// of colors, so the palette is usually exact; beyond 256 colors, as with
+// the anti-aliased text of social cards, the most frequent colors are kept
+// and the rest drawn in the nearest of them.
+func toPaletted(img *image.RGBA) *image.Paletted {
+	counts := make(map[color.RGBA]int)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			counts[img.RGBAAt(x, y)]++
+		}
+	}
+	colors := make([]color.RGBA, 0, len(counts))
+	for c := range counts {
+		colors = append(colors, c)
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		if counts[colors[i]] != counts[colors[j]] {
+			return counts[colors[i]] > counts[colors[j]]
+		}
+		return rgbaKey(colors[i]) < rgbaKey(colors[j])
+	})
+	if len(colors) > 256 {
+		colors = colors[:256]
+	}
+	palette := make(color.Palette, len(colors))
+	for i, c := range colors {
+		palette[i] = c
+	}
+
+	out := image.NewPaletted(b, palette)
+	draw.Draw(out, b, img, b.Min, draw.Src)
+	return out
+}
+
+func rgbaKey(c color.RGBA) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
+
+// pngTextChunk builds a tEXt chunk holding keyword and text.
+func pngTextChunk(keyword, text string) []byte {
+	return pngChunk("tEXt", append([]byte(keyword+"\x00"), text...))
+}
+
+// pngChunk builds a chunk of the given type around data.
+func pngChunk(kind string, data []byte) []byte {
+	body := append([]byte(kind), data...)
+
+	chunk := make([]byte, 4, 4+len(body)+4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(body)-4))
+	chunk = append(chunk, body...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body))
+}
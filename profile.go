@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// profileFlags holds the profiling flags every command accepts. Profiles
+// and timings are written when the command returns; serve and daemon
+// return once interrupted.
+type profileFlags struct {
+	cpuProfile string
+	memProfile string
+	timings    bool
+
+	cpuFile *os.File
+}
+
+// profiling holds the profiling flags of the command being run.
+var profiling profileFlags
+
+func addProfileFlags(fs *flag.FlagSet) {
+	fs.StringVar(&profiling.cpuProfile, "cpuprofile", "", "write a CPU profile to this file, for go tool pprof")
+	fs.StringVar(&profiling.memProfile, "memprofile", "", "write a heap profile to this file when the command ends, for go tool pprof")
+	fs.BoolVar(&profiling.timings, "timings", false, "print to standard error how long parsing, aggregating, layout, drawing and encoding took")
+}
+
+// start starts the CPU profile, if one was asked for.
+func (p *profileFlags) start() error {
+	if p.cpuProfile == "" {
+		return nil
+	}
+	f, err := os.Create(p.cpuProfile)
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	p.cpuFile = f
+	return nil
+}
+
+// stop ends the CPU profile and writes the heap profile and timings the
+// flags ask for. Failing to is reported but does not fail the command.
+func (p *profileFlags) stop() {
+	if p.cpuFile != nil {
+		pprof.StopCPUProfile()
+		if err := p.cpuFile.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "heatmap: cpu profile: %v\n", err)
+		}
+		p.cpuFile = nil
+	}
+	if p.memProfile != "" {
+		if err := writeHeapProfile(p.memProfile); err != nil {
+			fmt.Fprintf(os.Stderr, "heatmap: memory profile: %v\n", err)
+		}
+	}
+	if p.timings {
+		timings.report(os.Stderr)
+	}
+}
+
+func writeHeapProfile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	runtime.GC() // so the profile shows live memory up to date
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// timingPhases are the phases of rendering -timings reports, in order:
+// reading and parsing the data, normalizing, merging and bucketing it,
+// placing the cells, drawing them and encoding the image.
+var timingPhases = []string{"parse", "aggregate", "layout", "draw", "encode"}
+
+// phaseTimings adds up the time spent in each phase across every image a
+// command renders, so batch and serve report their whole workload.
+type phaseTimings struct {
+	mu     sync.Mutex
+	phases map[string]*phaseTiming
+}
+
+type phaseTiming struct {
+	count      int
+	total, max time.Duration
+}
+
+var timings phaseTimings
+
+// record adds the time since start to phase, when -timings is set.
+func (t *phaseTimings) record(phase string, start time.Time) {
+	if !profiling.timings {
+		return
+	}
+	d := time.Since(start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.phases == nil {
+		t.phases = make(map[string]*phaseTiming)
+	}
+	p := t.phases[phase]
+	if p == nil {
+		p = &phaseTiming{}
+		t.phases[phase] = p
+	}
+	p.count++
+	p.total += d
+	if d > p.max {
+		p.max = d
+	}
+}
+
+// report writes a table of the phases with how often each ran and how long
+// it took in total, on average and at most.
+func (t *phaseTimings) report(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "phase\tcount\ttotal\tmean\tmax\t")
+	for _, name := range timingPhases {
+		p := t.phases[name]
+		if p == nil {
+			fmt.Fprintf(tw, "%s\t0\t-\t-\t-\t\n", name)
+			continue
+		}
+		mean := p.total / time.Duration(p.count)
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t\n", name, p.count,
+			p.total.Round(time.Microsecond), mean.Round(time.Microsecond), p.max.Round(time.Microsecond))
+	}
+	tw.Flush()
+}
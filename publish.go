@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultCacheControl is the Cache-Control of published images: short, so
+// a regenerated image shows up soon.
+const defaultCacheControl = "public, max-age=300"
+
+// upload is a rendered image on its way to a publish destination.
+type upload struct {
+	data         []byte
+	contentType  string
+	cacheControl string
+}
+
+// publishers upload an image to the destination named by a URL, by scheme.
+var publishers = map[string]func(u *url.URL, up upload) error{
+	"s3": publishS3,
+	"gs": publishGCS,
+}
+
+// stringList is a flag that may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// publishSchemes lists the schemes -publish accepts.
+func publishSchemes() string {
+	var schemes []string
+	for scheme := range publishers {
+		schemes = append(schemes, scheme+"://")
+	}
+	sort.Strings(schemes)
+	return strings.Join(schemes, ", ") + ", or SCHEME:// for a heatmap-publish-SCHEME plugin"
+}
+
+// findPublisher returns the publisher of a scheme: built in, or else the
+// heatmap-publish-SCHEME plugin.
+func findPublisher(scheme string) (func(u *url.URL, up upload) error, bool) {
+	if p, ok := publishers[scheme]; ok {
+		return p, true
+	}
+	if path, ok := findPlugin("publish", scheme); ok {
+		return publishPlugin(path), true
+	}
+	return nil, false
+}
+
+// parsePublishTarget checks a -publish destination. A destination ending
+// in / is a prefix the output file name is appended to.
+func parsePublishTarget(target, output string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, usageError(trf("invalid -publish destination %q", target))
+	}
+	if _, ok := findPublisher(u.Scheme); !ok {
+		return nil, usageError(trf("-publish destination %q: unknown scheme (available: %s)", target, publishSchemes()))
+	}
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		u.Path += path.Base(output)
+	}
+	return u, nil
+}
+
+// publish uploads an image to every destination.
+func publish(targets []string, output string, up upload) error {
+	for _, target := range targets {
+		u, err := parsePublishTarget(target, output)
+		if err != nil {
+			return err
+		}
+		publisher, _ := findPublisher(u.Scheme)
+		start := time.Now()
+		if err := publisher(u, up); err != nil {
+			return publishError(errorf("publishing to %s: %w", u, err))
+		}
+		slog.Info("image published", "to", u.String(), "bytes", len(up.data), "elapsed", time.Since(start))
+	}
+	return nil
+}
+
+// send performs a request whose response carries no data, reporting a
+// failure status together with the start of the response body, where
+// storage APIs explain what went wrong.
+func send(req *http.Request) error {
+	return sendAs(req, req.URL.Host+req.URL.Path)
+}
+
+// sendAs is send for requests whose URL should not appear in logs and
+// errors, such as webhooks, which carry their credentials in the path. name
+// stands in for the URL.
+func sendAs(req *http.Request, name string) error {
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// The client's errors quote the whole URL.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return errorf("%s %s: %w", req.Method, name, err)
+	}
+	defer resp.Body.Close()
+	slog.Debug("api request", "target", name, "status", resp.StatusCode, "elapsed", time.Since(start))
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			return errorf("%s %s: %s: %s", req.Method, name, resp.Status, msg)
+		}
+		return errorf("%s %s: %s", req.Method, name, resp.Status)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func newUploadRequest(method, rawURL string, up upload) (*http.Request, error) {
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(up.data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", up.contentType)
+	req.Header.Set("Cache-Control", up.cacheControl)
+	return req, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const hoursInDay = 24
+
+// punchCard counts events by weekday, from Sunday, and hour of the day.
+type punchCard [daysInWeek][hoursInDay]int
+
+// eventLayouts are the forms of the times of events punchcard reads: RFC
+// 3339, which has a zone, and the zoneless times of spreadsheets and logs.
+var eventLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// parseEventTime parses the time of an event in one of eventLayouts.
+// Zoneless times are read in loc.
+func parseEventTime(s string, loc *time.Location) (time.Time, error) {
+	for _, layout := range eventLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errorf("invalid event time %q (use RFC 3339 or YYYY-MM-DD HH:MM[:SS])", s)
+}
+
+// readEvents reads the events of a CSV file after a header row: a time in
+// the first column of each row and, if the row has a second, how many
+// events the row stands for, such as minutes worked.
+func readEvents(filename string, loc *time.Location, limits inputLimits) ([]time.Time, []int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(bufio.NewReaderSize(file, 1<<16))
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	if _, err := reader.Read(); err != nil {
+		return nil, nil, err
+	}
+	var (
+		times  []time.Time
+		counts []int
+	)
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := limits.checkRows(row); err != nil {
+			return nil, nil, err
+		}
+		t, err := parseEventTime(strings.TrimSpace(record[0]), loc)
+		if err != nil {
+			return nil, nil, malformedf("row %d: %v", row, err)
+		}
+		count := 1
+		if len(record) > 1 {
+			if count, err = strconv.Atoi(strings.TrimSpace(record[1])); err != nil || count < 0 || count > limits.MaxCount {
+				return nil, nil, malformedf("row %d: count %q is not a whole number from 0 to %d", row, record[1], limits.MaxCount)
+			}
+		}
+		times = append(times, t)
+		counts = append(counts, count)
+	}
+	return times, counts, nil
+}
+
+// tallyPunchCard adds up the events from the day from to the day to, when
+// set, by the weekday and hour they happened on in loc, or in their own
+// zone when loc is nil.
+func tallyPunchCard(times []time.Time, counts []int, loc *time.Location, from, to time.Time) punchCard {
+	var card punchCard
+	for i, t := range times {
+		if loc != nil {
+			t = t.In(loc)
+		}
+		if d := day(t); (!from.IsZero() && d.Before(from)) || (!to.IsZero() && d.After(to)) {
+			continue
+		}
+		card[t.Weekday()][t.Hour()] += counts[i]
+	}
+	return card
+}
+
+// matrix returns the card as a matrix of weekdays by hours, labelled
+// every three hours, for images of t.
+func (c punchCard) matrix(t theme) matrix {
+	rows := make([]string, daysInWeek)
+	for d := range rows {
+		rows[d] = t.label(weekdayNames[d])
+	}
+	columns := make([]string, hoursInDay)
+	for h := range columns {
+		columns[h] = strconv.Itoa(h)
+	}
+	m := newMatrix(rows, columns)
+	for d, hours := range c {
+		copy(m.values[d], hours[:])
+	}
+	m.columnStep = 3
+	m.cellName = func(d, h int) string { return fmt.Sprintf("%.3s %02d:00", time.Weekday(d), h) }
+	return m
+}
+
+// busiest returns the weekday and hour with the most events, the earliest
+// in the week on ties, and their count.
+func (c punchCard) busiest() (time.Weekday, int, int) {
+	var (
+		wd         time.Weekday
+		hour, most int
+	)
+	for d, hours := range c {
+		for h, n := range hours {
+			if n > most {
+				wd, hour, most = time.Weekday(d), h, n
+			}
+		}
+	}
+	return wd, hour, most
+}
+
+// weekdayWidth is the room left of the punch card for the weekday names.
+const weekdayWidth = 40
+
+// punchCardLayout arranges the card as a row of hours for each weekday,
+// Sunday first, with the hours every three above the columns, the legend
+// of scale to the right and the total and busiest hour below.
+func punchCardLayout(card punchCard, scale colorScale, opts renderOptions) layout {
+	m := card.matrix(opts.Theme)
+	l := matrixLayout(m, scale, opts)
+	line := opts.Theme.labelf("Total: %s", formatCount(m.total()))
+	if wd, hour, most := card.busiest(); most > 0 {
+		line += opts.Theme.labelf("   Busiest: %s %02d:00 (%s)", opts.Theme.label(weekdayNames[wd]), hour, formatCount(most))
+	}
+	l.addFooter(line)
+	return l
+}
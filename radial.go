@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/vector"
+)
+
+// layoutSector is a ring sector of a polar layout: the cell of a day, or a
+// tick when it has no date, between two radii and two angles, in radians
+// clockwise from twelve o'clock around center. Its rect is the box around
+// it.
+type layoutSector struct {
+	layoutCell
+	center       image.Point
+	inner, outer float64
+	from, to     float64
+}
+
+// newSector returns the sector of c between the radii and angles, with its
+// rect set to the box around it.
+func newSector(c layoutCell, center image.Point, inner, outer, from, to float64) layoutSector {
+	s := layoutSector{layoutCell: c, center: center, inner: inner, outer: outer, from: from, to: to}
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range s.path() {
+		minX, minY = min(minX, p[0]), min(minY, p[1])
+		maxX, maxY = max(maxX, p[0]), max(maxY, p[1])
+	}
+	s.rect = image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+	return s
+}
+
+// point returns the point at radius r and angle a around the center.
+func (s layoutSector) point(r, a float64) (float64, float64) {
+	return float64(s.center.X) + r*math.Sin(a), float64(s.center.Y) - r*math.Cos(a)
+}
+
+// path returns the outline of the sector as a polygon: along the outer arc
+// in steps of at most a degree and back along the inner one.
+func (s layoutSector) path() [][2]float64 {
+	steps := max(int(math.Ceil((s.to-s.from)/(math.Pi/180))), 1)
+	points := make([][2]float64, 0, 2*(steps+1))
+	for i := 0; i <= steps; i++ {
+		x, y := s.point(s.outer, s.from+(s.to-s.from)*float64(i)/float64(steps))
+		points = append(points, [2]float64{x, y})
+	}
+	for i := steps; i >= 0; i-- {
+		x, y := s.point(s.inner, s.from+(s.to-s.from)*float64(i)/float64(steps))
+		points = append(points, [2]float64{x, y})
+	}
+	return points
+}
+
+// drawSector fills the sector into img, anti-aliased.
+func drawSector(img *image.RGBA, s layoutSector) {
+	box := s.rect.Intersect(img.Bounds())
+	if box.Empty() {
+		return
+	}
+	z := vector.NewRasterizer(box.Dx(), box.Dy())
+	z.DrawOp = draw.Over
+	for i, p := range s.path() {
+		x, y := float32(p[0]-float64(box.Min.X)), float32(p[1]-float64(box.Min.Y))
+		if i == 0 {
+			z.MoveTo(x, y)
+		} else {
+			z.LineTo(x, y)
+		}
+	}
+	z.ClosePath()
+	z.Draw(img, box, image.NewUniform(s.color), image.Point{})
+}
+
+// The radial layout rings the year of hm a day at a time, clockwise from
+// twelve o'clock, twelve cells from the center to the outside of the ring
+// and four cells thick, with room around it for the names of the months.
+const (
+	radialOuter  = 12 // the outer radius, in cells
+	radialWidth  = 4  // the thickness of the ring, in cells
+	radialMargin = 40 // around the ring for the month names
+)
+
+// radialLayout arranges the year of hm as a wheel: a ring of the days with
+// ticks at the start of each month and its name outside, the total in the
+// middle, the legend to the right and the panel and streaks the options
+// ask for.
+func radialLayout(hm heatmap, opts renderOptions) layout {
+	cell := opts.cellSize()
+	face := opts.Theme.newFace()
+	outer, inner := float64(radialOuter*cell), float64((radialOuter-radialWidth)*cell)
+	size := 2*radialOuter*cell + 2*radialMargin
+	center := image.Pt(size/2, titleHeight+size/2)
+	legendX := size + 10
+	l := layout{width: legendX - 10 + legendWidth, height: titleHeight + size + 10}
+	l.labels = append(l.labels, layoutText{10, 25, opts.Title})
+
+	dates := placedDays(hm.start, places(hm.start, addDate(hm.start, 1, 0, 0), opts.LeapDay), opts.LeapDay)
+	days := len(dates)
+	step := 2 * math.Pi / float64(days)
+	// Each day reaches half a pixel into the next, so anti-aliased edges
+	// leave no seam of background between them.
+	overlap := 0.5 / outer
+	var shown []DailyTweet
+	total := 0
+	for i, date := range dates {
+		to := float64(i+1) * step
+		if i < days-1 {
+			to += overlap
+		}
+		l.sectors = append(l.sectors, newSector(dayCell(hm, date, image.Rectangle{}), center, inner, outer, float64(i)*step, to))
+		if count, ok := hm.counts[civil(date)]; ok {
+			shown = append(shown, DailyTweet{Date: date, Count: count})
+			total += count
+		}
+	}
+	l.addMonthTicks(face, hm.start, days, opts.LeapDay, center, outer, opts.Theme)
+
+	for i, line := range []string{formatCount(total), opts.Theme.label("in total")} {
+		width := font.MeasureString(face, line).Ceil()
+		l.labels = append(l.labels, layoutText{center.X - width/2, center.Y + i*panelLine, line})
+	}
+
+	sum := summary{}
+	if len(shown) > 0 {
+		sum = summarize(shown)
+	}
+	l.addLegend(face, hm, opts, legendX, titleHeight+monthHeight+10)
+	l.addSummary(face, sum, opts, legendX)
+	return l
+}
+
+// addMonthTicks marks the first day of each month of the days from start,
+// placed as -leap-day policy places them, round a ring of the given outer
+// radius with a tick outside it, and names the month halfway between its
+// tick and the next.
+func (l *layout) addMonthTicks(face font.Face, start time.Time, days int, policy string, center image.Point, outer float64, t theme) {
+	step := 2 * math.Pi / float64(days)
+	tick := mix(t.Text, t.Background, 0.6)
+	half := 1 / outer
+	month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for ; places(start, month, policy) < days; month = addDate(month, 0, 1, 0) {
+		from := math.Max(float64(places(start, month, policy)), 0) * step
+		to := math.Min(float64(places(start, addDate(month, 0, 1, 0), policy)), float64(days)) * step
+		if !month.Before(start) {
+			l.sectors = append(l.sectors, newSector(layoutCell{color: tick}, center, outer+3, outer+9, from-half, from+half))
+		}
+		if to-from < step*10 {
+			continue // too few days of the month to name it
+		}
+		s := layoutSector{center: center}
+		x, y := s.point(outer+22, (from+to)/2)
+		name := t.label(monthNames[month.Month()-1])
+		width := font.MeasureString(face, name).Ceil()
+		l.labels = append(l.labels, layoutText{int(x) - width/2, int(y) + 4, name})
+	}
+}
+
+// sectorTitle returns the tooltip of a sector, or "" for ticks.
+func sectorTitle(s layoutSector) string {
+	if s.date.IsZero() && s.label == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s: %d", s.name(), s.count)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// imageKey identifies an image by everything that goes into it: the build,
+// a hash of the data, the format and the render options.
+func imageKey(dataHash, format string, opts renderOptions) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", versionString(), dataHash, format)
+	hashRenderOptions(h, opts)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dataKey is the hash of the data imageKey takes.
+func dataKey(tweets []DailyTweet) string {
+	h := sha256.New()
+	hashTweets(h, tweets)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// renderCache remembers, for each output file, the key of the image last
+// written there and a hash of the file, so generate can tell that running
+// again would write the same bytes.
+type renderCache struct {
+	dir string
+}
+
+// renderCacheEntry is the file kept for an output.
+type renderCacheEntry struct {
+	Key    string `json:"key"`
+	SHA256 string `json:"sha256"`
+}
+
+func defaultRenderCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "heatmap-generator", "renders")
+}
+
+func (c renderCache) entryPath(output string) string {
+	abs, err := filepath.Abs(output)
+	if err != nil {
+		abs = output
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// upToDate reports whether output holds the image with the given key,
+// unchanged since it was written.
+func (c renderCache) upToDate(output, key string) bool {
+	data, err := os.ReadFile(c.entryPath(output))
+	if err != nil {
+		return false
+	}
+	var entry renderCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key {
+		return false
+	}
+	image, err := os.ReadFile(output)
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256(image)
+	return hex.EncodeToString(sum[:]) == entry.SHA256
+}
+
+// record stores the key of the image just written to output.
+func (c renderCache) record(output, key string, image []byte) error {
+	if c.dir == "" {
+		return errors.New(tr("no cache directory"))
+	}
+	sum := sha256.Sum256(image)
+	data, err := json.Marshal(renderCacheEntry{Key: key, SHA256: hex.EncodeToString(sum[:])})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	path := c.entryPath(output)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// renderer is a backend heatmaps are drawn with. It draws a layout, which
+// has measured and placed every piece, so an output format needs a
+// renderer and nothing else.
+type renderer interface {
+	// begin starts an image of the given size in the theme's background.
+	begin(width, height int, t theme)
+	// describe gives the image a text description, where its format has
+	// room for one. It comes before begin.
+	describe(desc string)
+	// text draws s in the 7x13 monospace face with its baseline at y.
+	text(x, y int, s string, c color.RGBA)
+	// rect fills a rectangle.
+	rect(r image.Rectangle, c color.RGBA)
+	// cells draws the days of the grid.
+	cells(cells []layoutCell)
+	// sectors fills the ring sectors of polar layouts, anti-aliased.
+	sectors(sectors []layoutSector)
+	// line strokes a polyline, anti-aliased.
+	line(line layoutLine)
+	// outline draws a border of the given width just inside a rectangle.
+	outline(r image.Rectangle, width int, c color.RGBA)
+	// finish returns the encoded image.
+	finish() ([]byte, error)
+}
+
+// renderers makes the renderer of each output format in outputFormats.
+var renderers = map[string]func(opts renderOptions) renderer{
+	"png": newPNGRenderer,
+	"svg": func(opts renderOptions) renderer { return &svgRenderer{link: opts.CellLink} },
+}
+
+// drawHeatmap draws the heatmap of tweets with r, unless ctx ends first.
+func drawHeatmap(ctx context.Context, r renderer, tweets []DailyTweet, opts renderOptions) error {
+	start := time.Now()
+	hm := newHeatmap(tweets, opts)
+	timings.record("aggregate", start)
+	start = time.Now()
+	l, err := arrange(hm, opts)
+	if err != nil {
+		return err
+	}
+	l.desc = describeHeatmap(hm, opts)
+	timings.record("layout", start)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	start = time.Now()
+	l.draw(r, opts.Theme)
+	timings.record("draw", start)
+	return nil
+}
+
+// pngRenderer draws into an RGBA image and encodes it as PNG.
+type pngRenderer struct {
+	img           *image.RGBA
+	compression   png.CompressionLevel
+	paletted      bool
+	deterministic bool   // leave out the name of the build
+	profile       []byte // ICC profile to embed, nil for sRGB
+	face          font.Face
+}
+
+func newPNGRenderer(opts renderOptions) renderer {
+	return &pngRenderer{compression: opts.Compression, paletted: opts.Paletted, deterministic: opts.Deterministic, profile: opts.ICCProfile}
+}
+
+func (p *pngRenderer) begin(width, height int, t theme) {
+	p.img = image.NewRGBA(image.Rect(0, 0, width, height))
+	p.face = t.newFace()
+	draw.Draw(p.img, p.img.Bounds(), &image.Uniform{t.Background}, image.Point{}, draw.Src)
+}
+
+func (p *pngRenderer) text(x, y int, s string, c color.RGBA) {
+	d := &font.Drawer{
+		Dst:  p.img,
+		Src:  image.NewUniform(c),
+		Face: p.face,
+		Dot:  fixed.Point26_6{X: fixed.I(x), Y: fixed.I(y)},
+	}
+	d.DrawString(s)
+}
+
+func (p *pngRenderer) rect(r image.Rectangle, c color.RGBA) {
+	drawRect(p.img, r.Min.X, r.Min.Y, r.Dx(), r.Dy(), c)
+}
+
+func (p *pngRenderer) cells(cells []layoutCell) {
+	drawCells(p.img, cells)
+}
+
+func (p *pngRenderer) sectors(sectors []layoutSector) {
+	for _, s := range sectors {
+		drawSector(p.img, s)
+	}
+}
+
+func (p *pngRenderer) line(line layoutLine) {
+	drawLine(p.img, line)
+}
+
+// describe leaves the description out: pages give PNG images theirs in
+// the alt of the <img>.
+func (p *pngRenderer) describe(desc string) {}
+
+func (p *pngRenderer) outline(r image.Rectangle, width int, c color.RGBA) {
+	drawOutline(p.img, r, width, c)
+}
+
+func (p *pngRenderer) finish() ([]byte, error) {
+	var encoded image.Image = p.img
+	if p.paletted {
+		encoded = toPaletted(p.img)
+	}
+	var buf bytes.Buffer
+	software := versionString()
+	if p.deterministic {
+		software = ""
+	}
+	if err := encodePNG(&buf, encoded, p.compression, software, p.profile); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeImage encodes an image drawn outside drawHeatmap, such as a social
+// card, as the PNG renderer of opts would.
+func encodeImage(img *image.RGBA, opts renderOptions) ([]byte, error) {
+	p := &pngRenderer{img: img, compression: opts.Compression, paletted: opts.Paletted, deterministic: opts.Deterministic}
+	return p.finish()
+}
+
+// renderLayout draws a layout made outside drawHeatmap, as of several
+// heatmaps, in the given format.
+func renderLayout(format string, l layout, opts renderOptions) ([]byte, error) {
+	newRenderer, ok := renderers[format]
+	if !ok {
+		return nil, usageError(trf("unknown format %q", format))
+	}
+	r := newRenderer(opts)
+	start := time.Now()
+	l.draw(r, opts.Theme)
+	timings.record("draw", start)
+	defer timings.record("encode", time.Now())
+	return r.finish()
+}
+
+// renderWith draws the heatmap with the renderer of format. It gives up
+// between drawing and encoding when ctx ends.
+func renderWith(ctx context.Context, format string, tweets []DailyTweet, opts renderOptions) ([]byte, error) {
+	newRenderer, ok := renderers[format]
+	if !ok {
+		return nil, usageError(trf("unknown format %q", format))
+	}
+	r := newRenderer(opts)
+	if err := drawHeatmap(ctx, r, tweets, opts); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer timings.record("encode", time.Now())
+	return r.finish()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+)
+
+// loadRoutes builds a server for each [[route]] table of the config file.
+// A route maps a URL path to its own data source and render options:
+//
+//	[[route]]
+//	path = "/alice.png"
+//	input = "alice.csv"
+//	theme = "dark"
+//
+// Route keys are the flag names of serve; keys a route leaves out take the
+// values serve itself was given. The image format defaults to the one named
+// by the path's extension.
+func loadRoutes(fs *flag.FlagSet, base *heatmapServer) ([]*heatmapServer, error) {
+	config, err := loadConfig(fs.Lookup("config").Value.String())
+	if err != nil {
+		return nil, err
+	}
+
+	raw, ok := config["route"]
+	if !ok {
+		return nil, nil
+	}
+	tables, ok := raw.([]map[string]interface{})
+	if !ok {
+		return nil, errorf("config: route must be an array of tables ([[route]])")
+	}
+
+	var routes []*heatmapServer
+	seen := make(map[string]bool)
+	for i, table := range tables {
+		path, _ := table["path"].(string)
+		if !strings.HasPrefix(path, "/") {
+			return nil, errorf("config: route %d: path must start with /", i+1)
+		}
+		if seen[path] {
+			return nil, errorf("config: route %s defined twice", path)
+		}
+		seen[path] = true
+
+		route, err := newRoute(fs, base, path, table)
+		if err != nil {
+			return nil, errorf("config: route %s: %w", path, err)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func newRoute(fs *flag.FlagSet, base *heatmapServer, path string, table map[string]interface{}) (*heatmapServer, error) {
+	routeFS := flag.NewFlagSet(path, flag.ContinueOnError)
+	routeFS.SetOutput(io.Discard)
+	source := addSourceFlags(routeFS)
+	render := addRenderFlags(routeFS)
+	format := routeFS.String("format", formatForFile(path), "")
+	webhook := routeFS.Bool("webhook", false, "")
+
+	// Start from the values serve was given, except the format, which
+	// follows the path. Repeatable flags are copied item by item, as their
+	// items, such as -transform expressions, may hold the commas String
+	// joins them with.
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		to := routeFS.Lookup(f.Name)
+		if f.Name == "format" || to == nil || err != nil {
+			return
+		}
+		if list, ok := f.Value.(*stringList); ok {
+			*to.Value.(*stringList) = append(stringList(nil), *list...)
+			return
+		}
+		err = routeFS.Set(f.Name, f.Value.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range table {
+		if key == "path" {
+			continue
+		}
+		if key == "config" || routeFS.Lookup(key) == nil {
+			return nil, errorf("unknown setting %q", key)
+		}
+		if err := setFlag(routeFS, key, value); err != nil {
+			return nil, errorf("%s: %w", key, err)
+		}
+	}
+
+	if _, err := render.options(""); err != nil {
+		return nil, err
+	}
+	if _, err := compileTransforms(source.transforms); err != nil {
+		return nil, err
+	}
+	if _, ok := outputFormats[*format]; !ok {
+		return nil, errorf("unknown format %q", *format)
+	}
+
+	return &heatmapServer{
+		path:    path,
+		fs:      routeFS,
+		source:  source,
+		render:  render,
+		format:  *format,
+		maxAge:  base.maxAge,
+		timeout: base.timeout,
+		metrics: base.metrics,
+		webhook: *webhook,
+	}, nil
+}
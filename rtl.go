@@ -0,0 +1,67 @@
+package main
+
+import (
+	"image"
+
+	"golang.org/x/image/font"
+)
+
+// Right-to-left heatmaps, for reports in Arabic, Hebrew and other languages
+// written that way, are the left-to-right layout mirrored: time runs from
+// right to left, the weekday names and title start at the right and the
+// legend sits on the left. Only positions are mirrored; text still reads in
+// its own direction, set so it ends where it started before.
+
+// checkRTL validates -rtl.
+func checkRTL(on bool, opts renderOptions) (bool, error) {
+	if on && opts.Card {
+		return false, usageError(tr("social cards are laid out left to right; -rtl does not apply"))
+	}
+	return on, nil
+}
+
+// mirror flips l from left to right, measuring its text in face.
+func (l *layout) mirror(face font.Face) {
+	flip := func(r image.Rectangle) image.Rectangle {
+		return image.Rect(l.width-r.Max.X, r.Min.Y, l.width-r.Min.X, r.Max.Y)
+	}
+	text := func(t *layoutText) {
+		t.x = l.width - t.x - font.MeasureString(face, t.text).Ceil()
+	}
+	swatches := func(ss []layoutSwatch) {
+		for i := range ss {
+			ss[i].rect = flip(ss[i].rect)
+			if ss[i].label.text != "" {
+				text(&ss[i].label)
+			}
+		}
+	}
+	for i := range l.labels {
+		text(&l.labels[i])
+	}
+	for i := range l.cells {
+		l.cells[i].rect = flip(l.cells[i].rect)
+	}
+	for i := range l.sectors {
+		s := &l.sectors[i]
+		s.center.X = l.width - s.center.X
+		s.from, s.to = -s.to, -s.from
+		s.rect = flip(s.rect)
+	}
+	for _, line := range l.lines {
+		for i := range line.points {
+			line.points[i].X = l.width - line.points[i].X
+		}
+	}
+	for i := range l.outlines {
+		l.outlines[i].rect = flip(l.outlines[i].rect)
+	}
+	for i := range l.borders {
+		l.borders[i].rect = flip(l.borders[i].rect)
+	}
+	swatches(l.legend)
+	swatches(l.bars)
+	swatches(l.parts)
+	swatches(l.numbers)
+	swatches(l.marks)
+}
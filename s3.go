@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// awsCredentials are the credentials and region S3 requests are signed
+// for.
+type awsCredentials struct {
+	keyID, secret, token string
+	region               string
+}
+
+// awsFromEnv reads credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and, for temporary credentials, AWS_SESSION_TOKEN; and the region from
+// AWS_REGION or AWS_DEFAULT_REGION.
+func awsFromEnv() (awsCredentials, error) {
+	c := awsCredentials{
+		keyID:  os.Getenv("AWS_ACCESS_KEY_ID"),
+		secret: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:  os.Getenv("AWS_SESSION_TOKEN"),
+		region: os.Getenv("AWS_REGION"),
+	}
+	if c.keyID == "" || c.secret == "" {
+		return c, errors.New(tr("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set"))
+	}
+	if c.region == "" {
+		c.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	return c, nil
+}
+
+// s3Endpoint returns the HTTPS address of the object s3://bucket/key.
+// AWS_ENDPOINT_URL points at an S3-compatible service such as MinIO or
+// Cloudflare R2 instead.
+func s3Endpoint(u *url.URL, region string) (*url.URL, error) {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	var endpoint *url.URL
+	if custom := os.Getenv("AWS_ENDPOINT_URL"); custom != "" {
+		var err error
+		if endpoint, err = url.Parse(custom); err != nil || endpoint.Host == "" {
+			return nil, errorf("invalid AWS_ENDPOINT_URL %q", custom)
+		}
+		endpoint.Path = "/" + bucket + "/" + key
+	} else if strings.Contains(bucket, ".") {
+		// Dotted bucket names do not match the wildcard certificate of
+		// virtual-hosted addresses.
+		endpoint = &url.URL{Scheme: "https", Host: "s3." + region + ".amazonaws.com", Path: "/" + bucket + "/" + key}
+	} else {
+		endpoint = &url.URL{Scheme: "https", Host: bucket + ".s3." + region + ".amazonaws.com", Path: "/" + key}
+	}
+	endpoint.RawPath = awsEscapePath(endpoint.Path)
+	return endpoint, nil
+}
+
+// publishS3 uploads an image to s3://bucket/key with a request signed by
+// AWS Signature Version 4.
+func publishS3(u *url.URL, up upload) error {
+	creds, err := awsFromEnv()
+	if err != nil {
+		return err
+	}
+	endpoint, err := s3Endpoint(u, creds.region)
+	if err != nil {
+		return err
+	}
+
+	req, err := newUploadRequest("PUT", endpoint.String(), up)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	payloadHash := sha256.Sum256(up.data)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if creds.token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.token)
+	}
+
+	signAWS(req, hex.EncodeToString(payloadHash[:]), now, creds)
+	return send(req)
+}
+
+// presignS3 returns a URL that lets anyone holding it download the object
+// s3://bucket/key until it expires, at most a week later.
+func presignS3(u *url.URL, expires time.Duration, now time.Time, creds awsCredentials) (string, error) {
+	endpoint, err := s3Endpoint(u, creds.region)
+	if err != nil {
+		return "", err
+	}
+	return presignEndpoint(endpoint, expires, now, creds), nil
+}
+
+// presignEndpoint returns the presigned URL of the object at endpoint.
+func presignEndpoint(endpoint *url.URL, expires time.Duration, now time.Time, creds awsCredentials) string {
+	now = now.UTC()
+	scope := now.Format("20060102") + "/" + creds.region + "/s3/aws4_request"
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {creds.keyID + "/" + scope},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if creds.token != "" {
+		query.Set("X-Amz-Security-Token", creds.token)
+	}
+	// Encode escapes spaces as +, which Signature Version 4 does not accept.
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		endpoint.EscapedPath(),
+		canonicalQuery,
+		"host:" + endpoint.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	endpoint.RawQuery = canonicalQuery + "&X-Amz-Signature=" + awsSignature(canonicalRequest, now, creds)
+	return endpoint.String()
+}
+
+// signAWS adds the Signature Version 4 Authorization header to an S3
+// request, signing every header it carries so far.
+func signAWS(req *http.Request, payloadHash string, now time.Time, creds awsCredentials) {
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // no query
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + creds.region + "/s3/aws4_request"
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.keyID, scope, signedHeaders, awsSignature(canonicalRequest, now, creds)))
+}
+
+// awsSignature signs a canonical request with a key derived from the
+// secret, the day and the region.
+func awsSignature(canonicalRequest string, now time.Time, creds awsCredentials) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	date := now.Format("20060102")
+	scope := date + "/" + creds.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.secret), date)
+	signingKey = hmacSHA256(signingKey, creds.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscapePath percent-encodes a path as Signature Version 4 requires:
+// everything but unreserved characters and the separating slashes.
+func awsEscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Parameters of the synthetic activity model used by generateSample.
+const (
+	sampleMeanCount    = 6.0  // typical count on an active weekday
+	sampleStayActive   = 0.85 // chance an active day is followed by another
+	sampleBecomeActive = 0.3  // chance an idle day is followed by an active one
+	sampleSpikeChance  = 0.02 // chance an active day is a spike
+)
+
+// sampleWeekdayBias scales activity by day of week, Sunday first.
+var sampleWeekdayBias = [7]float64{0.4, 1.0, 1.1, 1.1, 1.0, 0.9, 0.5}
+
+// generateSample synthesizes days of plausible activity ending on end. Days
+// alternate between active streaks and idle stretches; active days follow a
+// weekday bias and a slow seasonal swing, with the occasional spike.
+func generateSample(rng *rand.Rand, end time.Time, days int) []DailyTweet {
+	var tweets []DailyTweet
+	active := true
+	phase := rng.Float64() * 2 * math.Pi
+
+	start := addDate(end, 0, 0, 1-days)
+	for i := 0; i < days; i++ {
+		date := addDate(start, 0, 0, i)
+
+		if active {
+			active = rng.Float64() < sampleStayActive
+		} else {
+			active = rng.Float64() < sampleBecomeActive
+		}
+		if !active {
+			continue
+		}
+
+		season := 1 + 0.4*math.Sin(2*math.Pi*float64(date.YearDay())/365+phase)
+		lambda := sampleMeanCount * sampleWeekdayBias[date.Weekday()] * season
+		if rng.Float64() < sampleSpikeChance {
+			lambda *= 2 + rng.Float64()
+		}
+
+		if count := poisson(rng, lambda); count > 0 {
+			tweets = append(tweets, DailyTweet{Date: date, Count: count})
+		}
+	}
+	return tweets
+}
+
+// poisson draws from a Poisson distribution with mean lambda.
+func poisson(rng *rand.Rand, lambda float64) int {
+	// Knuth's method is fine for the small means used here.
+	limit := math.Exp(-lambda)
+	k, p := 0, 1.0
+	for {
+		p *= rng.Float64()
+		if p <= limit {
+			return k
+		}
+		k++
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// colorScale maps the count of a day to its color and describes the
+// mapping in the legend.
+type colorScale interface {
+	// colorFor returns the color of a day with the given count.
+	colorFor(count int) color.RGBA
+	// legendEntries lists the colors of the scale from the least activity
+	// to the most, each with the counts it stands for, or no label when it
+	// stands for none.
+	legendEntries() []legendEntry
+}
+
+type legendEntry struct {
+	color color.RGBA
+	label string
+	// format and args make up a label in words, which images translate;
+	// label holds it in English for the text and spreadsheet exports.
+	format string
+	args   []any
+}
+
+// wordedEntry returns the legend entry of c labeled by format and args.
+func wordedEntry(c color.RGBA, format string, args ...any) legendEntry {
+	return legendEntry{c, fmt.Sprintf(format, args...), format, args}
+}
+
+// in returns the label of e in the language of the labels t draws.
+func (e legendEntry) in(t theme) string {
+	if e.format == "" {
+		return e.label
+	}
+	return t.labelf(e.format, e.args...)
+}
+
+// scaleKinds compute the bucket thresholds of each kind of scale -scale
+// selects from the sorted counts of the data: the highest count of each
+// color but the last.
+var scaleKinds = map[string]func(counts []int, levels int) []int{
+	"linear":   linearThresholds,
+	"log":      logThresholds,
+	"quantile": quantileThresholds,
+}
+
+const defaultScale = "linear"
+
+func scaleNames() []string {
+	names := make([]string, 0, len(scaleKinds))
+	for name := range scaleKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newColorScale returns the scale the options ask for over the sorted counts
+// of the data, with the colors of the theme.
+func newColorScale(counts []int, opts renderOptions) colorScale {
+	if opts.Goal > 0 {
+		return goalScale{goal: opts.Goal, colors: opts.Theme.Colors}
+	}
+	if opts.Normalize == "zscore" && opts.Thresholds == nil {
+		return zScale{colors: opts.Theme.Colors}
+	}
+	levels := len(opts.Theme.Colors) - 1
+	thresholds := opts.Thresholds
+	clip := 0
+	if thresholds == nil {
+		kind := opts.Scale
+		if kind == "" {
+			kind = defaultScale
+		}
+		counts, clip = clipCounts(counts, opts)
+		thresholds = scaleKinds[kind](counts, levels)
+	}
+	return bucketScale{thresholds: thresholds, colors: opts.Theme.Colors, clip: clip}
+}
+
+// clipCounts caps the sorted counts at -clip-max or at the -clip-percentile
+// of them, by the nearest rank, and returns the cap, or zero when no count
+// is above it and nothing changes.
+func clipCounts(counts []int, opts renderOptions) ([]int, int) {
+	if len(counts) == 0 {
+		return counts, 0
+	}
+	clip := opts.ClipMax
+	if opts.ClipPercentile > 0 {
+		rank := int(math.Ceil(opts.ClipPercentile / 100 * float64(len(counts))))
+		clip = counts[max(rank, 1)-1]
+	}
+	if clip <= 0 || counts[len(counts)-1] <= clip {
+		return counts, 0
+	}
+	clipped := make([]int, len(counts))
+	for i, count := range counts {
+		clipped[i] = min(count, clip)
+	}
+	return clipped, clip
+}
+
+// checkClip validates -clip-max and -clip-percentile against the other
+// options. Only scales computed from the counts can be clipped.
+func checkClip(clipMax int, percentile float64, opts renderOptions) (int, float64, error) {
+	switch {
+	case clipMax == 0 && percentile == 0:
+		return 0, 0, nil
+	case clipMax < 0:
+		return 0, 0, usageError(trf("clip-max must be a positive count, not %d", clipMax))
+	case !(percentile >= 0 && percentile <= 100):
+		return 0, 0, usageError(trf("clip-percentile must be between 0 and 100, not %g", percentile))
+	case clipMax > 0 && percentile > 0:
+		return 0, 0, usageError(tr("-clip-max and -clip-percentile cannot be combined"))
+	case opts.Thresholds != nil || opts.Goal > 0 || opts.Normalize == "zscore":
+		return 0, 0, usageError(tr("clipping needs a scale computed from the counts, not -thresholds, -goal or -normalize zscore"))
+	}
+	return clipMax, percentile, nil
+}
+
+// parseScale validates -scale and -thresholds. Thresholds, when given, fix
+// the scale and take precedence.
+func parseScale(kind, thresholds string) (string, []int, error) {
+	if _, ok := scaleKinds[kind]; !ok {
+		return "", nil, usageError(trf("unknown scale %q (available: %s)", kind, strings.Join(scaleNames(), ", ")))
+	}
+	if thresholds == "" {
+		return kind, nil, nil
+	}
+	fields := strings.Split(thresholds, ",")
+	if len(fields) != len(baseColors)-1 {
+		return "", nil, usageError(trf("-thresholds needs %d comma-separated counts, one per color but the last", len(baseColors)-1))
+	}
+	fixed := make([]int, len(fields))
+	for i, field := range fields {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 0 || (i > 0 && n <= fixed[i-1]) {
+			return "", nil, usageError(tr("-thresholds must be increasing counts of zero or more"))
+		}
+		fixed[i] = n
+	}
+	return "fixed", fixed, nil
+}
+
+// bucketScale colors counts by the first threshold they do not exceed; counts
+// above every threshold take the last color.
+type bucketScale struct {
+	thresholds []int
+	colors     []color.RGBA
+	clip       int // the count the thresholds were computed up to, if clipped
+}
+
+// String shows the thresholds in debug logs.
+func (s bucketScale) String() string {
+	return fmt.Sprint(s.thresholds)
+}
+
+func (s bucketScale) bucket(count int) int {
+	for i, threshold := range s.thresholds {
+		if count <= threshold {
+			return i
+		}
+	}
+	return len(s.thresholds)
+}
+
+func (s bucketScale) colorFor(count int) color.RGBA {
+	return s.colors[s.bucket(count)]
+}
+
+func (s bucketScale) legendEntries() []legendEntry {
+	entries := make([]legendEntry, len(s.thresholds)+1)
+	for i := range entries {
+		var label string
+		switch {
+		case i == 0:
+			label = "0"
+		case i == len(s.thresholds):
+			label = fmt.Sprintf("%d+", s.thresholds[i-1]+1)
+		case s.thresholds[i] <= s.thresholds[i-1]:
+			// No count takes this color.
+		default:
+			label = fmt.Sprintf("%d-%d", s.thresholds[i-1]+1, s.thresholds[i])
+		}
+		entries[i] = legendEntry{color: s.colors[i], label: label}
+	}
+	return entries
+}
+
+// goalScale colors days by how they did against a daily goal, as habit
+// trackers do: missed, partial, met and exceeded take the lightest, the
+// second, the fourth and the strongest color of the theme.
+type goalScale struct {
+	goal   int
+	colors []color.RGBA
+}
+
+func (s goalScale) String() string {
+	return fmt.Sprintf("goal %d", s.goal)
+}
+
+// level returns the index of the color of count.
+func (s goalScale) level(count int) int {
+	switch {
+	case count <= 0:
+		return 0
+	case count < s.goal:
+		return 1
+	case count == s.goal:
+		return len(s.colors) - 2
+	}
+	return len(s.colors) - 1
+}
+
+func (s goalScale) colorFor(count int) color.RGBA {
+	return s.colors[s.level(count)]
+}
+
+func (s goalScale) legendEntries() []legendEntry {
+	entries := []legendEntry{wordedEntry(s.colors[0], "missed")}
+	switch {
+	case s.goal == 2:
+		entries = append(entries, wordedEntry(s.colors[1], "partial (1)"))
+	case s.goal > 2:
+		entries = append(entries, wordedEntry(s.colors[1], "partial (1-%d)", s.goal-1))
+	}
+	return append(entries,
+		wordedEntry(s.colors[len(s.colors)-2], "met (%d)", s.goal),
+		wordedEntry(s.colors[len(s.colors)-1], "exceeded (%d+)", s.goal+1))
+}
+
+// zScale colors z-scores in hundredths by standard deviations: a day a
+// deviation or more below the mean gets the lightest color, and each
+// deviation above that the next, up to two above the mean and more.
+type zScale struct {
+	colors []color.RGBA
+}
+
+// zBounds are the upper bounds of each color but the last, in hundredths
+// of a standard deviation.
+var zBounds = []int{-100, 0, 100, 200}
+
+func (s zScale) String() string {
+	return "z-score"
+}
+
+func (s zScale) bucket(z int) int {
+	for i, bound := range zBounds {
+		if z <= bound {
+			return i
+		}
+	}
+	return len(zBounds)
+}
+
+func (s zScale) colorFor(z int) color.RGBA {
+	return s.colors[min(s.bucket(z), len(s.colors)-1)]
+}
+
+func (s zScale) legendEntries() []legendEntry {
+	labels := []string{"-1 sd or less", "-1 sd to mean", "mean to +1 sd", "+1 to +2 sd", "over +2 sd"}
+	entries := make([]legendEntry, len(labels))
+	for i, label := range labels {
+		entries[i] = wordedEntry(s.colors[min(i, len(s.colors)-1)], label)
+	}
+	return entries
+}
+
+// divergingScale colors differences: days with less in shades of red, days
+// with more in shades of blue and days without a difference in the
+// lightest color of the theme. The reds and blues are the RdBu scheme of
+// ColorBrewer, which stays apart for readers with red-green color
+// blindness. Thresholds bound the size of each shade's differences, both
+// ways, and are the same on both sides so equal colors mean equal sizes.
+type divergingScale struct {
+	thresholds []int
+	neutral    color.RGBA
+}
+
+var (
+	divergingLess = []color.RGBA{{253, 219, 199, 255}, {244, 165, 130, 255}, {214, 96, 77, 255}, {178, 24, 43, 255}}
+	divergingMore = []color.RGBA{{209, 229, 240, 255}, {146, 197, 222, 255}, {67, 147, 195, 255}, {33, 102, 172, 255}}
+)
+
+// newDivergingScale splits the sizes of the differences up to the largest
+// into equal ranges, one per shade.
+func newDivergingScale(differences []int, neutral color.RGBA) divergingScale {
+	largest := 1
+	for _, d := range differences {
+		largest = max(largest, d, -d)
+	}
+	thresholds := make([]int, len(divergingMore))
+	for i := range thresholds {
+		thresholds[i] = int(math.Ceil(float64(largest) * float64(i+1) / float64(len(thresholds))))
+	}
+	return divergingScale{thresholds: increasing(thresholds), neutral: neutral}
+}
+
+func (s divergingScale) String() string {
+	return fmt.Sprintf("diverging %v", s.thresholds)
+}
+
+func (s divergingScale) colorFor(count int) color.RGBA {
+	size := max(count, -count)
+	if size == 0 {
+		return s.neutral
+	}
+	shade := len(s.thresholds) - 1
+	for i, threshold := range s.thresholds {
+		if size <= threshold {
+			shade = i
+			break
+		}
+	}
+	if count < 0 {
+		return divergingLess[shade]
+	}
+	return divergingMore[shade]
+}
+
+// legendEntries lists the shades from the largest fall to the largest
+// rise, each with its range in increasing order.
+func (s divergingScale) legendEntries() []legendEntry {
+	bounds := func(i int) (int, int) {
+		if i == 0 {
+			return 1, s.thresholds[0]
+		}
+		return s.thresholds[i-1] + 1, s.thresholds[i]
+	}
+	label := func(from, to int) string {
+		if from == to {
+			return fmt.Sprintf("%+d", from)
+		}
+		return fmt.Sprintf("%+d to %+d", from, to)
+	}
+	var entries []legendEntry
+	for i := len(s.thresholds) - 1; i >= 0; i-- {
+		low, high := bounds(i)
+		entries = append(entries, legendEntry{color: divergingLess[i], label: label(-high, -low)})
+	}
+	entries = append(entries, legendEntry{color: s.neutral, label: "0"})
+	for i := range s.thresholds {
+		low, high := bounds(i)
+		entries = append(entries, legendEntry{color: divergingMore[i], label: label(low, high)})
+	}
+	return entries
+}
+
+// checkGoal validates -goal against the other options of the scale; zero
+// sets no goal.
+func checkGoal(goal int, thresholds []int) (int, error) {
+	switch {
+	case goal < 0:
+		return 0, usageError(tr("goal must be a positive count, or 0 for none"))
+	case goal > 0 && thresholds != nil:
+		return 0, usageError(tr("give at most one of -goal and -thresholds"))
+	}
+	return goal, nil
+}
+
+// linearThresholds splits the counts up to the highest into equal ranges.
+func linearThresholds(counts []int, levels int) []int {
+	thresholds := make([]int, levels)
+	if len(counts) == 0 {
+		return thresholds
+	}
+	maxCount := counts[len(counts)-1]
+	for i := range thresholds {
+		thresholds[i] = int(math.Ceil(float64(maxCount) * float64(i+1) / float64(levels+1)))
+	}
+	return belowHighest(increasing(thresholds), maxCount)
+}
+
+// logThresholds splits the counts into ranges of equal ratio, which keeps
+// the everyday counts of data with rare spikes apart.
+func logThresholds(counts []int, levels int) []int {
+	thresholds := make([]int, levels)
+	if len(counts) == 0 {
+		return thresholds
+	}
+	maxCount := counts[len(counts)-1]
+	if maxCount < 0 {
+		maxCount = 0
+	}
+	for i := range thresholds {
+		thresholds[i] = int(math.Ceil(math.Pow(float64(maxCount)+1, float64(i+1)/float64(levels+1)))) - 1
+	}
+	return belowHighest(increasing(thresholds), maxCount)
+}
+
+// quantileThresholds keeps the first color for days without activity and
+// gives each of the others an equal share of the days with some.
+func quantileThresholds(counts []int, levels int) []int {
+	thresholds := make([]int, levels)
+	active := counts[sort.SearchInts(counts, 1):]
+	if len(active) == 0 {
+		return thresholds
+	}
+	for i := 1; i < levels; i++ {
+		thresholds[i] = active[(len(active)*i-1)/levels]
+	}
+	return belowHighest(increasing(thresholds), active[len(active)-1])
+}
+
+// increasing raises thresholds equal to the one before, as small or
+// repetitive data gives, so each color keeps a range of its own.
+func increasing(thresholds []int) []int {
+	for i := 1; i < len(thresholds); i++ {
+		if thresholds[i] <= thresholds[i-1] {
+			thresholds[i] = thresholds[i-1] + 1
+		}
+	}
+	return thresholds
+}
+
+// belowHighest lowers thresholds to below the highest count, so that count
+// takes the strongest color however few counts there are: data of one day,
+// or of days that all have the same count, shows them in the strongest
+// color rather than the lightest. Colors left with no counts of their own
+// drop out of the legend.
+func belowHighest(thresholds []int, highest int) []int {
+	for i := range thresholds {
+		thresholds[i] = min(thresholds[i], max(highest-1, 0))
+	}
+	return thresholds
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serveParams are the query parameters the server accepts. Each overrides
+// the flag of the same name for one request.
+var serveParams = map[string]bool{
+	"title":            true,
+	"theme":            true,
+	"cell":             true,
+	"from":             true,
+	"to":               true,
+	"format":           true,
+	"card":             true,
+	"streaks":          true,
+	"panel":            true,
+	"smooth":           true,
+	"normalize":        true,
+	"clip-max":         true,
+	"layout":           true,
+	"calendar-columns": true,
+	"day-numbers":      true,
+	"strip-wrap":       true,
+	"sparkline":        true,
+	"month-totals":     true,
+	"week-numbers":     true,
+	"week-numbers-at":  true,
+	"text-style":       true,
+	"cell-link":        true,
+	"patterns":         true,
+	"rtl":              true,
+	"leap-day":         true,
+	"clip-percentile":  true,
+	"anomalies":        true,
+	"goal":             true,
+	"weekday-chart":    true,
+	"forecast":         true,
+	"categories":       true,
+	"scale":            true,
+	// As Grafana's image panels pass them; see grafana.go.
+	"width":  true,
+	"height": true,
+	"tz":     true,
+}
+
+// maxTitleLength bounds the title query parameter.
+const maxTitleLength = 100
+
+// maxCachedImages bounds how many rendered images the server keeps.
+const maxCachedImages = 64
+
+// heatmapServer serves heatmap images, reading the data again for every
+// request so the image follows changes to the input. Responses carry an
+// ETag derived from the data and options, so clients polling for an
+// unchanged image get a 304 and the server skips rendering it again.
+type heatmapServer struct {
+	path    string // URL path of the image
+	fs      *flag.FlagSet
+	source  *sourceFlags
+	render  *renderFlags
+	format  string
+	maxAge  time.Duration
+	timeout time.Duration // of loading and rendering per request; zero means none
+	metrics *serverMetrics
+	webhook bool // accept data points POSTed to path
+
+	mu         sync.Mutex
+	dataHash   string
+	dataSince  time.Time         // when the data last changed
+	cache      map[string][]byte // rendered images by ETag
+	cacheOrder []string
+}
+
+func (s *heatmapServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.serveImage(rec, r)
+	s.metrics.observeRequest(rec.status)
+}
+
+func (s *heatmapServer) serveImage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != s.path {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && s.webhook {
+		s.receive(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		allow := "GET, HEAD"
+		if s.webhook {
+			allow += ", POST"
+		}
+		w.Header().Set("Allow", allow)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	start := time.Now()
+	query := r.URL.Query()
+	for name := range query {
+		if !serveParams[name] {
+			http.Error(w, fmt.Sprintf("unknown parameter %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	imageFormat := s.format
+	if query.Has("format") {
+		imageFormat = query.Get("format")
+		if _, ok := outputFormats[imageFormat]; !ok {
+			http.Error(w, fmt.Sprintf("unknown format %q", imageFormat), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Loading and rendering stop when the client goes away or the request
+	// takes longer than -request-timeout.
+	ctx := r.Context()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	tweets, defaultTitle, err := s.source.load(ctx, s.fs)
+	if err != nil {
+		s.metrics.dataError()
+		slog.Error("loading data failed", "err", err)
+		http.Error(w, err.Error(), failureStatus(err))
+		return
+	}
+
+	opts, err := requestRenderOptions(s.render, query.Get, query.Has, defaultTitle)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Card && imageFormat != "png" {
+		http.Error(w, "social cards are PNG only", http.StatusBadRequest)
+		return
+	}
+	if query.Has("width") || query.Has("height") {
+		if opts, err = fitPanel(tweets, opts, query.Get("width"), query.Get("height")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	etag, modified := s.versionOf(tweets, imageFormat, opts)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.maxAge.Seconds())))
+	if notModified(r, etag, modified) {
+		s.metrics.cacheResult("not_modified")
+		w.WriteHeader(http.StatusNotModified)
+		slog.Debug("request served", "path", r.URL.Path, "query", r.URL.RawQuery, "status", http.StatusNotModified, "elapsed", time.Since(start))
+		return
+	}
+
+	data, ok, err := s.renderCached(ctx, etag, imageFormat, tweets, opts)
+	if err != nil {
+		slog.Error("rendering failed", "err", err)
+		http.Error(w, err.Error(), failureStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", outputFormats[imageFormat])
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+	slog.Debug("request served", "path", r.URL.Path, "query", r.URL.RawQuery, "bytes", len(data), "cached", ok, "elapsed", time.Since(start))
+}
+
+// failureStatus is the status of a request that failed with err: a bad
+// request when its parameters do not fit the data, a gateway timeout when
+// it ran out of time, or else an internal error.
+func failureStatus(err error) int {
+	var ue usageError
+	switch {
+	case errors.As(err, &ue):
+		return http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// versionOf returns the ETag of the image for the given data and options,
+// and the time the data last changed.
+func (s *heatmapServer) versionOf(tweets []DailyTweet, format string, opts renderOptions) (string, time.Time) {
+	dataHash := dataKey(tweets)
+	etag := `"` + imageKey(dataHash, format, opts)[:32] + `"`
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dataHash != s.dataHash {
+		s.dataHash = dataHash
+		// HTTP dates have a resolution of one second.
+		s.dataSince = time.Now().Truncate(time.Second)
+	}
+	return etag, s.dataSince
+}
+
+// renderCached returns the image with the given ETag from the cache, or
+// renders and caches it. It reports whether the image was cached.
+func (s *heatmapServer) renderCached(ctx context.Context, etag, format string, tweets []DailyTweet, opts renderOptions) ([]byte, bool, error) {
+	if data, ok := s.cached(etag); ok {
+		s.metrics.cacheResult("hit")
+		return data, true, nil
+	}
+
+	s.metrics.cacheResult("miss")
+	start := time.Now()
+	data, err := renderHeatmap(ctx, format, tweets, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	s.metrics.observeRender(format, time.Since(start))
+	s.store(etag, data)
+	return data, false, nil
+}
+
+func (s *heatmapServer) cached(etag string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.cache[etag]
+	return data, ok
+}
+
+func (s *heatmapServer) store(etag string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cache == nil {
+		s.cache = make(map[string][]byte)
+	}
+	if _, ok := s.cache[etag]; ok {
+		return
+	}
+	if len(s.cacheOrder) == maxCachedImages {
+		delete(s.cache, s.cacheOrder[0])
+		s.cacheOrder = s.cacheOrder[1:]
+	}
+	s.cache[etag] = data
+	s.cacheOrder = append(s.cacheOrder, etag)
+}
+
+func hashTweets(h hash.Hash, tweets []DailyTweet) {
+	for _, tweet := range tweets {
+		fmt.Fprintf(h, "%s %d", tweet.Date.Format("2006-01-02"), tweet.Count)
+		names := make([]string, 0, len(tweet.Categories))
+		for name := range tweet.Categories {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(h, " %q %d", name, tweet.Categories[name])
+		}
+		fmt.Fprintln(h)
+	}
+}
+
+// hashRenderOptions writes opts to h as JSON, which names every field and
+// its value, so no two options hash alike and options added later take
+// part without being listed here.
+func hashRenderOptions(h hash.Hash, opts renderOptions) {
+	opts.CellSize = opts.cellSize()
+	if err := json.NewEncoder(h).Encode(opts); err != nil {
+		// Only NaN and infinite numbers fail to encode, and the flags,
+		// requests and theme files they come from reject them.
+		panic(err)
+	}
+}
+
+// notModified reports whether the request's conditional headers show the
+// client already has this version of the image. If-None-Match takes
+// precedence over If-Modified-Since.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.After(t)
+	}
+	return false
+}
+
+// requestRenderOptions combines the render flags with the parameters of a
+// request, each overriding the flag of its name, and validates them as
+// the flags are.
+func requestRenderOptions(f *renderFlags, get func(string) string, has func(string) bool, defaultTitle string) (renderOptions, error) {
+	if has("title") && len(get("title")) > maxTitleLength {
+		return renderOptions{}, errorf("title longer than %d bytes", maxTitleLength)
+	}
+	r, fs := f.clone()
+	if has("scale") {
+		// A scale asked for replaces fixed thresholds and a goal of the
+		// flags.
+		r.thresholds, r.goal = "", 0
+	}
+	// A request pinning one end of the window replaces both flags.
+	var err error
+	if has("from") || has("to") {
+		if r.from, r.to, err = grafanaRange(get("from"), get("to"), get("tz")); err != nil {
+			return renderOptions{}, err
+		}
+	}
+	fs.VisitAll(func(fl *flag.Flag) {
+		if err == nil && serveParams[fl.Name] && has(fl.Name) && fl.Name != "from" && fl.Name != "to" {
+			err = setParam(fs, fl.Name, fl.Name, get(fl.Name))
+		}
+	})
+	if err != nil {
+		return renderOptions{}, err
+	}
+	return r.options(defaultTitle)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"image/color"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func optionsHash(opts renderOptions) string {
+	h := sha256.New()
+	hashRenderOptions(h, opts)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// setField gives v a value other than its zero value.
+func setField(t *testing.T, name string, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(3)
+	case reflect.Float64:
+		v.SetFloat(1.5)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+	case reflect.Struct:
+		switch v.Interface().(type) {
+		case time.Time:
+			v.Set(reflect.ValueOf(time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)))
+		case color.RGBA:
+			v.Set(reflect.ValueOf(color.RGBA{1, 2, 3, 255}))
+		default:
+			t.Fatalf("%s: no value for %s", name, v.Type())
+		}
+	default:
+		t.Fatalf("%s: no value for %s", name, v.Type())
+	}
+}
+
+// TestHashRenderOptions checks that every field of the render options and
+// of their theme changes the hash, as the cached images they key differ.
+func TestHashRenderOptions(t *testing.T) {
+	base := optionsHash(renderOptions{})
+	check := func(name string, set func(opts *renderOptions) reflect.Value) {
+		var opts renderOptions
+		field := set(&opts)
+		if !field.CanSet() {
+			t.Errorf("%s is unexported, and JSON leaves it out of the hash", name)
+			return
+		}
+		setField(t, name, field)
+		if optionsHash(opts) == base {
+			t.Errorf("setting %s leaves the hash as it was", name)
+		}
+	}
+	optionsType := reflect.TypeOf(renderOptions{})
+	for i := 0; i < optionsType.NumField(); i++ {
+		name := optionsType.Field(i).Name
+		if name == "Theme" {
+			continue
+		}
+		check(name, func(opts *renderOptions) reflect.Value {
+			return reflect.ValueOf(opts).Elem().Field(i)
+		})
+	}
+	themeType := reflect.TypeOf(theme{})
+	for i := 0; i < themeType.NumField(); i++ {
+		check("Theme."+themeType.Field(i).Name, func(opts *renderOptions) reflect.Value {
+			return reflect.ValueOf(&opts.Theme).Elem().Field(i)
+		})
+	}
+
+	// A cell size of zero stands for the default, and hashes as it.
+	if optionsHash(renderOptions{CellSize: cellSize}) != base {
+		t.Errorf("the default cell size hashes apart from zero")
+	}
+}
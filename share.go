@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// maxShareExpiry is the longest a presigned S3 URL can stay valid.
+const maxShareExpiry = 7 * 24 * time.Hour
+
+// checkShare reports mistakes in the -share destination: "imgur", or an
+// s3:// destination the image is uploaded to and shared through a
+// presigned URL.
+func checkShare(target, output, format string, expires time.Duration) error {
+	if target == "imgur" {
+		if format != "png" {
+			return usageError(tr("imgur takes PNG images only; share a PNG instead"))
+		}
+		return nil
+	}
+	u, err := parsePublishTarget(target, output)
+	if err != nil || u.Scheme != "s3" {
+		return usageError(trf("invalid -share %q: want imgur or an s3:// destination", target))
+	}
+	if expires <= 0 || expires > maxShareExpiry {
+		return usageError(trf("-share-expires must be between 1s and %s", maxShareExpiry))
+	}
+	return nil
+}
+
+// share uploads an image and returns a URL anyone can view it at.
+func share(target, output string, up upload, expires time.Duration) (string, error) {
+	if target == "imgur" {
+		return shareImgur(up)
+	}
+
+	u, err := parsePublishTarget(target, output)
+	if err != nil {
+		return "", err
+	}
+	if err := publishS3(u, up); err != nil {
+		return "", err
+	}
+	creds, err := awsFromEnv()
+	if err != nil {
+		return "", err
+	}
+	return presignS3(u, expires, time.Now(), creds)
+}
+
+// shareImgur uploads an image to Imgur anonymously, with the application
+// client ID in IMGUR_CLIENT_ID.
+func shareImgur(up upload) (string, error) {
+	clientID := os.Getenv("IMGUR_CLIENT_ID")
+	if clientID == "" {
+		return "", errors.New(tr("IMGUR_CLIENT_ID must be set"))
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("image", "heatmap.png")
+	if err != nil {
+		return "", err
+	}
+	part.Write(up.data)
+	w.WriteField("type", "file")
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", "https://api.imgur.com/3/image", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Authorization", "Client-ID "+clientID)
+	var resp struct {
+		Data struct {
+			Link string `json:"link"`
+		} `json:"data"`
+	}
+	if err := getJSON(req, &resp); err != nil {
+		return "", err
+	}
+	if _, err := url.Parse(resp.Data.Link); err != nil || resp.Data.Link == "" {
+		return "", errorf("imgur returned no link")
+	}
+	return resp.Data.Link, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const slackAPI = "https://slack.com/api/"
+
+// postSlackWebhook posts the summary to an incoming webhook. Webhooks
+// cannot carry files, so the image appears only when it is hosted.
+func postSlackWebhook(webhookURL string, n notification) error {
+	blocks := []map[string]interface{}{{
+		"type": "section",
+		"text": map[string]string{"type": "mrkdwn", "text": slackSummary(n)},
+	}}
+	if n.imageURL != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type":      "image",
+			"image_url": n.imageURL,
+			"alt_text":  n.title,
+		})
+	}
+	return postJSON(webhookURL, map[string]interface{}{"text": n.text(), "blocks": blocks})
+}
+
+// uploadSlack uploads the image to a channel with the summary as its
+// comment, using the bot token in SLACK_BOT_TOKEN.
+func uploadSlack(channel string, n notification) error {
+	token := os.Getenv("SLACK_BOT_TOKEN")
+	if token == "" {
+		return errors.New(tr("SLACK_BOT_TOKEN must be set"))
+	}
+
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	form := url.Values{"filename": {n.filename}, "length": {strconv.Itoa(len(n.data))}}
+	req, err := http.NewRequest("POST", slackAPI+"files.getUploadURLExternal", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := slackCall(req, token, &upload); err != nil {
+		return err
+	}
+
+	req, err = http.NewRequest("POST", upload.UploadURL, bytes.NewReader(n.data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", n.contentType)
+	if err := sendAs(req, "Slack upload"); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"files":           []map[string]string{{"id": upload.FileID, "title": n.title}},
+		"channel_id":      channel,
+		"initial_comment": slackSummary(n),
+	})
+	if err != nil {
+		return err
+	}
+	req, err = http.NewRequest("POST", slackAPI+"files.completeUploadExternal", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return slackCall(req, token, nil)
+}
+
+// slackCall calls a Web API method, which reports failure in the body
+// rather than the status.
+func slackCall(req *http.Request, token string, v interface{}) error {
+	req.Header.Set("Authorization", "Bearer "+token)
+	var raw json.RawMessage
+	if err := getJSON(req, &raw); err != nil {
+		return err
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return err
+	}
+	if !status.OK {
+		return errorf("%s: %s", strings.TrimPrefix(req.URL.Path, "/api/"), status.Error)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// slackSummary is the text of the notification in Slack's mrkdwn, which
+// reserves &, < and > for links and mentions.
+func slackSummary(n notification) string {
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+	title, rest, _ := strings.Cut(n.text(), "\n")
+	return "*" + escape(title) + "*\n" + escape(rest)
+}
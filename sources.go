@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"flag"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+type sourceOptions struct {
+	Project string
+	Tag     string
+	User    string
+	Limits  inputLimits
+	// Column names the value column of CSV input; empty means the second.
+	Column string
+	// Weight scales the counts of the source when merging.
+	Weight float64
+}
+
+// sourceFlags holds the flags shared by every command that reads data.
+type sourceFlags struct {
+	name    string
+	input   string
+	options sourceOptions
+	timeout time.Duration // per source; zero waits as long as it takes
+	onError string        // what a failing source of several does: fail or skip
+	merge   string        // how the days of several sources combine
+
+	transforms stringList // -transform expressions, in order
+}
+
+func addSourceFlags(fs *flag.FlagSet) *sourceFlags {
+	f := &sourceFlags{}
+	fs.String("config", "", trf("config file (default %s if present)", defaultConfigFile))
+	fs.StringVar(&f.input, "input", "", "input file, as an alternative to the input argument")
+	fs.StringVar(&f.name, "source", "csv", trf("data source: %s, or NAME for a heatmap-source-NAME plugin", strings.Join(sourceNames(), ", ")))
+	fs.StringVar(&f.options.Project, "project", "", "only count entries belonging to this project")
+	fs.StringVar(&f.options.Tag, "tag", "", "only count entries carrying this tag or label")
+	fs.StringVar(&f.options.User, "user", "", "account name for sources that need one")
+	fs.StringVar(&f.options.Column, "column", "", "value column of CSV input, by header name, e.g. steps (default the second column)")
+	addLimitFlags(fs, &f.options.Limits)
+	fs.DurationVar(&f.timeout, "source-timeout", 0, "give up on a source after this long, e.g. 30s (default no limit)")
+	fs.StringVar(&f.onError, "on-source-error", "fail", "when one of several [[merge]] sources fails: fail, or skip it and render the rest")
+	fs.StringVar(&f.merge, "merge-strategy", "sum", trf("how a day of several [[merge]] sources combines: %s", strings.Join(mergeStrategyNames, ", ")))
+	fs.Float64Var(&f.options.Weight, "weight", 1, "weight of this source's counts under the sum and weighted merge strategies")
+	fs.Var(&f.transforms, "transform", "rewrite every day with data by this expression before rendering (repeatable): a number replaces the count, as in 'min(count, 100)' or 'count / 60'; true or false keeps or drops the day, as in '!weekend'")
+	return f
+}
+
+// load reads the data named by the flags and the command's optional input
+// argument, sorted by date with one entry per day, and transforms it.
+func (f *sourceFlags) load(ctx context.Context, fs *flag.FlagSet) ([]DailyTweet, string, error) {
+	expressions, err := compileTransforms(f.transforms)
+	if err != nil {
+		return nil, "", err
+	}
+	tweets, title, err := f.loadRaw(ctx, fs)
+	if err != nil {
+		return nil, "", err
+	}
+	start := time.Now()
+	tweets, duplicates, err := transformData(tweets, expressions)
+	timings.record("aggregate", start)
+	if err != nil {
+		return nil, "", err
+	}
+	if duplicates > 0 {
+		slog.Debug("duplicate dates in input; the last entry for each date was kept", "duplicates", duplicates)
+	}
+	return tweets, title, nil
+}
+
+// loadRaw is like load but returns the data as the source produced it.
+// Loading stops with the error of ctx when ctx ends.
+func (f *sourceFlags) loadRaw(ctx context.Context, fs *flag.FlagSet) ([]DailyTweet, string, error) {
+	if fs.NArg() > 1 {
+		return nil, "", usageError(tr("at most one input may be given"))
+	}
+	if err := checkSourceErrorPolicy(f.onError); err != nil {
+		return nil, "", err
+	}
+	if err := checkMerge(f.merge, f.options.Weight); err != nil {
+		return nil, "", err
+	}
+	merged, err := f.mergeSpecs(fs)
+	if err != nil {
+		return nil, "", err
+	}
+	specs := append([]sourceSpec{f.spec(f.inputPath(fs))}, merged...)
+
+	start := time.Now()
+	if len(specs) == 1 {
+		r := specs[0].fetch(ctx)
+		timings.record("parse", start)
+		if r.err != nil {
+			return nil, "", classifyLoadError(r.err)
+		}
+		slog.Debug("data loaded", "source", f.name, "input", specs[0].input, "days", len(r.tweets), "elapsed", r.elapsed)
+		return r.tweets, r.title, nil
+	}
+
+	// Sources are fetched at once, so the slowest rather than the sum of
+	// them sets how long loading takes.
+	results := fetchAll(ctx, specs)
+	timings.record("parse", start)
+	if err := ctx.Err(); err != nil {
+		return nil, "", inputError(err)
+	}
+	merging := time.Now()
+	tweets, title, err := mergeFetched(specs, results, f.onError, f.merge)
+	timings.record("aggregate", merging)
+	if err == nil {
+		err = f.options.Limits.checkCounts(tweets)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	slog.Debug("sources merged", "sources", len(specs), "days", len(tweets), "elapsed", time.Since(start))
+	return tweets, title, nil
+}
+
+// loadInput reads the given input with the source the flags name, ignoring
+// [[merge]] tables, and transforms it as load does. Commands reading
+// several inputs of the same kind use it.
+func (f *sourceFlags) loadInput(ctx context.Context, input string) ([]DailyTweet, string, error) {
+	expressions, err := compileTransforms(f.transforms)
+	if err != nil {
+		return nil, "", err
+	}
+	start := time.Now()
+	r := f.spec(input).fetch(ctx)
+	timings.record("parse", start)
+	if r.err != nil {
+		return nil, "", classifyLoadError(r.err)
+	}
+	start = time.Now()
+	tweets, _, err := transformData(r.tweets, expressions)
+	timings.record("aggregate", start)
+	if err != nil {
+		return nil, "", err
+	}
+	return tweets, r.title, nil
+}
+
+// inputPath returns the input file named by the command's input argument or
+// the -input flag.
+func (f *sourceFlags) inputPath(fs *flag.FlagSet) string {
+	if fs.NArg() == 1 {
+		return fs.Arg(0)
+	}
+	return f.input
+}
+
+// loadTweets reads daily totals from the named source. File-based sources
+// read inputFile; sources that also offer an API fall back to it when no
+// input file is given. The returned title suits the kind of data loaded.
+func loadTweets(ctx context.Context, source, inputFile string, opts sourceOptions) ([]DailyTweet, string, error) {
+	kind, ok := findSource(source)
+	if !ok {
+		return nil, "", usageError(trf("unknown source: %s", source))
+	}
+	src, err := kind.open(inputFile, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	tweets, err := src.Fetch(ctx)
+	title := kind.title
+	if t, ok := src.(titledSource); ok && t.sourceTitle() != "" {
+		title = t.sourceTitle()
+	}
+	return tweets, title, err
+}
+
+func readCSV(filename, column string, limits inputLimits) ([]DailyTweet, error) {
+	tweets, _, err := readCSVStats(filename, column, limits)
+	return tweets, err
+}
+
+// csvStats describes the rows behind the days of a CSV input.
+type csvStats struct {
+	rows       int // data rows read
+	duplicates int // rows replacing the count of a day given earlier
+}
+
+func readCSVStats(filename, column string, limits inputLimits) ([]DailyTweet, csvStats, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, csvStats{}, err
+	}
+	defer file.Close()
+
+	tweets, stats, err := parseCSV(file, column, limits)
+	if err != nil {
+		return nil, csvStats{}, err
+	}
+	slog.Debug("csv parsed", "file", filename, "rows", stats.rows, "days", len(tweets))
+	return tweets, stats, nil
+}
+
+// parseCSV reads CSV after a header row, adding the rows up per day as it
+// goes, so memory grows with the days covered rather than the rows. Rows
+// are either date,count with dates as YYYYMMDD, where a later row for a day
+// replaces an earlier one, or, in files with a single column, one event
+// each: a YYYYMMDD or YYYY-MM-DD date, or an RFC 3339 time counted toward
+// the day in its own time zone. A date,count file whose header names a
+// later column "category" gives each row's count to that category; a later
+// row for a day and category replaces an earlier one, and the day's count
+// is the sum of its categories.
+//
+// A column named in the header, as in spreadsheet exports with several
+// values a day, replaces the second as the count. Its dates may also be
+// YYYY-MM-DD, decimals are rounded and rows with the cell empty are left
+// out. It stops at the row and count limits.
+func parseCSV(r io.Reader, column string, limits inputLimits) ([]DailyTweet, csvStats, error) {
+	reader := csv.NewReader(bufio.NewReaderSize(r, 1<<16))
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, csvStats{}, err
+	}
+	valueColumn := 1
+	if column != "" {
+		if valueColumn = headerIndex(header, column); valueColumn < 1 {
+			return nil, csvStats{}, errorf("no value column %q in the header %q", column, strings.Join(header, ","))
+		}
+	}
+	categoryColumn := headerIndex(header, "category")
+	if categoryColumn < 2 {
+		categoryColumn = -1
+	}
+
+	var stats csvStats
+	totals := make(map[civilDate]int)
+	categories := make(map[civilDate]map[string]int)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, csvStats{}, err
+		}
+		stats.rows++
+		if err := limits.checkRows(stats.rows); err != nil {
+			return nil, csvStats{}, err
+		}
+
+		if len(record) == 1 {
+			date, err := parseEventDate(record[0])
+			if err != nil {
+				return nil, csvStats{}, err
+			}
+			totals[civil(date)]++
+			continue
+		}
+
+		var (
+			date  time.Time
+			count int
+		)
+		if column == "" {
+			if date, err = time.Parse("20060102", record[0]); err != nil {
+				return nil, csvStats{}, err
+			}
+			if count, err = strconv.Atoi(record[1]); err != nil {
+				return nil, csvStats{}, err
+			}
+		} else {
+			value := strings.TrimSpace(record[valueColumn])
+			if value == "" {
+				continue
+			}
+			if date, err = parseEventDate(strings.TrimSpace(record[0])); err != nil {
+				return nil, csvStats{}, err
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, csvStats{}, errorf("row %d: %s is not a number: %q", stats.rows, header[valueColumn], value)
+			}
+			count = int(math.Round(v))
+		}
+
+		key := civil(date)
+		if categoryColumn >= 0 && len(record) > categoryColumn {
+			name := strings.TrimSpace(record[categoryColumn])
+			if name == "" {
+				name = uncategorized
+			}
+			day := categories[key]
+			if day == nil {
+				day = make(map[string]int)
+				categories[key] = day
+			}
+			if previous, ok := day[name]; ok {
+				stats.duplicates++
+				totals[key] -= previous
+			}
+			day[name] = count
+			totals[key] += count
+			continue
+		}
+
+		if _, ok := totals[key]; ok {
+			stats.duplicates++
+		}
+		totals[key] = count
+	}
+
+	tweets := dailyTotals(totals)
+	for i := range tweets {
+		tweets[i].Categories = categories[civil(tweets[i].Date)]
+	}
+	if err := limits.checkCounts(tweets); err != nil {
+		return nil, csvStats{}, err
+	}
+	return tweets, stats, nil
+}
+
+// headerIndex returns the index of the column of header called name,
+// ignoring case and surrounding space, or -1.
+func headerIndex(header []string, name string) int {
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(name)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseEventDate returns the day of an event row.
+func parseEventDate(s string) (time.Time, error) {
+	switch {
+	case len(s) == 8:
+		return time.Parse("20060102", s)
+	case len(s) == 10:
+		return time.Parse("2006-01-02", s)
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day(t), nil
+}
+
+// day truncates t to midnight UTC of its calendar date in its own location,
+// which is how dates leave the sources.
+func day(t time.Time) time.Time {
+	return civil(t).time()
+}
+
+// normalizeTweets sorts tweets by date and drops all but the last entry for
+// each date, matching how the heatmap looks up counts. It reports how many
+// entries were dropped.
+func normalizeTweets(tweets []DailyTweet) ([]DailyTweet, int) {
+	sorted := make([]DailyTweet, len(tweets))
+	copy(sorted, tweets)
+	// Sources parsing dates themselves may give them a zone or a time of
+	// day; a date is its day.
+	for i := range sorted {
+		sorted[i].Date = day(sorted[i].Date)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	var out []DailyTweet
+	for _, tweet := range sorted {
+		if len(out) > 0 && out[len(out)-1].Date.Equal(tweet.Date) {
+			out[len(out)-1] = tweet
+			continue
+		}
+		out = append(out, tweet)
+	}
+	return out, len(tweets) - len(out)
+}
+
+// lastYear returns the half-open range of dates covered by API sources: the
+// year leading up to and including today.
+func lastYear() (from, end time.Time) {
+	end = addDate(day(time.Now()), 0, 0, 1)
+	return addDate(end, -1, 0, 0), end
+}
+
+// eachMonth calls fn for consecutive month-long ranges covering [from, end),
+// for APIs that reject long date ranges. The last range may be shorter.
+func eachMonth(from, end time.Time, fn func(from, to time.Time) error) error {
+	for ; from.Before(end); from = addDate(from, 0, 1, 0) {
+		to := addDate(from, 0, 1, 0)
+		if to.After(end) {
+			to = end
+		}
+		if err := fn(from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dailyTotals converts per-day totals into a date-sorted slice.
+func dailyTotals(totals map[civilDate]int) []DailyTweet {
+	tweets := make([]DailyTweet, 0, len(totals))
+	for date, count := range totals {
+		tweets = append(tweets, DailyTweet{Date: date.time(), Count: count})
+	}
+	sort.Slice(tweets, func(i, j int) bool {
+		return tweets[i].Date.Before(tweets[j].Date)
+	})
+	return tweets
+}
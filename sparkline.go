@@ -0,0 +1,117 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"golang.org/x/image/vector"
+)
+
+// sparklineStyles are how -sparkline charts the weekly totals under the
+// grid: not at all, as a bar under each week, or as a line through them.
+var sparklineStyles = []string{"none", "bars", "line"}
+
+// sparkHeight is the height of the sparkline with the room above it.
+const sparkHeight = 40
+
+// checkSparkline validates -sparkline, returning "" for none. Only the
+// year of weeks has weeks for it to line up with.
+func checkSparkline(style string, opts renderOptions) (string, error) {
+	switch style {
+	case "none":
+		return "", nil
+	case "bars", "line":
+		if opts.Layout != "" || opts.Card {
+			return "", usageError(tr("-sparkline lines up with the weeks of the year layout; it does not apply to -layout or -card"))
+		}
+		return style, nil
+	}
+	return "", usageError(trf("unknown sparkline style %q (available: %s)", style, strings.Join(sparklineStyles, ", ")))
+}
+
+// layoutLine is a polyline of the given width, as of a sparkline.
+type layoutLine struct {
+	points []image.Point
+	width  int
+	color  color.RGBA
+}
+
+// addSparkline charts the total of each week of the grid of hm in a strip
+// from top down, each bar or point under its week's column, scaled to the
+// largest, which the label under the strip gives.
+func (l *layout) addSparkline(hm heatmap, opts renderOptions, top int) {
+	cell, gap := opts.cellSize(), opts.Theme.Gap
+	totals := make([]int, numWeeks)
+	most := 0
+	for week := range totals {
+		for day := 0; day < daysInWeek; day++ {
+			totals[week] += hm.counts[civil(addDate(hm.start, 0, 0, week*7+day))]
+		}
+		most = max(most, totals[week])
+	}
+	top += 10
+	bottom := top + sparkHeight - 10
+	height := func(total int) int {
+		if most <= 0 || total <= 0 {
+			return 0
+		}
+		return int(math.Round(float64(total) / float64(most) * float64(bottom-top)))
+	}
+	strongest := opts.Theme.Colors[len(opts.Theme.Colors)-1]
+	line := layoutLine{width: 2, color: strongest}
+	for week, total := range totals {
+		x := week * (cell + gap)
+		if opts.Sparkline == "bars" {
+			l.bars = append(l.bars, layoutSwatch{rect: image.Rect(x, bottom-height(total), x+cell, bottom), color: strongest})
+		} else {
+			line.points = append(line.points, image.Pt(x+cell/2, bottom-height(total)))
+		}
+	}
+	if len(line.points) > 0 {
+		l.lines = append(l.lines, line)
+	}
+	l.bars = append(l.bars, layoutSwatch{rect: image.Rect(0, bottom, gridWidth(cell, gap), bottom+1), color: mix(opts.Theme.Text, opts.Theme.Background, 0.6)})
+	l.labels = append(l.labels, layoutText{10, bottom + 15, opts.Theme.labelf("Weekly totals, largest %s", formatCount(most))})
+	l.height = max(l.height, bottom+20)
+}
+
+// drawLine strokes the line into img, anti-aliased, as a quad along each
+// segment.
+func drawLine(img *image.RGBA, line layoutLine) {
+	if len(line.points) < 2 {
+		return
+	}
+	box := image.Rectangle{Min: line.points[0], Max: line.points[0]}
+	for _, p := range line.points {
+		box = box.Union(image.Rectangle{Min: p, Max: p.Add(image.Pt(1, 1))})
+	}
+	box = box.Inset(-line.width).Intersect(img.Bounds())
+	if box.Empty() {
+		return
+	}
+	z := vector.NewRasterizer(box.Dx(), box.Dy())
+	z.DrawOp = draw.Over
+	half := float64(line.width) / 2
+	for i := 1; i < len(line.points); i++ {
+		a, b := line.points[i-1].Sub(box.Min), line.points[i].Sub(box.Min)
+		dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+		length := math.Hypot(dx, dy)
+		if length == 0 {
+			continue
+		}
+		// The normal, half the width long, and the same along the segment
+		// so neighbouring quads overlap at the joints.
+		nx, ny := -dy/length*half, dx/length*half
+		ex, ey := dx/length*half/2, dy/length*half/2
+		ax, ay, bx, by := float64(a.X)-ex, float64(a.Y)-ey, float64(b.X)+ex, float64(b.Y)+ey
+		z.MoveTo(float32(ax+nx), float32(ay+ny))
+		z.LineTo(float32(bx+nx), float32(by+ny))
+		z.LineTo(float32(bx-nx), float32(by-ny))
+		z.LineTo(float32(ax-nx), float32(ay-ny))
+		z.ClosePath()
+	}
+	z.Draw(img, box, image.NewUniform(line.color), image.Point{})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"image"
+	"math"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/font"
+)
+
+// The spiral layout winds the years of hm outward from a hole in the
+// middle, a loop a year two cells apart, each loop's days a cell and a half
+// thick.
+const (
+	spiralHole  = 3 // the radius of the hole, in cells
+	spiralPitch = 2 // how far each loop is outside the last, in cells
+
+	// maxSpiralSize caps the width of the spiral in pixels, as every year
+	// widens it by two pitches and an image of dates from year 1 to 9999
+	// would not fit in memory.
+	maxSpiralSize = 8192
+)
+
+// spiralSpan returns the first and last day the spiral of hm shows: the
+// first and last with data, or opts.From and opts.To.
+func spiralSpan(hm heatmap, opts renderOptions) (time.Time, time.Time) {
+	first, last := hm.start, hm.start
+	var found bool
+	for key := range hm.counts {
+		date := key.time()
+		if (!opts.From.IsZero() && date.Before(opts.From)) || (!opts.To.IsZero() && date.After(opts.To)) {
+			continue
+		}
+		if !found || date.Before(first) {
+			first = date
+		}
+		if !found || date.After(last) {
+			last = date
+		}
+		found = true
+	}
+	if !opts.From.IsZero() {
+		first = opts.From
+	}
+	if !opts.To.IsZero() {
+		last = opts.To
+	}
+	return first, last
+}
+
+// spiralSize returns the radius of the outside of the last of the given
+// number of loops and the width of the spiral around it.
+func spiralSize(years, cell int) (float64, int) {
+	pitch := float64(spiralPitch * cell)
+	outer := float64(spiralHole*cell) + float64(years)*pitch + pitch - pitch/4
+	return outer, 2*int(math.Ceil(outer)) + 2*radialMargin
+}
+
+// checkSpiral rejects a spiral of hm wider than maxSpiralSize.
+func checkSpiral(hm heatmap, opts renderOptions) error {
+	first, last := spiralSpan(hm, opts)
+	years := last.Year() - first.Year() + 1
+	if _, size := spiralSize(years, opts.cellSize()); size > maxSpiralSize {
+		return usageError(trf("-layout spiral of the %d years from %d to %d would be %d pixels wide, more than %d; narrow the dates with -from and -to or make -cell smaller",
+			years, first.Year(), last.Year(), size, maxSpiralSize))
+	}
+	return nil
+}
+
+// spiralLayout arranges every year of hm, from January 1 of the first with
+// data, or of opts.From, to the last day with data, or opts.To, on one
+// spiral, a loop a year clockwise from twelve o'clock, so the same time of
+// each year lines up along a radius. The months are marked outside the last
+// loop and the years of the first and last loop named in the middle.
+func spiralLayout(hm heatmap, opts renderOptions) layout {
+	cell := opts.cellSize()
+	face := opts.Theme.newFace()
+
+	first, last := spiralSpan(hm, opts)
+	firstYear := first.Year()
+	years := last.Year() - firstYear + 1
+
+	pitch := float64(spiralPitch * cell)
+	hole := float64(spiralHole * cell)
+	thickness := pitch - pitch/4
+	outer, size := spiralSize(years, cell)
+	center := image.Pt(size/2, titleHeight+size/2)
+	legendX := size + 10
+	l := layout{width: legendX - 10 + legendWidth, height: titleHeight + size + 10}
+	l.labels = append(l.labels, layoutText{10, 25, opts.Title})
+
+	var shown []DailyTweet
+	for date := time.Date(firstYear, time.January, 1, 0, 0, 0, 0, time.UTC); !date.After(last); date = addDate(date, 0, 0, 1) {
+		if date.Before(first) || !placed(date, opts.LeapDay) {
+			continue
+		}
+		year := time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		days := float64(places(year, addDate(year, 1, 0, 0), opts.LeapDay))
+		place := float64(places(year, date, opts.LeapDay))
+		step := 2 * math.Pi / days
+		along := float64(date.Year()-firstYear) + place/days
+		inner := hole + along*pitch
+		// Each day reaches half a pixel into the next, as in the wheel.
+		from, to := place*step, (place+1)*step+0.5/inner
+		l.sectors = append(l.sectors, newSector(dayCell(hm, date, image.Rectangle{}), center, inner, inner+thickness, from, to))
+		if count, ok := hm.counts[civil(date)]; ok {
+			shown = append(shown, DailyTweet{Date: date, Count: count})
+		}
+	}
+	lastYear := time.Date(last.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	l.addMonthTicks(face, lastYear, places(lastYear, addDate(lastYear, 1, 0, 0), opts.LeapDay), opts.LeapDay, center, outer, opts.Theme)
+
+	lines := []string{strconv.Itoa(firstYear)}
+	if years > 1 {
+		lines = []string{opts.Theme.labelf("%d inside", firstYear), opts.Theme.labelf("%d outside", last.Year())}
+	}
+	for i, line := range lines {
+		width := font.MeasureString(face, line).Ceil()
+		l.labels = append(l.labels, layoutText{center.X - width/2, center.Y + i*panelLine, line})
+	}
+
+	sum := summary{}
+	if len(shown) > 0 {
+		sum = summarize(shown)
+	}
+	l.addLegend(face, hm, opts, legendX, titleHeight+monthHeight+10)
+	l.addSummary(face, sum, opts, legendX)
+	return l
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// sqliteDB is a minimal read-only reader for SQLite database files held in
+// memory. It understands just enough of the file format to walk table
+// b-trees, which avoids depending on cgo or a full SQL engine for the few
+// sources that ship their data as SQLite.
+type sqliteDB struct {
+	data     []byte
+	pageSize int
+	usable   int
+}
+
+const sqliteHeader = "SQLite format 3\x00"
+
+func openSQLite(data []byte) (*sqliteDB, error) {
+	if len(data) < 100 || string(data[:16]) != sqliteHeader {
+		return nil, malformedf("not a SQLite database")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, malformedf("sqlite: invalid page size %d", pageSize)
+	}
+	reserved := int(data[20])
+	// SQLite itself requires 480 usable bytes a page, which the payload
+	// arithmetic relies on.
+	if pageSize-reserved < 480 {
+		return nil, malformedf("sqlite: %d reserved bytes leave too little of a %d-byte page", reserved, pageSize)
+	}
+	if len(data) < pageSize {
+		return nil, malformedf("sqlite: truncated database")
+	}
+
+	return &sqliteDB{data: data, pageSize: pageSize, usable: pageSize - reserved}, nil
+}
+
+func (db *sqliteDB) page(n int) ([]byte, error) {
+	start := (n - 1) * db.pageSize
+	if n < 1 || start+db.pageSize > len(db.data) {
+		return nil, malformedf("sqlite: page %d out of range", n)
+	}
+	return db.data[start : start+db.pageSize], nil
+}
+
+// tableRoot looks up the root page of the named table in sqlite_master.
+func (db *sqliteDB) tableRoot(name string) (int, error) {
+	root := 0
+	err := db.scanTable(1, func(rowid int64, record []interface{}) error {
+		if len(record) < 4 {
+			return nil
+		}
+		if record[0] == "table" && record[1] == name {
+			if n, ok := record[3].(int64); ok {
+				root = int(n)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if root == 0 {
+		return 0, malformedf("sqlite: no table named %q", name)
+	}
+	return root, nil
+}
+
+// scanTable calls fn for every row of the table b-tree rooted at page root,
+// in rowid order.
+func (db *sqliteDB) scanTable(root int, fn func(rowid int64, record []interface{}) error) error {
+	return db.walkTable(root, map[int]bool{}, fn)
+}
+
+// walkTable is scanTable below page n, with the pages already walked in
+// seen, so a corrupt tree whose pages point back up fails instead of
+// looping. Every offset read from the file is checked against the page
+// before it is used.
+func (db *sqliteDB) walkTable(n int, seen map[int]bool, fn func(rowid int64, record []interface{}) error) error {
+	if seen[n] {
+		return malformedf("sqlite: page %d is reached twice", n)
+	}
+	seen[n] = true
+	page, err := db.page(n)
+	if err != nil {
+		return err
+	}
+	page = page[:db.usable]
+
+	// Page 1 starts with the database header.
+	hdr := 0
+	if n == 1 {
+		hdr = 100
+	}
+
+	kind := page[hdr]
+	headerSize := 8
+	if kind == 0x05 {
+		headerSize = 12
+	}
+	if hdr+headerSize > len(page) {
+		return malformedf("sqlite: page %d is truncated", n)
+	}
+	cells := int(binary.BigEndian.Uint16(page[hdr+3 : hdr+5]))
+	pointers := page[hdr+headerSize:]
+	if 2*cells > len(pointers) {
+		return malformedf("sqlite: page %d claims %d cells", n, cells)
+	}
+	cell := func(i, min int) (int, error) {
+		off := int(binary.BigEndian.Uint16(pointers[2*i:]))
+		if off < hdr+headerSize+2*cells || off+min > len(page) {
+			return 0, malformedf("sqlite: page %d has a cell at offset %d, outside the page", n, off)
+		}
+		return off, nil
+	}
+
+	switch kind {
+	case 0x05: // interior table page
+		for i := 0; i < cells; i++ {
+			off, err := cell(i, 4)
+			if err != nil {
+				return err
+			}
+			child := int(binary.BigEndian.Uint32(page[off:]))
+			if err := db.walkTable(child, seen, fn); err != nil {
+				return err
+			}
+		}
+		return db.walkTable(int(binary.BigEndian.Uint32(page[hdr+8:])), seen, fn)
+	case 0x0d: // leaf table page
+		for i := 0; i < cells; i++ {
+			off, err := cell(i, 1)
+			if err != nil {
+				return err
+			}
+			size, k := sqliteVarint(page[off:])
+			off += k
+			if off >= len(page) {
+				return malformedf("sqlite: page %d has a truncated cell", n)
+			}
+			rowid, k := sqliteVarint(page[off:])
+			off += k
+
+			if size < 0 || size > int64(len(db.data)) {
+				return malformedf("sqlite: page %d has a cell of %d bytes", n, size)
+			}
+			payload, err := db.payload(page, off, int(size))
+			if err != nil {
+				return err
+			}
+			record, err := sqliteRecord(payload)
+			if err != nil {
+				return err
+			}
+			if err := fn(rowid, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return malformedf("sqlite: page %d is not a table page", n)
+	}
+}
+
+// payload assembles a cell's payload, following overflow pages when it does
+// not fit on the leaf page. page holds the usable bytes of the leaf page
+// alone.
+func (db *sqliteDB) payload(page []byte, off, size int) ([]byte, error) {
+	maxLocal := db.usable - 35
+	if size <= maxLocal {
+		if off+size > len(page) {
+			return nil, malformedf("sqlite: cell of %d bytes runs off its page", size)
+		}
+		return page[off : off+size], nil
+	}
+
+	minLocal := (db.usable-12)*32/255 - 23
+	local := minLocal + (size-minLocal)%(db.usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	if off+local+4 > len(page) {
+		return nil, malformedf("sqlite: cell of %d bytes runs off its page", size)
+	}
+
+	payload := make([]byte, 0, size)
+	payload = append(payload, page[off:off+local]...)
+	next := int(binary.BigEndian.Uint32(page[off+local:]))
+	// Each overflow page adds usable-4 bytes, so the loop ends within
+	// size/(usable-4) pages even on a chain that loops.
+	for len(payload) < size && next != 0 {
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		n := size - len(payload)
+		if n > db.usable-4 {
+			n = db.usable - 4
+		}
+		payload = append(payload, overflow[4:4+n]...)
+		next = int(binary.BigEndian.Uint32(overflow))
+	}
+	if len(payload) < size {
+		return nil, malformedf("sqlite: truncated overflow chain")
+	}
+	return payload, nil
+}
+
+// sqliteRecord decodes a record into int64, float64, string, []byte, or nil
+// column values.
+func sqliteRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := sqliteVarint(payload)
+	if headerSize < int64(n) || headerSize > int64(len(payload)) {
+		return nil, malformedf("sqlite: malformed record")
+	}
+
+	var types []int64
+	for pos := n; pos < int(headerSize); {
+		t, n := sqliteVarint(payload[pos:])
+		types = append(types, t)
+		pos += n
+	}
+
+	record := make([]interface{}, len(types))
+	body := payload[headerSize:]
+	for i, t := range types {
+		var size int
+		switch {
+		case t == 0 || t == 8 || t == 9:
+			size = 0
+		case t >= 1 && t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6 || t == 7:
+			size = 8
+		case t >= 12:
+			size = int(t-12) / 2
+		default:
+			return nil, malformedf("sqlite: unsupported serial type %d", t)
+		}
+		if size > len(body) {
+			return nil, malformedf("sqlite: malformed record")
+		}
+		value := body[:size]
+		body = body[size:]
+
+		switch {
+		case t == 0:
+			record[i] = nil
+		case t == 8:
+			record[i] = int64(0)
+		case t == 9:
+			record[i] = int64(1)
+		case t == 7:
+			record[i] = math.Float64frombits(binary.BigEndian.Uint64(value))
+		case t <= 6:
+			var v int64
+			for _, b := range value {
+				v = v<<8 | int64(b)
+			}
+			// Sign-extend from the stored width.
+			shift := 64 - 8*uint(size)
+			record[i] = v << shift >> shift
+		case t%2 == 0:
+			record[i] = value
+		default:
+			record[i] = string(value)
+		}
+	}
+	return record, nil
+}
+
+// sqliteVarint decodes a SQLite variable-length integer, returning the value
+// and the number of bytes consumed.
+func sqliteVarint(b []byte) (int64, int) {
+	var v int64
+	for i := 0; i < 8 && i < len(b); i++ {
+		v = v<<7 | int64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	if len(b) < 9 {
+		return v, len(b)
+	}
+	return v<<8 | int64(b[8]), 9
+}
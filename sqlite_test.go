@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testdata/revlog.anki2 is a database of 512-byte pages holding a revlog
+// table of 300 rows, deep enough for interior pages, and a notes table with
+// one row of 3000 bytes, long enough for an overflow chain.
+
+func readTestDB(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/revlog.anki2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// scanSQLite reads every row of every table of data, as a source would.
+func scanSQLite(data []byte) (rows int, err error) {
+	db, err := openSQLite(data)
+	if err != nil {
+		return 0, err
+	}
+	var roots []int
+	err = db.scanTable(1, func(rowid int64, record []interface{}) error {
+		if len(record) >= 4 && record[0] == "table" {
+			if n, ok := record[3].(int64); ok {
+				roots = append(roots, int(n))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, root := range roots {
+		err := db.scanTable(root, func(rowid int64, record []interface{}) error {
+			rows++
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return rows, nil
+}
+
+// wantMalformed fails unless err reports malformed input.
+func wantMalformed(t *testing.T, err error, what string) {
+	t.Helper()
+	var ee *exitError
+	if !errors.As(err, &ee) || ee.code != exitParse {
+		t.Errorf("%s: got error %v, want a parse error", what, err)
+	}
+}
+
+func TestSQLiteReadsTables(t *testing.T) {
+	db, err := openSQLite(readTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := db.tableRoot("revlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := 0
+	err = db.scanTable(root, func(rowid int64, record []interface{}) error {
+		rows++
+		if len(record) != 9 {
+			t.Fatalf("row %d has %d columns, want 9", rowid, len(record))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 300 {
+		t.Errorf("read %d revlog rows, want 300", rows)
+	}
+
+	root, err = db.tableRoot("notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.scanTable(root, func(rowid int64, record []interface{}) error {
+		if s, ok := record[1].(string); !ok || s != strings.Repeat("x", 3000) {
+			t.Errorf("overflowing note read as %.20q…", record[1])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteTruncated(t *testing.T) {
+	data := readTestDB(t)
+	for n := 0; n < len(data); n += 37 {
+		_, err := scanSQLite(data[:n])
+		wantMalformed(t, err, fmt.Sprintf("truncated to %d bytes", n))
+	}
+}
+
+// TestSQLiteCorrupted flips each byte of the database in turn; whatever
+// the reader makes of the result, it must not panic or loop.
+func TestSQLiteCorrupted(t *testing.T) {
+	data := readTestDB(t)
+	corrupt := make([]byte, len(data))
+	for i := range data {
+		copy(corrupt, data)
+		corrupt[i] ^= 0xff
+		if _, err := scanSQLite(corrupt); err != nil {
+			wantMalformed(t, err, fmt.Sprintf("byte %d flipped", i))
+		}
+	}
+}
+
+func TestSQLiteMalformedHeaderAndPages(t *testing.T) {
+	const pageSize = 512
+	// leafOf finds the first leaf page of the revlog table.
+	leafOf := func(data []byte) int {
+		db, _ := openSQLite(data)
+		root, _ := db.tableRoot("revlog")
+		page, _ := db.page(root)
+		cell := binary.BigEndian.Uint16(page[12:])
+		return int(binary.BigEndian.Uint32(page[cell:]))
+	}
+	tests := []struct {
+		name   string
+		modify func(data []byte)
+	}{
+		{"page size 0", func(data []byte) { binary.BigEndian.PutUint16(data[16:], 0) }},
+		{"page size not a power of two", func(data []byte) { binary.BigEndian.PutUint16(data[16:], 1000) }},
+		{"too many reserved bytes", func(data []byte) { data[20] = 255 }},
+		{"cell offset past the page", func(data []byte) {
+			leaf := (leafOf(data) - 1) * pageSize
+			binary.BigEndian.PutUint16(data[leaf+8:], 65520)
+		}},
+		{"too many cells", func(data []byte) {
+			leaf := (leafOf(data) - 1) * pageSize
+			binary.BigEndian.PutUint16(data[leaf+3:], 1000)
+		}},
+		{"interior page pointing to itself", func(data []byte) {
+			db, _ := openSQLite(data)
+			root, _ := db.tableRoot("revlog")
+			binary.BigEndian.PutUint32(data[(root-1)*pageSize+8:], uint32(root))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := readTestDB(t)
+			tt.modify(data)
+			_, err := scanSQLite(data)
+			wantMalformed(t, err, tt.name)
+		})
+	}
+}
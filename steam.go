@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Steam only reports lifetime playtime per game plus the total of the last
+// two weeks, never playtime per day. Daily minutes are therefore derived
+// from snapshots of lifetime playtime kept in a state file between runs:
+// whatever was played since the previous snapshot is spread evenly over the
+// days in between. Running the tool daily gives exact figures.
+type steamState struct {
+	SteamID  string         `json:"steamid"`
+	Snapshot *steamSnapshot `json:"snapshot,omitempty"`
+	Days     map[string]int `json:"days"`
+}
+
+type steamSnapshot struct {
+	Date     string         `json:"date"`
+	Playtime map[string]int `json:"playtime"`
+}
+
+type steamGame struct {
+	AppID           int `json:"appid"`
+	PlaytimeForever int `json:"playtime_forever"`
+	Playtime2Weeks  int `json:"playtime_2weeks"`
+}
+
+// loadSteamPlaytime returns minutes played per day from the state file,
+// first recording a new snapshot from the Steam Web API when an API key is
+// available. stateFile defaults to a per-user cache location.
+func loadSteamPlaytime(ctx context.Context, apiKey string, opts sourceOptions, stateFile string) ([]DailyTweet, error) {
+	user := opts.User
+	if stateFile == "" {
+		if user == "" {
+			return nil, errorf("steam: -user is required")
+		}
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		stateFile = filepath.Join(dir, "heatmap-generator", "steam-"+user+".json")
+	}
+
+	state, err := readSteamState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey != "" {
+		if user == "" {
+			user = state.SteamID
+		}
+		if user == "" {
+			return nil, errorf("steam: -user is required")
+		}
+		steamID, err := resolveSteamID(ctx, apiKey, user, opts.Limits)
+		if err != nil {
+			return nil, err
+		}
+		games, err := fetchSteamGames(ctx, apiKey, steamID, opts.Limits)
+		if err != nil {
+			return nil, err
+		}
+		state.SteamID = steamID
+		state.record(day(time.Now()), games)
+		if err := writeSteamState(stateFile, state); err != nil {
+			return nil, err
+		}
+	} else if state.Snapshot == nil {
+		return nil, errorf("steam: no recorded playtime in %s; set STEAM_API_KEY to take a snapshot", stateFile)
+	}
+
+	totals := make(map[civilDate]int)
+	for date, minutes := range state.Days {
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, errorf("%s: %w", stateFile, err)
+		}
+		totals[civil(d)] = minutes
+	}
+	return dailyTotals(totals), nil
+}
+
+// record folds a new playtime snapshot taken on today into the daily totals.
+func (s *steamState) record(today time.Time, games []steamGame) {
+	if s.Days == nil {
+		s.Days = make(map[string]int)
+	}
+
+	playtime := make(map[string]int, len(games))
+	for _, g := range games {
+		playtime[strconv.Itoa(g.AppID)] = g.PlaytimeForever
+	}
+
+	if s.Snapshot == nil {
+		// Without an earlier snapshot the two-week totals are the best
+		// available history.
+		recent := 0
+		for _, g := range games {
+			recent += g.Playtime2Weeks
+		}
+		spreadMinutes(s.Days, addDate(today, 0, 0, -13), today, recent)
+	} else {
+		played := 0
+		for appID, minutes := range playtime {
+			if delta := minutes - s.Snapshot.Playtime[appID]; delta > 0 {
+				played += delta
+			}
+		}
+		last, err := time.Parse("2006-01-02", s.Snapshot.Date)
+		if err != nil || !last.Before(today) {
+			last = addDate(today, 0, 0, -1)
+		}
+		spreadMinutes(s.Days, addDate(last, 0, 0, 1), today, played)
+	}
+
+	s.Snapshot = &steamSnapshot{Date: today.Format("2006-01-02"), Playtime: playtime}
+}
+
+// spreadMinutes adds minutes to days evenly over the inclusive range
+// [from, to], giving any remainder to the latest days.
+func spreadMinutes(days map[string]int, from, to time.Time, minutes int) {
+	n := daysBetween(from, to) + 1
+	for i := 0; i < n; i++ {
+		share := minutes / n
+		if i >= n-minutes%n {
+			share++
+		}
+		if share > 0 {
+			days[addDate(from, 0, 0, i).Format("2006-01-02")] += share
+		}
+	}
+}
+
+func readSteamState(filename string) (*steamState, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return &steamState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state steamState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errorf("%s: %w", filename, err)
+	}
+	return &state, nil
+}
+
+func writeSteamState(filename string, state *steamState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted run cannot lose
+	// the accumulated history.
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// resolveSteamID returns user unchanged when it is a numeric SteamID and
+// otherwise resolves it as a custom profile URL name.
+func resolveSteamID(ctx context.Context, apiKey, user string, limits inputLimits) (string, error) {
+	if _, err := strconv.ParseUint(user, 10, 64); err == nil {
+		return user, nil
+	}
+
+	query := url.Values{}
+	query.Set("key", apiKey)
+	query.Set("vanityurl", user)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.steampowered.com/ISteamUser/ResolveVanityURL/v1/?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Response struct {
+			SteamID string `json:"steamid"`
+			Success int    `json:"success"`
+		} `json:"response"`
+	}
+	if err := limits.getJSON(req, &resp); err != nil {
+		return "", err
+	}
+	if resp.Response.Success != 1 {
+		return "", errorf("steam: no profile named %q", user)
+	}
+	return resp.Response.SteamID, nil
+}
+
+func fetchSteamGames(ctx context.Context, apiKey, steamID string, limits inputLimits) ([]steamGame, error) {
+	query := url.Values{}
+	query.Set("key", apiKey)
+	query.Set("steamid", steamID)
+	query.Set("include_played_free_games", "1")
+	query.Set("format", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.steampowered.com/IPlayerService/GetOwnedGames/v1/?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Response struct {
+			Games []steamGame `json:"games"`
+		} `json:"response"`
+	}
+	if err := limits.getJSON(req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Response.Games, nil
+}
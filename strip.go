@@ -0,0 +1,40 @@
+package main
+
+import (
+	"image"
+)
+
+// checkStripWrap validates -strip-wrap, which only the strip layout draws
+// with.
+func checkStripWrap(wrap int, opts renderOptions) (int, error) {
+	switch {
+	case wrap < 0:
+		return 0, usageError(trf("strip-wrap must be a number of days, not %d", wrap))
+	case wrap > 0 && opts.Layout != "strip":
+		return 0, usageError(tr("-strip-wrap needs -layout strip"))
+	}
+	return wrap, nil
+}
+
+// stripLayout draws the year of hm as a barcode: a column a day, a fifth of
+// a cell wide and a cell tall, side by side with no gaps and nothing else,
+// for a banner. With opts.StripWrap the days wrap into rows of that many,
+// a theme gap apart.
+func stripLayout(hm heatmap, opts renderOptions) layout {
+	cell := opts.cellSize()
+	width := max(cell/5, 1)
+	dates := placedDays(hm.start, places(hm.start, addDate(hm.start, 1, 0, 0), opts.LeapDay), opts.LeapDay)
+	days := len(dates)
+	perRow := days
+	if opts.StripWrap > 0 {
+		perRow = min(opts.StripWrap, days)
+	}
+	rows := (days + perRow - 1) / perRow
+	l := layout{width: perRow * width, height: rows*(cell+opts.Theme.Gap) - opts.Theme.Gap}
+	for i, date := range dates {
+		x, y := i%perRow*width, i/perRow*(cell+opts.Theme.Gap)
+		l.cells = append(l.cells, dayCell(hm, date, image.Rect(x, y, x+width, y+cell)))
+	}
+	l.colorCategories(hm, l.cells, opts)
+	return l
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// svgRenderer writes the heatmap as an SVG document. Text takes the theme's
+// text color from the group around the drawing unless given another.
+type svgRenderer struct {
+	buf      bytes.Buffer
+	textFill color.RGBA
+	link     string // the -cell-link template
+	desc     string
+}
+
+func (s *svgRenderer) begin(width, height int, t theme) {
+	s.textFill = t.Text
+	fmt.Fprintf(&s.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", width, height, width, height)
+	if s.desc != "" {
+		s.buf.WriteString("<desc>")
+		xml.EscapeText(&s.buf, []byte(s.desc))
+		s.buf.WriteString("</desc>\n")
+	}
+	fmt.Fprintf(&s.buf, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hexColor(t.Background))
+	fmt.Fprintf(&s.buf, `<g font-family="%s" font-size="%g" fill="%s">`+"\n", t.fontFamily(), t.fontSize(), hexColor(t.Text))
+}
+
+func (s *svgRenderer) describe(desc string) {
+	s.desc = desc
+}
+
+func (s *svgRenderer) text(x, y int, str string, c color.RGBA) {
+	if c == s.textFill {
+		fmt.Fprintf(&s.buf, `<text x="%d" y="%d">`, x, y)
+	} else {
+		fmt.Fprintf(&s.buf, `<text x="%d" y="%d" fill="%s">`, x, y, hexColor(c))
+	}
+	xml.EscapeText(&s.buf, []byte(str))
+	s.buf.WriteString("</text>\n")
+}
+
+func (s *svgRenderer) rect(r image.Rectangle, c color.RGBA) {
+	fmt.Fprintf(&s.buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), hexColor(c))
+}
+
+// cells writes a rect per cell with its name and count as its tooltip.
+func (s *svgRenderer) cells(cells []layoutCell) {
+	for _, c := range cells {
+		linked := s.openLink(c)
+		fmt.Fprintf(&s.buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>`,
+			c.rect.Min.X, c.rect.Min.Y, c.rect.Dx(), c.rect.Dy(), hexColor(c.color))
+		xml.EscapeText(&s.buf, []byte(c.name()))
+		fmt.Fprintf(&s.buf, ": %d</title></rect>", c.count)
+		s.closeLink(linked)
+	}
+}
+
+// openLink starts a link around the cell c to where the -cell-link
+// template points for it, and reports whether there is one.
+func (s *svgRenderer) openLink(c layoutCell) bool {
+	href := cellLink(s.link, c)
+	if href == "" {
+		return false
+	}
+	s.buf.WriteString(`<a href="`)
+	xml.EscapeText(&s.buf, []byte(href))
+	s.buf.WriteString(`">`)
+	return true
+}
+
+// closeLink ends the link openLink started, if it did, and the line.
+func (s *svgRenderer) closeLink(linked bool) {
+	if linked {
+		s.buf.WriteString("</a>")
+	}
+	s.buf.WriteString("\n")
+}
+
+// sectors writes a path per sector, its arcs as SVG arcs, with the name
+// and count of its day as its tooltip.
+func (s *svgRenderer) sectors(sectors []layoutSector) {
+	for _, sec := range sectors {
+		large := 0
+		if sec.to-sec.from > math.Pi {
+			large = 1
+		}
+		x0, y0 := sec.point(sec.outer, sec.from)
+		x1, y1 := sec.point(sec.outer, sec.to)
+		x2, y2 := sec.point(sec.inner, sec.to)
+		x3, y3 := sec.point(sec.inner, sec.from)
+		linked := s.openLink(sec.layoutCell)
+		fmt.Fprintf(&s.buf, `<path d="M%.2f %.2f A%.2f %.2f 0 %d 1 %.2f %.2f L%.2f %.2f A%.2f %.2f 0 %d 0 %.2f %.2f Z" fill="%s">`,
+			x0, y0, sec.outer, sec.outer, large, x1, y1, x2, y2, sec.inner, sec.inner, large, x3, y3, hexColor(sec.color))
+		if title := sectorTitle(sec); title != "" {
+			s.buf.WriteString("<title>")
+			xml.EscapeText(&s.buf, []byte(title))
+			s.buf.WriteString("</title>")
+		}
+		s.buf.WriteString("</path>")
+		s.closeLink(linked)
+	}
+}
+
+func (s *svgRenderer) line(line layoutLine) {
+	s.buf.WriteString(`<polyline points="`)
+	for i, p := range line.points {
+		if i > 0 {
+			s.buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&s.buf, "%d,%d", p.X, p.Y)
+	}
+	fmt.Fprintf(&s.buf, `" fill="none" stroke="%s" stroke-width="%d" stroke-linejoin="round"/>`+"\n", hexColor(line.color), line.width)
+}
+
+func (s *svgRenderer) outline(r image.Rectangle, width int, c color.RGBA) {
+	// SVG strokes straddle the edge, so the path runs half a width inside.
+	inset := float64(width) / 2
+	fmt.Fprintf(&s.buf, `<rect x="%g" y="%g" width="%g" height="%g" fill="none" stroke="%s" stroke-width="%d"/>`+"\n",
+		float64(r.Min.X)+inset, float64(r.Min.Y)+inset, float64(r.Dx()-width), float64(r.Dy()-width), hexColor(c), width)
+}
+
+func (s *svgRenderer) finish() ([]byte, error) {
+	s.buf.WriteString("</g>\n</svg>\n")
+	return s.buf.Bytes(), nil
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
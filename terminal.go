@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+)
+
+// terminalFormats are the output formats that wrap the PNG rendering in
+// the escape sequences of a terminal's inline images: DEC Sixel, which
+// xterm, foot, WezTerm, mlterm and others draw, and the inline images of
+// iTerm2, which WezTerm and VS Code's terminal also understand.
+var terminalFormats = map[string]func(pngData []byte) ([]byte, error){
+	"sixel": sixelImage,
+	"iterm": itermImage,
+}
+
+// itermImage wraps a PNG in iTerm2's inline image escape sequence.
+func itermImage(pngData []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\x1b]1337;File=inline=1;size=%d;preserveAspectRatio=1:", len(pngData))
+	buf.WriteString(base64.StdEncoding.EncodeToString(pngData))
+	buf.WriteString("\a\n")
+	return buf.Bytes(), nil
+}
+
+// sixelImage converts a PNG to Sixel: the colors of the image, at most 256
+// as toPaletted picks them, then the pixels in bands six rows high, each
+// band a run of sixels for each color it has.
+func sixelImage(pngData []byte) ([]byte, error) {
+	decoded, err := png.Decode(bytes.NewReader(pngData))
+	if err != nil {
+		return nil, err
+	}
+	b := decoded.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), decoded, b.Min, draw.Src)
+	img := toPaletted(rgba)
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+
+	var buf bytes.Buffer
+	// Pixel aspect ratio 1:1, and the background left as drawn.
+	fmt.Fprintf(&buf, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+	for i, c := range img.Palette {
+		r, g, bl, _ := c.RGBA()
+		// Sixel gives the channels in percent.
+		fmt.Fprintf(&buf, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, bl*100/0xffff)
+	}
+	sixels := make([]byte, width)
+	for top := 0; top < height; top += 6 {
+		used := make(map[uint8]bool)
+		for y := top; y < min(top+6, height); y++ {
+			for x := 0; x < width; x++ {
+				used[img.ColorIndexAt(x, y)] = true
+			}
+		}
+		first := true
+		for index := range img.Palette {
+			if !used[uint8(index)] {
+				continue
+			}
+			for x := 0; x < width; x++ {
+				bits := byte(0)
+				for dy := 0; dy < 6 && top+dy < height; dy++ {
+					if img.ColorIndexAt(x, top+dy) == uint8(index) {
+						bits |= 1 << dy
+					}
+				}
+				sixels[x] = '?' + bits
+			}
+			if !first {
+				buf.WriteByte('$') // back to the start of the band
+			}
+			first = false
+			fmt.Fprintf(&buf, "#%d", index)
+			writeSixelRuns(&buf, sixels)
+		}
+		buf.WriteByte('-') // on to the next band
+	}
+	buf.WriteString("\x1b\\\n")
+	return buf.Bytes(), nil
+}
+
+// writeSixelRuns writes sixels with runs of more than three of the same
+// compressed to a repeat.
+func writeSixelRuns(buf *bytes.Buffer, sixels []byte) {
+	for i := 0; i < len(sixels); {
+		j := i
+		for j < len(sixels) && sixels[j] == sixels[i] {
+			j++
+		}
+		if n := j - i; n > 3 {
+			fmt.Fprintf(buf, "!%d%c", n, sixels[i])
+		} else {
+			buf.Write(sixels[i:j])
+		}
+		i = j
+	}
+}
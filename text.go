@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+)
+
+// textStyles are the glyphs the txt format draws days with, from the least
+// activity to the most: shade blocks, one column wide, or colored emoji
+// squares, which chat apps and Markdown show at the size of a character
+// pair.
+var textStyles = map[string][]string{
+	"blocks": {"·", "░", "▒", "▓", "█"},
+	"emoji":  {"⬜", "🟩", "🟨", "🟧", "🟥"},
+}
+
+// textUnscaled is the glyph of a day its scale has no color for, such as a
+// forecast or a category, in each style.
+var textUnscaled = map[string]string{"blocks": " ", "emoji": "⬛"}
+
+const defaultTextStyle = "blocks"
+
+// checkTextStyle validates -text-style.
+func checkTextStyle(style string) (string, error) {
+	if _, ok := textStyles[style]; !ok {
+		return "", usageError(trf("unknown text style %q (available: blocks, emoji)", style))
+	}
+	return style, nil
+}
+
+// renderText writes the year of tweets as text: the title, a row of glyphs
+// for each weekday, a column a week as in the image, with the month names
+// above them in the blocks style, and a legend of the glyphs with the
+// counts of the scale's colors. Days get the glyph of their color's place
+// in the scale, so the thresholds are those of the image.
+func renderText(tweets []DailyTweet, opts renderOptions) ([]byte, error) {
+	switch {
+	case opts.Layout != "":
+		return nil, usageError(tr("text output draws the year of weeks; -layout does not apply"))
+	case opts.RTL:
+		return nil, usageError(tr("text output runs in the direction of the terminal or page it is shown in; -rtl does not apply"))
+	}
+	style := opts.TextStyle
+	if style == "" {
+		style = defaultTextStyle
+	}
+	hm := newHeatmap(tweets, opts)
+	entries := hm.scale.legendEntries()
+	glyphs := make(map[color.RGBA]string, len(entries))
+	for i, entry := range entries {
+		if _, ok := glyphs[entry.color]; !ok {
+			glyphs[entry.color] = textGlyph(style, i, len(entries))
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(opts.Title + "\n")
+	const margin = "    " // the room of the weekday names
+	if style == "blocks" {
+		months := []byte(strings.Repeat(" ", numWeeks))
+		current := hm.start.Month()
+		for week := 0; week < numWeeks; week++ {
+			month := addDate(hm.start, 0, 0, week*7).Month()
+			if month != current && week+3 <= numWeeks {
+				copy(months[week:], monthNames[month-1])
+			}
+			current = month
+		}
+		buf.WriteString(strings.TrimRight(margin+string(months), " ") + "\n")
+	}
+	cells := gridCells(hm, 0, 0, 1, 0)
+	for day := 0; day < daysInWeek; day++ {
+		buf.WriteString(addDate(hm.start, 0, 0, day).Weekday().String()[:3] + " ")
+		for week := 0; week < numWeeks; week++ {
+			glyph, ok := glyphs[cells[week*daysInWeek+day].color]
+			if !ok {
+				glyph = textUnscaled[style]
+			}
+			buf.WriteString(glyph)
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n")
+	for i, entry := range entries {
+		if i > 0 {
+			buf.WriteString("  ")
+		}
+		buf.WriteString(textGlyph(style, i, len(entries)) + " " + entry.label)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// textGlyph returns the glyph of the i-th of n colors of a scale, spreading
+// them over the glyphs of the style when their numbers differ.
+func textGlyph(style string, i, n int) string {
+	glyphs := textStyles[style]
+	if n <= 1 {
+		return glyphs[0]
+	}
+	return glyphs[(i*(len(glyphs)-1)+(n-1)/2)/(n-1)]
+}
@@ -0,0 +1,740 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+// theme is how a heatmap looks: its colors, the face of its text and the
+// space between its cells. Colors holds one color per level, from no
+// activity to the most.
+type theme struct {
+	Name       string
+	Background color.RGBA
+	Text       color.RGBA
+	Colors     []color.RGBA
+	Font       string  // one of themeFonts
+	FontSize   float64 // in points; the basic font has only 13
+	Gap        int     // pixels between cells
+	// Border is the width of a border in BorderColor around every cell,
+	// zero for none.
+	Border      int
+	BorderColor color.RGBA
+}
+
+const defaultTheme = "github"
+
+// Themes are TOML files named after the theme. The built-in themes are
+// embedded; a file of the user theme directory adds a theme or replaces
+// the built-in one of its name. Theme files name no other files, so they
+// can be passed around as they are.
+//
+//go:embed themes/*.toml
+var builtinThemeFiles embed.FS
+
+// themeNamePattern keeps theme names, which come from queries too, from
+// naming paths.
+var themeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// themeFile is the contents of a theme file.
+type themeFile struct {
+	Background  string   `toml:"background"`
+	Text        string   `toml:"text"`
+	Colors      []string `toml:"colors"`
+	Font        string   `toml:"font"`
+	FontSize    float64  `toml:"font_size"`
+	Gap         *int     `toml:"gap"`
+	Border      int      `toml:"border"`
+	BorderColor string   `toml:"border_color"`
+}
+
+// Limits on what theme files may ask for, so text fits the space the
+// layout leaves it and the grid stays a grid.
+const (
+	minFontSize = 8
+	maxFontSize = 16
+	maxGap      = 8
+	maxBorder   = 3
+)
+
+// themeFonts are the faces theme text can be set in, with the font family
+// SVG output names for each.
+var themeFonts = map[string]struct {
+	ttf    []byte // nil for the bitmap face
+	family string
+}{
+	"basic":  {nil, "monospace"},
+	"go":     {goregular.TTF, "Go, sans-serif"},
+	"gomono": {gomono.TTF, "Go Mono, monospace"},
+}
+
+// userThemeDir returns the directory of user themes,
+// $XDG_CONFIG_HOME/heatmap/themes or else ~/.config/heatmap/themes, or ""
+// when there is no home directory.
+func userThemeDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "heatmap", "themes")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "heatmap", "themes")
+}
+
+// themeNames returns the names of the built-in and user themes in sorted
+// order.
+func themeNames() []string {
+	seen := make(map[string]bool)
+	builtin, _ := fs.Glob(builtinThemeFiles, "themes/*.toml")
+	var user []string
+	if dir := userThemeDir(); dir != "" {
+		user, _ = filepath.Glob(filepath.Join(dir, "*.toml"))
+	}
+	var names []string
+	for _, file := range append(builtin, user...) {
+		name := strings.TrimSuffix(filepath.Base(file), ".toml")
+		if themeNamePattern.MatchString(name) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readThemeFile returns the theme file of the given name, from the user
+// theme directory or else the built-in themes, and where it was found.
+func readThemeFile(name string) ([]byte, string, error) {
+	if !themeNamePattern.MatchString(name) {
+		return nil, "", os.ErrNotExist
+	}
+	if dir := userThemeDir(); dir != "" {
+		path := filepath.Join(dir, name+".toml")
+		data, err := os.ReadFile(path)
+		if err == nil || !errors.Is(err, os.ErrNotExist) {
+			return data, path, err
+		}
+	}
+	data, err := builtinThemeFiles.ReadFile("themes/" + name + ".toml")
+	return data, "built-in theme " + name, err
+}
+
+func lookupTheme(name string) (theme, error) {
+	data, source, err := readThemeFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return theme{}, usageError(trf("unknown theme %q (available: %s)", name, strings.Join(themeNames(), ", ")))
+	}
+	if err != nil {
+		return theme{}, inputError(err)
+	}
+	t, err := parseTheme(name, data)
+	if err != nil {
+		return theme{}, malformedf("%s: %v", source, err)
+	}
+	return t, nil
+}
+
+// parseTheme reads a theme file. Every key is optional but colors; unknown
+// keys are errors, so a misspelled one is not silently ignored.
+func parseTheme(name string, data []byte) (theme, error) {
+	var f themeFile
+	md, err := toml.Decode(string(data), &f)
+	if err != nil {
+		return theme{}, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return theme{}, errorf("unknown key %q", undecoded[0].String())
+	}
+
+	t := theme{Name: name, Font: "basic", Gap: cellGap}
+	if t.Background, err = parseHexColor(f.Background, "#ffffff"); err != nil {
+		return theme{}, errorf("background: %v", err)
+	}
+	if t.Text, err = parseHexColor(f.Text, "#000000"); err != nil {
+		return theme{}, errorf("text: %v", err)
+	}
+	if len(f.Colors) != len(baseColors) {
+		return theme{}, errorf("colors: need %d colors, from no activity to the most", len(baseColors))
+	}
+	for _, s := range f.Colors {
+		c, err := parseHexColor(s, "")
+		if err != nil {
+			return theme{}, errorf("colors: %v", err)
+		}
+		t.Colors = append(t.Colors, c)
+	}
+
+	if f.Font != "" {
+		if _, ok := fonts()[f.Font]; !ok {
+			return theme{}, errorf("font: unknown font %q (available: %s)", f.Font, strings.Join(themeFontNames(), ", "))
+		}
+		t.Font = f.Font
+	}
+	if t.Font != "basic" {
+		t.FontSize = 13
+		if f.FontSize != 0 {
+			t.FontSize = f.FontSize
+		}
+		if !(t.FontSize >= minFontSize && t.FontSize <= maxFontSize) {
+			return theme{}, errorf("font_size: must be between %d and %d", minFontSize, maxFontSize)
+		}
+	} else if f.FontSize != 0 && f.FontSize != 13 {
+		return theme{}, errorf("font_size: the basic font comes in 13 only")
+	}
+	if f.Gap != nil {
+		if *f.Gap < 0 || *f.Gap > maxGap {
+			return theme{}, errorf("gap: must be between 0 and %d", maxGap)
+		}
+		t.Gap = *f.Gap
+	}
+	if f.Border < 0 || f.Border > maxBorder {
+		return theme{}, errorf("border: must be between 0 and %d", maxBorder)
+	}
+	t.Border = f.Border
+	if t.BorderColor, err = parseHexColor(f.BorderColor, hexColor(t.Text)); err != nil {
+		return theme{}, errorf("border_color: %v", err)
+	}
+	return t, nil
+}
+
+// parseHexColor reads a color written as #rrggbb, returning that of def
+// when s is empty.
+func parseHexColor(s, def string) (color.RGBA, error) {
+	if s == "" {
+		s = def
+	}
+	var c color.RGBA
+	if len(s) != 7 || s[0] != '#' {
+		return c, errorf("%q is not a color like #40c463", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return c, errorf("%q is not a color like #40c463", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// userFontDir returns the directory of user fonts, fonts beside the user
+// theme directory, or "" when there is none.
+func userFontDir() string {
+	dir := userThemeDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(dir), "fonts")
+}
+
+// loadedFont is a font themes can name: one of themeFonts, or a TrueType or
+// OpenType file of the user font directory, which themes name by its file
+// name without the extension, in lower case. Fonts of the user directory
+// add to the built-in ones or replace the one of their name, as user
+// themes do, and give text the glyphs the built-in fonts lack, as those of
+// Japanese.
+type loadedFont struct {
+	font   *opentype.Font // nil for the bitmap face
+	family string
+}
+
+var (
+	themeFontsOnce sync.Once
+	loadedFonts    map[string]loadedFont
+)
+
+func fonts() map[string]loadedFont {
+	themeFontsOnce.Do(func() {
+		loadedFonts = make(map[string]loadedFont)
+		for name, f := range themeFonts {
+			if f.ttf == nil {
+				loadedFonts[name] = loadedFont{family: f.family}
+			} else if parsed, err := opentype.Parse(f.ttf); err == nil {
+				loadedFonts[name] = loadedFont{parsed, f.family}
+			}
+		}
+		dir := userFontDir()
+		if dir == "" {
+			return
+		}
+		files, _ := filepath.Glob(filepath.Join(dir, "*"))
+		for _, file := range files {
+			ext := filepath.Ext(file)
+			name := strings.ToLower(strings.TrimSuffix(filepath.Base(file), ext))
+			if ext = strings.ToLower(ext); (ext != ".ttf" && ext != ".otf") || !themeNamePattern.MatchString(name) {
+				continue
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			parsed, err := opentype.Parse(data)
+			if err != nil {
+				slog.Warn("skipping font", "file", file, "err", err)
+				continue
+			}
+			family, err := parsed.Name(nil, sfnt.NameIDFamily)
+			if err != nil || family == "" {
+				family = name
+			}
+			// The family goes into an SVG attribute, quoted.
+			family = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(`'"<>&\`, r) {
+					return -1
+				}
+				return r
+			}, family)
+			loadedFonts[name] = loadedFont{parsed, "'" + family + "', sans-serif"}
+		}
+	})
+	return loadedFonts
+}
+
+func themeFontNames() []string {
+	names := make([]string, 0, len(fonts()))
+	for name := range fonts() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newFace returns a face for the text of t. Faces of outline fonts keep
+// state while drawing, so every render takes its own.
+func (t theme) newFace() font.Face {
+	f := fonts()[t.Font]
+	if f.font == nil {
+		return basicfont.Face7x13
+	}
+	face, err := opentype.NewFace(f.font, &opentype.FaceOptions{Size: t.FontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return basicfont.Face7x13
+	}
+	return face
+}
+
+// canDraw reports whether the font of t has a glyph for every rune of s.
+func (t theme) canDraw(s string) bool {
+	f := fonts()[t.Font]
+	var buf sfnt.Buffer
+	for _, r := range s {
+		if f.font == nil {
+			if _, ok := basicfont.Face7x13.GlyphAdvance(r); !ok {
+				return false
+			}
+		} else if i, err := f.font.GlyphIndex(&buf, r); err != nil || i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// label returns the translation of a label drawn on images of t, or the
+// English when the font of t cannot draw the translation, as the built-in
+// fonts cannot draw Japanese.
+func (t theme) label(message string) string {
+	if translated := tr(message); t.canDraw(translated) {
+		return translated
+	}
+	return message
+}
+
+// labelf formats a label drawn on images of t as trf does, in English when
+// the font of t cannot draw the translation of format.
+func (t theme) labelf(format string, args ...interface{}) string {
+	if translated := tr(format); translated != format && t.canDraw(translated) {
+		return fmt.Sprintf(translated, args...)
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// labeln formats the label of one when n is 1 and of other otherwise, as
+// labelf does.
+func (t theme) labeln(one, other string, n int, args ...interface{}) string {
+	return t.labelf(plural(n, one, other), args...)
+}
+
+// fontFamily and fontSize describe the text of t to SVG readers.
+func (t theme) fontFamily() string {
+	if f, ok := fonts()[t.Font]; ok {
+		return f.family
+	}
+	return "monospace"
+}
+
+func (t theme) fontSize() float64 {
+	if t.FontSize == 0 {
+		return 13
+	}
+	return t.FontSize
+}
+
+// renderOptions controls how a heatmap is drawn.
+type renderOptions struct {
+	Title    string
+	Theme    theme
+	CellSize int       // zero means cellSize
+	From     time.Time // first day of the grid, if set
+	To       time.Time // last day of the grid, if set and From is not
+	Card     bool      // draw a 1200×630 social card instead of the plain grid
+	Streaks  bool      // add the longest and current streak below the grid
+	Panel    string    // where the summary panel goes: "", "right" or "below"
+	Smooth   int       // color by the moving average of this many days, if above 1
+	// Normalize rescales each series before coloring: "", "percent",
+	// "minmax" or "zscore".
+	Normalize string
+	Profile   bool // chart the average of each weekday beside its row
+	Forecast  bool // fill the rest of the year of the last day with a faded forecast
+	// Categories is how days broken down by category are drawn: "",
+	// "split" or "dominant".
+	Categories string
+	// Anomalies outlines the days more than this many median absolute
+	// deviations from the days before them; zero outlines none.
+	Anomalies float64
+	// Layout is how the days are arranged: "" for the year of weeks, or a
+	// name of layoutKinds.
+	Layout string
+	// CalendarColumns is how many month blocks the calendar layout puts in
+	// a row, and DayNumbers whether it numbers the days.
+	CalendarColumns int
+	DayNumbers      bool
+	// StripWrap wraps the strip layout into rows of this many days; zero
+	// keeps it one row.
+	StripWrap int
+	// Sparkline charts the weekly totals under the year of weeks: "",
+	// "bars" or "line".
+	Sparkline string
+	// MonthTotals gives the total of each month under its columns of the
+	// year of weeks: "", "labels" or "cells".
+	MonthTotals string
+	// WeekNumbers numbers every that many columns of the year of weeks
+	// with their ISO week, 0 for none, at WeekNumbersAt: "top" or
+	// "bottom".
+	WeekNumbers   int
+	WeekNumbersAt string
+	// TextStyle is the glyphs of the txt format: "blocks" or "emoji".
+	TextStyle string
+	// CellLink is a template of the address SVG output links each cell
+	// to, "" for none; see cellLink.
+	CellLink string
+	// Patterns marks the levels of the scale with patterns as well as
+	// shades, for printing in black and white.
+	Patterns bool
+	// RTL mirrors the layout so time runs from right to left.
+	RTL bool
+	// LeapDay is where Feb 29 goes in years of fixed places: "skip",
+	// "merge", or "" for a place of its own; see leapDayPolicies.
+	LeapDay string
+
+	Scale      string // kind of color scale; empty means linear
+	Thresholds []int  // fixed bucket thresholds, overriding Scale
+	Goal       int    // color by attainment of this daily goal, overriding Scale
+	// ClipMax and ClipPercentile cap the counts the scale is computed from
+	// at a count or at a percentile of the counts; zero caps nothing.
+	ClipMax        int
+	ClipPercentile float64
+
+	Compression png.CompressionLevel // of PNG output
+	Paletted    bool                 // write PNG with 8-bit indexed color
+	ICCProfile  []byte               // embedded in PNG output; nil tags it sRGB
+
+	// Deterministic makes the output the same bytes for the same data and
+	// options whatever build renders it, for golden tests: PNG leaves out
+	// the name of the build and is compressed at the default level.
+	Deterministic bool
+}
+
+// Limits on the cell size, which sets the image size.
+const (
+	minCellSize = 4
+	maxCellSize = 64
+)
+
+func (o renderOptions) cellSize() int {
+	if o.CellSize == 0 {
+		return cellSize
+	}
+	return o.CellSize
+}
+
+// renderFlags holds the flags shared by every command that draws heatmaps.
+type renderFlags struct {
+	title string
+	theme string
+	cell  int
+	from  string
+	to    string
+	card  bool
+
+	streaks   bool
+	panel     string
+	smooth    int
+	normalize string
+	profile   bool
+	forecast  bool
+
+	categories string
+
+	anomalies float64
+	layout    string
+
+	calendarColumns int
+	dayNumbers      bool
+	stripWrap       int
+	sparkline       string
+	monthTotals     string
+	weekNumbers     int
+	weekNumbersAt   string
+	textStyle       string
+	cellLink        string
+	patterns        bool
+	rtl             bool
+	leapDay         string
+
+	scale      string
+	thresholds string
+	goal       int
+
+	clipMax        int
+	clipPercentile float64
+
+	compression   string
+	paletted      bool
+	iccProfile    string
+	deterministic bool
+}
+
+func addRenderFlags(fs *flag.FlagSet) *renderFlags {
+	f := &renderFlags{}
+	fs.StringVar(&f.title, "title", "", "heatmap title (defaults to one suited to the source)")
+	fs.StringVar(&f.theme, "theme", defaultTheme, trf("color theme: %s", strings.Join(themeNames(), ", ")))
+	fs.IntVar(&f.cell, "cell", cellSize, trf("cell size in pixels (%d-%d)", minCellSize, maxCellSize))
+	fs.StringVar(&f.from, "from", "", "first day of the grid as YYYY-MM-DD (default a year before the last day with data)")
+	fs.StringVar(&f.to, "to", "", "last day of the grid as YYYY-MM-DD (default the last day with data)")
+	fs.BoolVar(&f.card, "card", false, "draw a 1200x630 social card (OpenGraph) with headline stats; PNG only")
+	fs.BoolVar(&f.streaks, "streaks", false, "add a line with the longest and current streak of days with activity below the grid")
+	fs.StringVar(&f.panel, "panel", "none", trf("add a panel with the total, average, best day and streaks: %s", strings.Join(panelPlaces, ", ")))
+	fs.BoolVar(&f.profile, "weekday-chart", false, "chart the average count of each weekday beside its row of the grid")
+	fs.BoolVar(&f.forecast, "forecast", false, trf("fill the days of the grid left in the year of the last day with data, faded, with the average of its last %d days; pin the grid with -from to show them", forecastWindow))
+	fs.StringVar(&f.categories, "categories", "none", trf("draw days of input with a category column by category: %s; split bands each cell by share, dominant colors it by its largest category", strings.Join(categoryStyles, ", ")))
+	fs.IntVar(&f.smooth, "smooth", 0, trf("color each day by the average of it and the days before it, this many days in all (2-%d), to show trends in noisy data; the legend says so", maxSmooth))
+	fs.StringVar(&f.normalize, "normalize", "none", trf("rescale each series before coloring, so metrics of different units share a palette: %s (percent of the largest day, percent of the range, or standard deviations from the mean)", strings.Join(normalizations, ", ")))
+	fs.Float64Var(&f.anomalies, "anomalies", 0, trf("outline unusual days, whose count is more than this many median absolute deviations from the median of the %d days before, e.g. %d", anomalyWindow, defaultAnomalyK))
+	fs.StringVar(&f.layout, "layout", "year", trf("how the data is arranged: %s; months draws monthly totals with a row for each year, for data of many years", strings.Join(layoutNames(), ", ")))
+	fs.IntVar(&f.calendarColumns, "calendar-columns", calendarColumns, "month blocks in each row of -layout calendar, e.g. 3 or 4")
+	fs.BoolVar(&f.dayNumbers, "day-numbers", false, trf("number the days of -layout calendar; needs cells of %d pixels or more", minNumberCell))
+	fs.IntVar(&f.stripWrap, "strip-wrap", 0, "wrap -layout strip into rows of this many days, e.g. 92 for quarters (default one row)")
+	fs.IntVar(&f.weekNumbers, "week-numbers", 0, "number the columns with their ISO week, every this many weeks (1 for every week, 0 for none)")
+	fs.StringVar(&f.weekNumbersAt, "week-numbers-at", "bottom", trf("where to put the week numbers: %s", strings.Join(weekNumberSides, ", ")))
+	fs.BoolVar(&f.patterns, "patterns", false, "mark the levels between the least and the most with a dot, lines or a grid, so they stay apart printed in black and white; with -theme print for reports")
+	fs.BoolVar(&f.rtl, "rtl", false, "lay the heatmap out right to left, for Arabic, Hebrew and other right-to-left reports: time runs leftward and the labels and legend are mirrored")
+	fs.StringVar(&f.leapDay, "leap-day", "extra", trf("where Feb 29 goes in -layout radial, strip and spiral and the days compare -diff pairs: %s; skip drops it and merge adds it to Feb 28, so every year has the same places, and in grids of weeks both change the data alone", strings.Join(leapDayPolicies, ", ")))
+	fs.StringVar(&f.cellLink, "cell-link", "", "in SVG output, link each cell to this URL, with {{date}}, {{date+1}} (or any number of days either way), {{count}} and {{label}} filled in, e.g. 'https://twitter.com/search?q=from:me since:{{date}} until:{{date+1}}'")
+	fs.StringVar(&f.textStyle, "text-style", defaultTextStyle, "glyphs of the txt format: blocks (shades) or emoji (colored squares)")
+	fs.StringVar(&f.monthTotals, "month-totals", "none", trf("give the total of each month under its columns, as a number or a cell: %s", strings.Join(monthTotalStyles, ", ")))
+	fs.StringVar(&f.sparkline, "sparkline", "none", trf("chart the total of each week right under its column, to show the magnitudes the colors hide: %s", strings.Join(sparklineStyles, ", ")))
+	fs.StringVar(&f.scale, "scale", defaultScale, trf("how counts map to colors: %s; log and quantile suit data with rare spikes", strings.Join(scaleNames(), ", ")))
+	fs.StringVar(&f.thresholds, "thresholds", "", "fixed comma-separated highest counts of each color but the last, e.g. 0,5,10,20 (overrides -scale)")
+	fs.IntVar(&f.goal, "goal", 0, "color days by a daily goal: missed, partial, met or exceeded (overrides -scale)")
+	fs.IntVar(&f.clipMax, "clip-max", 0, "cap counts at this before computing the scale, so one extreme day does not pale the rest; days above it take the strongest color")
+	fs.Float64Var(&f.clipPercentile, "clip-percentile", 0, "cap counts at this percentile of the days with data before computing the scale, e.g. 99")
+	fs.BoolVar(&f.paletted, "paletted", false, "write PNG with 8-bit indexed color, much smaller; anti-aliased text snaps to the nearest colors")
+	fs.StringVar(&f.iccProfile, "icc-profile", "", "embed this ICC profile file in PNG output, for colors picked in another RGB space (default: tag PNG output as sRGB)")
+	fs.StringVar(&f.compression, "png-compression", "default", trf("PNG compression, trading speed for size: %s", strings.Join(pngCompressionNames(), ", ")))
+	fs.BoolVar(&f.deterministic, "deterministic", false, "write the same bytes for the same data and options with any build, for golden tests; fixes -png-compression at default")
+	return f
+}
+
+// options returns the render options the flags ask for, using defaultTitle
+// when no title was given.
+func (f *renderFlags) options(defaultTitle string) (renderOptions, error) {
+	opts, err := parseRenderOptions(f.title, f.theme, f.cell, f.from, f.to, defaultTitle)
+	if err != nil {
+		return renderOptions{}, err
+	}
+	opts.Card = f.card
+	opts.Streaks = f.streaks
+	opts.Profile = f.profile
+	opts.Forecast = f.forecast
+	if opts.Panel, err = parsePanel(f.panel); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.Categories, err = parseCategoryStyle(f.categories); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.Smooth, err = checkSmooth(f.smooth); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.Anomalies, err = checkAnomalies(f.anomalies); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.Scale, opts.Thresholds, err = parseScale(f.scale, f.thresholds); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.Goal, err = checkGoal(f.goal, opts.Thresholds); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.Normalize, err = checkNormalize(f.normalize, opts); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.ClipMax, opts.ClipPercentile, err = checkClip(f.clipMax, f.clipPercentile, opts); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.Layout, err = parseLayout(f.layout, opts); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.CalendarColumns, opts.DayNumbers, err = checkCalendar(f.calendarColumns, f.dayNumbers, opts); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.StripWrap, err = checkStripWrap(f.stripWrap, opts); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.Sparkline, err = checkSparkline(f.sparkline, opts); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.MonthTotals, err = checkMonthTotals(f.monthTotals, opts); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.WeekNumbers, opts.WeekNumbersAt, err = checkWeekNumbers(f.weekNumbers, f.weekNumbersAt, opts); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.TextStyle, err = checkTextStyle(f.textStyle); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.CellLink, err = checkCellLink(f.cellLink); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.Patterns, err = checkPatterns(f.patterns, opts); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.RTL, err = checkRTL(f.rtl, opts); err != nil {
+		return renderOptions{}, err
+	}
+	if opts.LeapDay, err = checkLeapDay(f.leapDay); err != nil {
+		return renderOptions{}, err
+	}
+	return opts, f.setEncoding(&opts)
+}
+
+// clone returns a copy of the flags on a flag set of its own, for the
+// parameters of a request or of the JavaScript API to set as they would
+// the flags of their names.
+func (f *renderFlags) clone() (*renderFlags, *flag.FlagSet) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c := addRenderFlags(fs)
+	*c = *f
+	return c, fs
+}
+
+// setParam sets the flag name of fs to the value of the parameter param,
+// naming the parameter when the value is not of the flag's kind.
+func setParam(fs *flag.FlagSet, name, param, value string) error {
+	err := fs.Set(name, value)
+	if err == nil {
+		return nil
+	}
+	switch fs.Lookup(name).Value.(flag.Getter).Get().(type) {
+	case bool:
+		return usageError(trf("%s must be true or false", param))
+	case int:
+		return usageError(trf("%s must be an integer", param))
+	case float64:
+		return usageError(trf("%s must be a number", param))
+	}
+	return err
+}
+
+// panelPlaces are where -panel can put the summary panel: nowhere, right
+// of the legend, or below the grid.
+var panelPlaces = []string{"none", "right", "below"}
+
+// parsePanel validates -panel, returning "" for none.
+func parsePanel(place string) (string, error) {
+	switch place {
+	case "none":
+		return "", nil
+	case "right", "below":
+		return place, nil
+	}
+	return "", usageError(trf("unknown panel place %q (available: %s)", place, strings.Join(panelPlaces, ", ")))
+}
+
+// maxSmooth bounds -smooth at a year, all the grid shows.
+const maxSmooth = 365
+
+// checkSmooth validates -smooth; 0 and 1 leave the counts as they are.
+func checkSmooth(days int) (int, error) {
+	if days < 0 || days > maxSmooth {
+		return 0, usageError(trf("smooth must be between 0 and %d days", maxSmooth))
+	}
+	return days, nil
+}
+
+// setEncoding sets the options of how images are encoded, which requests
+// to the server cannot change.
+func (f *renderFlags) setEncoding(opts *renderOptions) error {
+	var err error
+	opts.Paletted = f.paletted
+	opts.Deterministic = f.deterministic
+	if opts.Compression, err = parsePNGCompression(f.compression); err != nil {
+		return err
+	}
+	if opts.Deterministic && opts.Compression != png.DefaultCompression {
+		return usageError(tr("-deterministic fixes -png-compression at default"))
+	}
+	opts.ICCProfile, err = readICCProfile(f.iccProfile)
+	return err
+}
+
+// parseRenderOptions validates render options given as text, from flags or
+// from query parameters.
+func parseRenderOptions(title, themeName string, cell int, from, to, defaultTitle string) (renderOptions, error) {
+	t, err := lookupTheme(themeName)
+	if err != nil {
+		return renderOptions{}, err
+	}
+	if cell < minCellSize || cell > maxCellSize {
+		return renderOptions{}, usageError(trf("cell size must be between %d and %d", minCellSize, maxCellSize))
+	}
+	if title == "" {
+		title = defaultTitle
+	}
+
+	opts := renderOptions{Title: title, Theme: t, CellSize: cell}
+	if from != "" {
+		if opts.From, err = time.Parse("2006-01-02", from); err != nil {
+			return renderOptions{}, usageError(trf("invalid from date %q", from))
+		}
+	}
+	if to != "" {
+		if opts.To, err = time.Parse("2006-01-02", to); err != nil {
+			return renderOptions{}, usageError(trf("invalid to date %q", to))
+		}
+	}
+	if from != "" && to != "" {
+		return renderOptions{}, usageError(tr("give at most one of from and to; the grid always spans a year"))
+	}
+	return opts, nil
+}
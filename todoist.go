@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// readTodoistCSV reads a CSV of completed tasks and returns the number of
+// completions per day. Only a completion date column is required; project
+// and label columns enable filtering.
+func readTodoistCSV(filename string, opts sourceOptions) ([]DailyTweet, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := headerColumns(header)
+
+	dateCol, ok := findColumn(columns, "completed at", "completed_at", "completed date", "date completed")
+	if !ok {
+		return nil, malformedf("%s: no completion date column", filename)
+	}
+	projectCol, hasProject := findColumn(columns, "project")
+	labelsCol, hasLabels := findColumn(columns, "labels", "label")
+
+	totals := make(map[civilDate]int)
+	for rows := 1; ; rows++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := opts.Limits.checkRows(rows); err != nil {
+			return nil, errorf("%s: %w", filename, err)
+		}
+
+		if opts.Project != "" && (!hasProject || !strings.EqualFold(field(record, projectCol), opts.Project)) {
+			continue
+		}
+		if opts.Tag != "" && (!hasLabels || !hasTag(strings.Split(field(record, labelsCol), ","), opts.Tag)) {
+			continue
+		}
+
+		completed, err := parseExportTime(field(record, dateCol))
+		if err != nil {
+			return nil, err
+		}
+		totals[civil(completed)]++
+	}
+
+	return dailyTotals(totals), nil
+}
+
+// parseExportTime parses a timestamp or bare date as found in exports,
+// converting timestamps with an offset to local time.
+func parseExportTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Local(), nil
+	}
+	if t, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
+		return t, nil
+	}
+	return parseExportDate(s)
+}
+
+type todoistCompletedTask struct {
+	ProjectID   string   `json:"project_id"`
+	Labels      []string `json:"labels"`
+	CompletedAt string   `json:"completed_at"`
+}
+
+// fetchTodoist retrieves the past year of completed tasks from the Todoist
+// API and returns the number of completions per day.
+func fetchTodoist(ctx context.Context, token string, opts sourceOptions) ([]DailyTweet, error) {
+	if token == "" {
+		return nil, errorf("todoist: set TODOIST_API_TOKEN or pass a CSV export")
+	}
+
+	projectID := ""
+	if opts.Project != "" {
+		var err error
+		projectID, err = todoistProjectID(ctx, token, opts.Project, opts.Limits)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	totals := make(map[civilDate]int)
+	records := 0
+	from, end := lastYear()
+	// Completed tasks can only be queried a few months at a time.
+	err := eachMonth(from, end, func(from, to time.Time) error {
+		query := url.Values{}
+		query.Set("since", from.Format(time.RFC3339))
+		query.Set("until", to.Format(time.RFC3339))
+		query.Set("limit", "200")
+		if projectID != "" {
+			query.Set("project_id", projectID)
+		}
+
+		for {
+			var page struct {
+				Items      []todoistCompletedTask `json:"items"`
+				NextCursor *string                `json:"next_cursor"`
+			}
+			req, err := newTodoistRequest(ctx, token, "tasks/completed/by_completion_date", query)
+			if err != nil {
+				return err
+			}
+			if err := opts.Limits.getJSON(req, &page); err != nil {
+				return err
+			}
+
+			records += len(page.Items)
+			if err := opts.Limits.checkRows(records); err != nil {
+				return errorf("todoist: %w", err)
+			}
+			for _, task := range page.Items {
+				if opts.Tag != "" && !hasTag(task.Labels, opts.Tag) {
+					continue
+				}
+				completed, err := time.Parse(time.RFC3339, task.CompletedAt)
+				if err != nil {
+					return err
+				}
+				totals[civil(completed.Local())]++
+			}
+
+			if page.NextCursor == nil || *page.NextCursor == "" {
+				return nil
+			}
+			query.Set("cursor", *page.NextCursor)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dailyTotals(totals), nil
+}
+
+func todoistProjectID(ctx context.Context, token, name string, limits inputLimits) (string, error) {
+	query := url.Values{}
+	for {
+		var page struct {
+			Results []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"results"`
+			NextCursor *string `json:"next_cursor"`
+		}
+		req, err := newTodoistRequest(ctx, token, "projects", query)
+		if err != nil {
+			return "", err
+		}
+		if err := limits.getJSON(req, &page); err != nil {
+			return "", err
+		}
+
+		for _, p := range page.Results {
+			if strings.EqualFold(p.Name, name) {
+				return p.ID, nil
+			}
+		}
+
+		if page.NextCursor == nil || *page.NextCursor == "" {
+			return "", errorf("todoist: no project named %q", name)
+		}
+		query.Set("cursor", *page.NextCursor)
+	}
+}
+
+func newTodoistRequest(ctx context.Context, token, path string, query url.Values) (*http.Request, error) {
+	u := "https://api.todoist.com/api/v1/" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readTimeTrackingCSV reads a detailed report exported from Toggl Track or
+// Clockify and returns the minutes logged per day. Columns are located by
+// header name since the two services order them differently.
+func readTimeTrackingCSV(filename string, opts sourceOptions) ([]DailyTweet, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := headerColumns(header)
+
+	dateCol, ok := findColumn(columns, "start date")
+	if !ok {
+		return nil, malformedf("%s: no start date column", filename)
+	}
+	durationCol, ok := findColumn(columns, "duration", "duration (h)")
+	if !ok {
+		return nil, malformedf("%s: no duration column", filename)
+	}
+	projectCol, hasProject := findColumn(columns, "project")
+	tagsCol, hasTags := findColumn(columns, "tags")
+
+	tracked := make(map[civilDate]time.Duration)
+	for rows := 1; ; rows++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := opts.Limits.checkRows(rows); err != nil {
+			return nil, errorf("%s: %w", filename, err)
+		}
+
+		if opts.Project != "" && (!hasProject || !strings.EqualFold(field(record, projectCol), opts.Project)) {
+			continue
+		}
+		if opts.Tag != "" && (!hasTags || !hasTag(strings.Split(field(record, tagsCol), ","), opts.Tag)) {
+			continue
+		}
+
+		date, err := parseExportDate(field(record, dateCol))
+		if err != nil {
+			return nil, err
+		}
+
+		duration, err := parseClockDuration(field(record, durationCol))
+		if err != nil {
+			return nil, err
+		}
+
+		tracked[civil(date)] += duration
+	}
+
+	return dailyMinutes(tracked), nil
+}
+
+// dailyMinutes returns the time tracked each day in whole minutes. Entries
+// are summed first, so a day of short entries is not cut short by a part
+// of a minute for each.
+func dailyMinutes(tracked map[civilDate]time.Duration) []DailyTweet {
+	totals := make(map[civilDate]int, len(tracked))
+	for date, d := range tracked {
+		totals[date] = int(d / time.Minute)
+	}
+	return dailyTotals(totals)
+}
+
+// headerColumns maps lower-cased CSV header names to their column index,
+// ignoring a leading byte order mark.
+func headerColumns(header []string) map[string]int {
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	return columns
+}
+
+func findColumn(columns map[string]int, names ...string) (int, bool) {
+	for _, name := range names {
+		if i, ok := columns[name]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func field(record []string, i int) string {
+	if i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(strings.TrimSpace(t), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseExportDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "01/02/2006", "02.01.2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, malformedf("unrecognized date: %q", s)
+}
+
+// parseClockDuration parses durations written as HH:MM:SS or HH:MM.
+func parseClockDuration(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, malformedf("unrecognized duration: %q", s)
+	}
+
+	var d time.Duration
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, malformedf("unrecognized duration: %q", s)
+		}
+		d += time.Duration(n) * units[i]
+	}
+	return d, nil
+}
+
+type togglTimeEntry struct {
+	ProjectID *int     `json:"project_id"`
+	Start     string   `json:"start"`
+	Duration  int      `json:"duration"`
+	Tags      []string `json:"tags"`
+}
+
+type togglProject struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// fetchToggl retrieves the past year of time entries from the Toggl Track
+// API and returns the minutes logged per day.
+func fetchToggl(ctx context.Context, token string, opts sourceOptions) ([]DailyTweet, error) {
+	if token == "" {
+		return nil, errorf("toggl: set TOGGL_API_TOKEN or pass an exported report")
+	}
+
+	projectID := -1
+	if opts.Project != "" {
+		var projects []togglProject
+		req, err := newTogglRequest(ctx, token, "me/projects", nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := opts.Limits.getJSON(req, &projects); err != nil {
+			return nil, err
+		}
+		for _, p := range projects {
+			if strings.EqualFold(p.Name, opts.Project) {
+				projectID = p.ID
+			}
+		}
+		if projectID < 0 {
+			return nil, errorf("toggl: no project named %q", opts.Project)
+		}
+	}
+
+	tracked := make(map[civilDate]time.Duration)
+	from, end := lastYear()
+	// The time entries endpoint rejects long ranges, so walk the year a
+	// month at a time.
+	err := eachMonth(from, end, func(from, to time.Time) error {
+		query := url.Values{}
+		query.Set("start_date", from.Format("2006-01-02"))
+		query.Set("end_date", to.Format("2006-01-02"))
+		req, err := newTogglRequest(ctx, token, "me/time_entries", query)
+		if err != nil {
+			return err
+		}
+
+		var entries []togglTimeEntry
+		if err := opts.Limits.getJSON(req, &entries); err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			// Running entries report a negative duration.
+			if e.Duration < 0 {
+				continue
+			}
+			if projectID >= 0 && (e.ProjectID == nil || *e.ProjectID != projectID) {
+				continue
+			}
+			if opts.Tag != "" && !hasTag(e.Tags, opts.Tag) {
+				continue
+			}
+			start, err := time.Parse(time.RFC3339, e.Start)
+			if err != nil {
+				return err
+			}
+			tracked[civil(start.Local())] += time.Duration(e.Duration) * time.Second
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dailyMinutes(tracked), nil
+}
+
+func newTogglRequest(ctx context.Context, token, path string, query url.Values) (*http.Request, error) {
+	u := "https://api.track.toggl.com/api/v9/" + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(token, "api_token")
+	return req, nil
+}
+
+type clockifyTimeEntry struct {
+	TimeInterval struct {
+		Start string  `json:"start"`
+		End   *string `json:"end"`
+	} `json:"timeInterval"`
+	Project *struct {
+		Name string `json:"name"`
+	} `json:"project"`
+	Tags []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+}
+
+// fetchClockify retrieves the past year of the current user's time entries
+// from the Clockify API and returns the minutes logged per day.
+func fetchClockify(ctx context.Context, apiKey string, opts sourceOptions) ([]DailyTweet, error) {
+	if apiKey == "" {
+		return nil, errorf("clockify: set CLOCKIFY_API_KEY or pass an exported report")
+	}
+
+	var user struct {
+		ID              string `json:"id"`
+		ActiveWorkspace string `json:"activeWorkspace"`
+	}
+	req, err := newClockifyRequest(ctx, apiKey, "user", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Limits.getJSON(req, &user); err != nil {
+		return nil, err
+	}
+
+	from, end := lastYear()
+	query := url.Values{}
+	query.Set("start", from.Format(time.RFC3339))
+	query.Set("end", end.Format(time.RFC3339))
+	query.Set("hydrated", "true")
+	query.Set("page-size", "1000")
+
+	tracked := make(map[civilDate]time.Duration)
+	path := fmt.Sprintf("workspaces/%s/user/%s/time-entries", user.ActiveWorkspace, user.ID)
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		req, err := newClockifyRequest(ctx, apiKey, path, query)
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []clockifyTimeEntry
+		if err := opts.Limits.getJSON(req, &entries); err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		for _, e := range entries {
+			if e.TimeInterval.End == nil {
+				continue
+			}
+			if opts.Project != "" && (e.Project == nil || !strings.EqualFold(e.Project.Name, opts.Project)) {
+				continue
+			}
+			if opts.Tag != "" {
+				var tags []string
+				for _, t := range e.Tags {
+					tags = append(tags, t.Name)
+				}
+				if !hasTag(tags, opts.Tag) {
+					continue
+				}
+			}
+			start, err := time.Parse(time.RFC3339, e.TimeInterval.Start)
+			if err != nil {
+				return nil, err
+			}
+			stop, err := time.Parse(time.RFC3339, *e.TimeInterval.End)
+			if err != nil {
+				return nil, err
+			}
+			tracked[civil(start.Local())] += stop.Sub(start)
+		}
+	}
+
+	return dailyMinutes(tracked), nil
+}
+
+func newClockifyRequest(ctx context.Context, apiKey, path string, query url.Values) (*http.Request, error) {
+	u := "https://api.clockify.me/api/v1/" + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Api-Key", apiKey)
+	return req, nil
+}
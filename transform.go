@@ -0,0 +1,395 @@
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"math"
+	"strings"
+	"time"
+)
+
+// transform rewrites the data between loading and rendering, as capping
+// counts, converting units or dropping days.
+type transform func(tweets []DailyTweet) ([]DailyTweet, error)
+
+// runTransforms applies ts in order.
+func runTransforms(tweets []DailyTweet, ts []transform) ([]DailyTweet, error) {
+	for _, t := range ts {
+		var err error
+		if tweets, err = t(tweets); err != nil {
+			return nil, err
+		}
+	}
+	return tweets, nil
+}
+
+// transformData runs the compiled expressions on data as loaded, returning
+// the daily totals to render and how many days the source gave more than
+// once.
+func transformData(tweets []DailyTweet, expressions []transform) ([]DailyTweet, int, error) {
+	tweets, duplicates := normalizeTweets(tweets)
+	tweets, err := runTransforms(tweets, expressions)
+	if err != nil {
+		return nil, 0, err
+	}
+	return tweets, duplicates, nil
+}
+
+// movingAverage returns the trailing average of the given number of days
+// for every day from the first with data to the last, rounded to whole
+// counts. Days without data count as zero; the first days average over
+// the days since the first.
+func movingAverage(tweets []DailyTweet, days int) []DailyTweet {
+	if len(tweets) == 0 {
+		return nil
+	}
+	var window []int
+	var sum int
+	var out []DailyTweet
+	i := 0
+	last := tweets[len(tweets)-1].Date
+	for d := tweets[0].Date; !d.After(last); d = addDate(d, 0, 0, 1) {
+		n := 0
+		if i < len(tweets) && tweets[i].Date.Equal(d) {
+			n = tweets[i].Count
+			i++
+		}
+		window = append(window, n)
+		sum += n
+		if len(window) > days {
+			sum -= window[0]
+			window = window[1:]
+		}
+		out = append(out, DailyTweet{Date: d, Count: int(math.Round(float64(sum) / float64(len(window))))})
+	}
+	return out
+}
+
+// normalizations are how -normalize rescales a series before coloring, so
+// series of different units share a palette: none; percent of the largest
+// value; percent of the way from the smallest to the largest; or the
+// z-score, standard deviations from the mean, in hundredths.
+var normalizations = []string{"none", "percent", "minmax", "zscore"}
+
+// normalize rescales every day from the first with data to the last by
+// method, counting days without data as zero.
+func normalize(tweets []DailyTweet, method string) []DailyTweet {
+	if len(tweets) == 0 {
+		return nil
+	}
+	var days []DailyTweet
+	i := 0
+	last := tweets[len(tweets)-1].Date
+	for d := tweets[0].Date; !d.After(last); d = addDate(d, 0, 0, 1) {
+		n := 0
+		if i < len(tweets) && tweets[i].Date.Equal(d) {
+			n = tweets[i].Count
+			i++
+		}
+		days = append(days, DailyTweet{Date: d, Count: n})
+	}
+
+	least, most, sum := days[0].Count, days[0].Count, 0.0
+	for _, day := range days {
+		least, most = min(least, day.Count), max(most, day.Count)
+		sum += float64(day.Count)
+	}
+	mean := sum / float64(len(days))
+	var variance float64
+	for _, day := range days {
+		variance += (float64(day.Count) - mean) * (float64(day.Count) - mean)
+	}
+	sd := math.Sqrt(variance / float64(len(days)))
+
+	for i, day := range days {
+		var v float64
+		switch method {
+		case "percent":
+			if most > 0 {
+				v = 100 * float64(day.Count) / float64(most)
+			}
+		case "minmax":
+			if most > least {
+				v = 100 * float64(day.Count-least) / float64(most-least)
+			}
+		case "zscore":
+			if sd > 0 {
+				v = 100 * (float64(day.Count) - mean) / sd
+			}
+		}
+		days[i].Count = int(math.Round(v))
+	}
+	return days
+}
+
+// checkNormalize validates -normalize against the other options, returning
+// "" for none. A goal and a forecast are counts, which normalized values
+// are not.
+func checkNormalize(method string, opts renderOptions) (string, error) {
+	switch method {
+	case "none":
+		return "", nil
+	case "percent", "minmax", "zscore":
+		if opts.Goal > 0 || opts.Forecast {
+			return "", usageError(tr("-normalize cannot be combined with -goal or -forecast"))
+		}
+		return method, nil
+	}
+	return "", usageError(trf("unknown normalization %q (available: %s)", method, strings.Join(normalizations, ", ")))
+}
+
+// compileTransforms compiles -transform expressions. Each is evaluated for
+// every day with data: a number replaces the count of the day, rounded to
+// the nearest whole count; true or false keeps or drops the day.
+func compileTransforms(sources []string) ([]transform, error) {
+	ts := make([]transform, 0, len(sources))
+	for _, src := range sources {
+		t, err := compileTransform(src)
+		if err != nil {
+			return nil, usageError(trf("-transform %q: %v", src, err))
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+func compileTransform(src string) (transform, error) {
+	node, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	c := exprCompiler{src: src}
+	e, err := c.compile(node)
+	if err != nil {
+		return nil, err
+	}
+	if e.isBool() {
+		return func(tweets []DailyTweet) ([]DailyTweet, error) {
+			var kept []DailyTweet
+			for _, tweet := range tweets {
+				if e.boolean(newDayEnv(tweet)) {
+					kept = append(kept, tweet)
+				}
+			}
+			return kept, nil
+		}, nil
+	}
+	return func(tweets []DailyTweet) ([]DailyTweet, error) {
+		out := make([]DailyTweet, len(tweets))
+		for i, tweet := range tweets {
+			v := math.Round(e.number(newDayEnv(tweet)))
+			if math.IsNaN(v) || v < 0 || v > math.MaxInt32 {
+				return nil, malformedf("-transform %q: %s: %v is not a count", src, tweet.Date.Format("2006-01-02"), v)
+			}
+			out[i] = DailyTweet{Date: tweet.Date, Count: int(v)}
+		}
+		return out, nil
+	}, nil
+}
+
+// dayEnv is what an expression knows of the day it is evaluated for.
+type dayEnv struct {
+	count float64
+	date  time.Time
+}
+
+func newDayEnv(tweet DailyTweet) dayEnv {
+	return dayEnv{count: float64(tweet.Count), date: tweet.Date}
+}
+
+// expr is a compiled expression, either a number or a boolean.
+type expr struct {
+	number  func(dayEnv) float64
+	boolean func(dayEnv) bool
+}
+
+func (e expr) isBool() bool { return e.boolean != nil }
+
+func numberExpr(f func(dayEnv) float64) expr { return expr{number: f} }
+func boolExpr(f func(dayEnv) bool) expr      { return expr{boolean: f} }
+
+// exprVariables are the names expressions may use. Weekdays count from
+// sunday, 0, to saturday, 6, and have names.
+var exprVariables = map[string]expr{
+	"count":   numberExpr(func(d dayEnv) float64 { return d.count }),
+	"weekday": numberExpr(func(d dayEnv) float64 { return float64(d.date.Weekday()) }),
+	"day":     numberExpr(func(d dayEnv) float64 { return float64(d.date.Day()) }),
+	"month":   numberExpr(func(d dayEnv) float64 { return float64(d.date.Month()) }),
+	"year":    numberExpr(func(d dayEnv) float64 { return float64(d.date.Year()) }),
+	"weekend": boolExpr(func(d dayEnv) bool { return d.date.Weekday() == time.Saturday || d.date.Weekday() == time.Sunday }),
+	"true":    boolExpr(func(dayEnv) bool { return true }),
+	"false":   boolExpr(func(dayEnv) bool { return false }),
+}
+
+func init() {
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		n := float64(wd)
+		exprVariables[strings.ToLower(wd.String())] = numberExpr(func(dayEnv) float64 { return n })
+	}
+}
+
+// exprFunctions are the functions expressions may call, with how many
+// arguments each takes; -1 means two or more.
+var exprFunctions = map[string]struct {
+	args int
+	fn   func(args []float64) float64
+}{
+	"min": {-1, func(a []float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	}},
+	"max": {-1, func(a []float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	}},
+	"round": {1, func(a []float64) float64 { return math.Round(a[0]) }},
+	"floor": {1, func(a []float64) float64 { return math.Floor(a[0]) }},
+	"ceil":  {1, func(a []float64) float64 { return math.Ceil(a[0]) }},
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+}
+
+// exprCompiler compiles the arithmetic, comparison and logic of Go
+// expressions over the variables and functions above into closures.
+type exprCompiler struct {
+	src string
+}
+
+// text returns the source of n, for errors.
+func (c exprCompiler) text(n ast.Node) string {
+	return c.src[n.Pos()-1 : n.End()-1]
+}
+
+func (c exprCompiler) compile(n ast.Expr) (expr, error) {
+	switch n := n.(type) {
+	case *ast.ParenExpr:
+		return c.compile(n.X)
+	case *ast.BasicLit:
+		if n.Kind != token.INT && n.Kind != token.FLOAT {
+			return expr{}, errorf("%s is not a number", n.Value)
+		}
+		v, _ := constant.Float64Val(constant.MakeFromLiteral(n.Value, n.Kind, 0))
+		return numberExpr(func(dayEnv) float64 { return v }), nil
+	case *ast.Ident:
+		e, ok := exprVariables[n.Name]
+		if !ok {
+			return expr{}, errorf("unknown name %s", n.Name)
+		}
+		return e, nil
+	case *ast.UnaryExpr:
+		return c.unary(n)
+	case *ast.BinaryExpr:
+		return c.binary(n)
+	case *ast.CallExpr:
+		return c.call(n)
+	}
+	return expr{}, errorf("%s is not allowed", c.text(n))
+}
+
+func (c exprCompiler) unary(n *ast.UnaryExpr) (expr, error) {
+	x, err := c.compile(n.X)
+	if err != nil {
+		return expr{}, err
+	}
+	switch {
+	case n.Op == token.NOT && x.isBool():
+		return boolExpr(func(d dayEnv) bool { return !x.boolean(d) }), nil
+	case n.Op == token.SUB && !x.isBool():
+		return numberExpr(func(d dayEnv) float64 { return -x.number(d) }), nil
+	case n.Op == token.ADD && !x.isBool():
+		return x, nil
+	}
+	return expr{}, errorf("%s: cannot apply %s to %s", c.text(n), n.Op, c.text(n.X))
+}
+
+func (c exprCompiler) binary(n *ast.BinaryExpr) (expr, error) {
+	x, err := c.compile(n.X)
+	if err != nil {
+		return expr{}, err
+	}
+	y, err := c.compile(n.Y)
+	if err != nil {
+		return expr{}, err
+	}
+
+	if x.isBool() && y.isBool() {
+		switch n.Op {
+		case token.LAND:
+			return boolExpr(func(d dayEnv) bool { return x.boolean(d) && y.boolean(d) }), nil
+		case token.LOR:
+			return boolExpr(func(d dayEnv) bool { return x.boolean(d) || y.boolean(d) }), nil
+		case token.EQL:
+			return boolExpr(func(d dayEnv) bool { return x.boolean(d) == y.boolean(d) }), nil
+		case token.NEQ:
+			return boolExpr(func(d dayEnv) bool { return x.boolean(d) != y.boolean(d) }), nil
+		}
+	}
+	if !x.isBool() && !y.isBool() {
+		xn, yn := x.number, y.number
+		switch n.Op {
+		case token.ADD:
+			return numberExpr(func(d dayEnv) float64 { return xn(d) + yn(d) }), nil
+		case token.SUB:
+			return numberExpr(func(d dayEnv) float64 { return xn(d) - yn(d) }), nil
+		case token.MUL:
+			return numberExpr(func(d dayEnv) float64 { return xn(d) * yn(d) }), nil
+		case token.QUO:
+			return numberExpr(func(d dayEnv) float64 { return xn(d) / yn(d) }), nil
+		case token.REM:
+			return numberExpr(func(d dayEnv) float64 { return math.Mod(xn(d), yn(d)) }), nil
+		case token.EQL:
+			return boolExpr(func(d dayEnv) bool { return xn(d) == yn(d) }), nil
+		case token.NEQ:
+			return boolExpr(func(d dayEnv) bool { return xn(d) != yn(d) }), nil
+		case token.LSS:
+			return boolExpr(func(d dayEnv) bool { return xn(d) < yn(d) }), nil
+		case token.LEQ:
+			return boolExpr(func(d dayEnv) bool { return xn(d) <= yn(d) }), nil
+		case token.GTR:
+			return boolExpr(func(d dayEnv) bool { return xn(d) > yn(d) }), nil
+		case token.GEQ:
+			return boolExpr(func(d dayEnv) bool { return xn(d) >= yn(d) }), nil
+		}
+	}
+	return expr{}, errorf("%s: cannot apply %s to %s and %s", c.text(n), n.Op, c.text(n.X), c.text(n.Y))
+}
+
+func (c exprCompiler) call(n *ast.CallExpr) (expr, error) {
+	name, ok := n.Fun.(*ast.Ident)
+	if !ok {
+		return expr{}, errorf("%s is not allowed", c.text(n))
+	}
+	f, ok := exprFunctions[name.Name]
+	if !ok {
+		return expr{}, errorf("unknown function %s", name.Name)
+	}
+	if n.Ellipsis.IsValid() || (f.args == -1 && len(n.Args) < 2) || (f.args >= 0 && len(n.Args) != f.args) {
+		return expr{}, errorf("%s: wrong number of arguments", c.text(n))
+	}
+	args := make([]func(dayEnv) float64, len(n.Args))
+	for i, arg := range n.Args {
+		a, err := c.compile(arg)
+		if err != nil {
+			return expr{}, err
+		}
+		if a.isBool() {
+			return expr{}, errorf("%s: %s is not a number", c.text(n), c.text(arg))
+		}
+		args[i] = a.number
+	}
+	return numberExpr(func(d dayEnv) float64 {
+		values := make([]float64, len(args))
+		for i, a := range args {
+			values[i] = a(d)
+		}
+		return f.fn(values)
+	}), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// transformDays returns the days of tweets as day of the month and count.
+func transformDays(tweets []DailyTweet) string {
+	days := make([]string, len(tweets))
+	for i, tweet := range tweets {
+		days[i] = fmt.Sprintf("%d:%d", tweet.Date.Day(), tweet.Count)
+	}
+	return strings.Join(days, " ")
+}
+
+func TestCompileTransform(t *testing.T) {
+	// Monday, Tuesday, Thursday, Saturday and Sunday of the first week of
+	// 2024.
+	tweets := dailyCounts(3, 10, 0, 7, 0, 1, 4)
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"count", "1:3 2:10 4:7 6:1 7:4"},
+		{"count * 2", "1:6 2:20 4:14 6:2 7:8"},
+		{"-(-count) + 0.5e1", "1:8 2:15 4:12 6:6 7:9"},
+		// Counts round to the nearest, halves away from zero.
+		{"count / 4", "1:1 2:3 4:2 6:0 7:1"},
+		{"min(count, 5)", "1:3 2:5 4:5 6:1 7:4"},
+		{"max(count, 2, 4)", "1:4 2:10 4:7 6:4 7:4"},
+		{"abs(count - 5)", "1:2 2:5 4:2 6:4 7:1"},
+		{"floor(count / 3) + ceil(count / 3) + round(0.4)", "1:2 2:7 4:5 6:1 7:3"},
+		{"!weekend", "1:3 2:10 4:7"},
+		{"weekend == true", "6:1 7:4"},
+		{"weekday == saturday || count > 8", "2:10 6:1"},
+		{"sqrt(count) >= 2 && day % 2 == 0", "2:10 4:7"},
+		{"(month == 1) != (year < 2024)", "1:3 2:10 4:7 6:1 7:4"},
+		{"false", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			run, err := compileTransform(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := run(tweets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if days := transformDays(got); days != tt.want {
+				t.Errorf("days %q, want %q", days, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileTransformRejects(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"count +", "expected operand"},
+		{"count = 1", "expected '=='"},
+		{`"ten"`, `"ten" is not a number`},
+		{"'a'", "'a' is not a number"},
+		{"steps", "unknown name steps"},
+		{"log(count)", "unknown function log"},
+		{"min(count)", "min(count): wrong number of arguments"},
+		{"min(count...)", "wrong number of arguments"},
+		{"round(count, 1)", "wrong number of arguments"},
+		{"min(weekend, 2)", "min(weekend, 2): weekend is not a number"},
+		{"!count", "!count: cannot apply ! to count"},
+		{"-weekend", "-weekend: cannot apply - to weekend"},
+		{"count && true", "cannot apply && to count and true"},
+		{"weekend < true", "cannot apply < to weekend and true"},
+		{"1 << 2", "cannot apply << to 1 and 2"},
+		{"count[0]", "count[0] is not allowed"},
+		{"os.Exit(1)", "os.Exit(1) is not allowed"},
+		{"func() int { return 1 }()", "is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := compileTransform(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want one with %q", err, tt.want)
+			}
+		})
+	}
+
+	// compileTransforms names the expression and makes it a usage error.
+	_, err := compileTransforms([]string{"count", "steps"})
+	if _, ok := err.(usageError); !ok || !strings.Contains(err.Error(), `-transform "steps"`) {
+		t.Errorf("error %v, want a usage error naming the expression", err)
+	}
+}
+
+// TestTransformNotCounts checks that days an expression gives a value no
+// count can have fail as malformed data.
+func TestTransformNotCounts(t *testing.T) {
+	for _, src := range []string{"count - 5", "count / 0", "sqrt(0 - count)", "(count - 3) % 4"} {
+		run, err := compileTransform(src)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		_, err = run(dailyCounts(3, 10, 0, 7, 0, 1, 4))
+		wantMalformed(t, err, src)
+	}
+}
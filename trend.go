@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// forecastWindow is how many of the last days the forecast averages.
+const forecastWindow = 28
+
+// monthTotal is the total of a calendar month.
+type monthTotal struct {
+	month time.Time // first day
+	total int
+}
+
+// trend describes where a series is heading: its monthly totals, the slope
+// of the least-squares line through its daily counts and a naive forecast
+// of the rest of the year of the last day, which assumes every day to come
+// averages what the last forecastWindow days did. Days without data count
+// as zero.
+type trend struct {
+	months []monthTotal
+	slope  float64 // change of the daily count per day
+
+	year       int
+	yearToDate int     // total of the year up to and including the last day
+	remaining  int     // days of the year after the last day
+	daily      float64 // average of the last forecastWindow days
+}
+
+// projected returns the total the year is on course for.
+func (t trend) projected() float64 {
+	return float64(t.yearToDate) + t.daily*float64(t.remaining)
+}
+
+// computeTrend returns the trend of tweets, which must not be empty.
+func computeTrend(tweets []DailyTweet) trend {
+	first, last := tweets[0].Date, tweets[len(tweets)-1].Date
+	t := trend{year: last.Year()}
+
+	var counts []float64
+	i := 0
+	for d := first; !d.After(last); d = addDate(d, 0, 0, 1) {
+		n := 0
+		if i < len(tweets) && tweets[i].Date.Equal(d) {
+			n = tweets[i].Count
+			i++
+		}
+		counts = append(counts, float64(n))
+		month := time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, d.Location())
+		if len(t.months) == 0 || !t.months[len(t.months)-1].month.Equal(month) {
+			t.months = append(t.months, monthTotal{month: month})
+		}
+		t.months[len(t.months)-1].total += n
+		if d.Year() == t.year {
+			t.yearToDate += n
+		}
+	}
+
+	// Least squares over x = 0, 1, ... for each day.
+	n := float64(len(counts))
+	var sumX, sumY, sumXY, sumXX float64
+	for x, y := range counts {
+		sumX += float64(x)
+		sumY += y
+		sumXY += float64(x) * y
+		sumXX += float64(x) * float64(x)
+	}
+	if denom := n*sumXX - sumX*sumX; denom != 0 {
+		t.slope = (n*sumXY - sumX*sumY) / denom
+	}
+
+	recent := counts[max(0, len(counts)-forecastWindow):]
+	var total float64
+	for _, c := range recent {
+		total += c
+	}
+	t.daily = total / float64(len(recent))
+	yearEnd := time.Date(t.year, time.December, 31, 0, 0, 0, 0, last.Location())
+	for d := addDate(last, 0, 0, 1); !d.After(yearEnd); d = addDate(d, 0, 0, 1) {
+		t.remaining++
+	}
+	return t
+}
+
+// forecastDays returns the days of the rest of the year of the last day of
+// tweets, each with the daily count the trend expects, for drawing.
+func forecastDays(tweets []DailyTweet) []DailyTweet {
+	if len(tweets) == 0 {
+		return nil
+	}
+	t := computeTrend(tweets)
+	count := int(math.Round(t.daily))
+	var days []DailyTweet
+	for d, i := addDate(tweets[len(tweets)-1].Date, 0, 0, 1), 0; i < t.remaining; d, i = addDate(d, 0, 0, 1), i+1 {
+		days = append(days, DailyTweet{Date: d, Count: count})
+	}
+	return days
+}
+
+// yearTotal sums up a calendar year of the data. Only days from the first
+// day of the data to the last are covered, so the first and last years
+// may be partial; their mean, over the days covered, compares fairly with
+// full years where their total does not.
+type yearTotal struct {
+	year    int
+	covered int // days of the year from the first day of the data to the last
+	total   int
+	best    DailyTweet
+}
+
+// mean returns the daily mean over the days covered.
+func (y yearTotal) mean() float64 {
+	return float64(y.total) / float64(y.covered)
+}
+
+// yearTotals returns the calendar years tweets cover, in order.
+func yearTotals(tweets []DailyTweet) []yearTotal {
+	if len(tweets) == 0 {
+		return nil
+	}
+	var years []yearTotal
+	i := 0
+	last := tweets[len(tweets)-1].Date
+	for d := tweets[0].Date; !d.After(last); d = addDate(d, 0, 0, 1) {
+		if len(years) == 0 || years[len(years)-1].year != d.Year() {
+			years = append(years, yearTotal{year: d.Year(), best: DailyTweet{Date: d}})
+		}
+		y := &years[len(years)-1]
+		y.covered++
+		if i < len(tweets) && tweets[i].Date.Equal(d) {
+			y.total += tweets[i].Count
+			if tweets[i].Count > y.best.Count {
+				y.best = tweets[i]
+			}
+			i++
+		}
+	}
+	return years
+}
+
+// growth writes the change from before to after as a percentage, or "-"
+// when there is nothing to compare with.
+func growth(before, after float64) string {
+	if before == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", 100*(after-before)/before)
+}
+
+// yearRows returns the columns of the year-over-year table of years, the
+// header first: the year, the days covered, the total, its change, the
+// daily mean, its change and the best day with the change of its count.
+func yearRows(years []yearTotal) [][]string {
+	rows := [][]string{{"year", "days", "total", "change", "mean", "change", "best day", "change"}}
+	for i, y := range years {
+		change, meanChange, bestChange := "-", "-", "-"
+		if i > 0 {
+			prev := years[i-1]
+			change = growth(float64(prev.total), float64(y.total))
+			meanChange = growth(prev.mean(), y.mean())
+			bestChange = fmt.Sprintf("%+d", y.best.Count-prev.best.Count)
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(y.year), strconv.Itoa(y.covered), formatCount(y.total), change,
+			fmt.Sprintf("%.2f", y.mean()), meanChange,
+			fmt.Sprintf("%s (%d)", y.best.Date.Format("01-02"), y.best.Count), bestChange,
+		})
+	}
+	return rows
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time with, for example,
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Values left empty are filled in from the build information the Go
+// toolchain embeds.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo returns the version, commit, and build date of the binary.
+func buildInfo() (v, c, d string) {
+	v, c, d = version, commit, buildDate
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		modified := false
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if c == "" {
+					c = s.Value
+				}
+			case "vcs.time":
+				if d == "" {
+					d = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		// A commit set at build time is taken as given.
+		if modified && commit == "" && c != "" {
+			if len(c) > 12 {
+				c = c[:12]
+			}
+			c += "-dirty"
+		}
+	}
+
+	if v == "" {
+		v = "dev"
+	}
+	return v, c, d
+}
+
+// versionString describes the build in one line, as printed by --version
+// and recorded in generated images.
+func versionString() string {
+	v, c, d := buildInfo()
+	s := "heatmap " + v
+	if c != "" {
+		if len(c) > 12 && !strings.HasSuffix(c, "-dirty") {
+			c = c[:12]
+		}
+		s += " (" + c
+		if d != "" {
+			s += ", " + d
+		}
+		s += ")"
+	}
+	return s
+}
+
+func printVersion() {
+	fmt.Println(versionString())
+	fmt.Printf("go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type wakatimeTotal struct {
+	TotalSeconds float64 `json:"total_seconds"`
+}
+
+type wakatimeProject struct {
+	Name       string        `json:"name"`
+	GrandTotal wakatimeTotal `json:"grand_total"`
+}
+
+// wakatimeDay is a single day as found both in API summaries and in the
+// account data export.
+type wakatimeDay struct {
+	Date       string            `json:"date"`
+	GrandTotal wakatimeTotal     `json:"grand_total"`
+	Projects   []wakatimeProject `json:"projects"`
+	Range      struct {
+		Date string `json:"date"`
+	} `json:"range"`
+}
+
+// minutes returns the coding time for the day, limited to the named project
+// when one is given.
+func (d wakatimeDay) minutes(project string) int {
+	if project == "" {
+		return int(d.GrandTotal.TotalSeconds / 60)
+	}
+	for _, p := range d.Projects {
+		if strings.EqualFold(p.Name, project) {
+			return int(p.GrandTotal.TotalSeconds / 60)
+		}
+	}
+	return 0
+}
+
+// readWakaTimeExport reads the JSON file from WakaTime's "export my data"
+// and returns the minutes of coding per day.
+func readWakaTimeExport(filename string, opts sourceOptions) ([]DailyTweet, error) {
+	data, err := opts.Limits.readFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var export struct {
+		Days []wakatimeDay `json:"days"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, errorf("%s: %w", filename, err)
+	}
+
+	totals := make(map[civilDate]int)
+	for _, d := range export.Days {
+		date, err := time.Parse("2006-01-02", d.Date)
+		if err != nil {
+			return nil, err
+		}
+		totals[civil(date)] += d.minutes(opts.Project)
+	}
+
+	return dailyTotals(totals), nil
+}
+
+// fetchWakaTime retrieves the past year of daily summaries from the
+// WakaTime API and returns the minutes of coding per day.
+func fetchWakaTime(ctx context.Context, apiKey string, opts sourceOptions) ([]DailyTweet, error) {
+	if apiKey == "" {
+		return nil, errorf("wakatime: set WAKATIME_API_KEY or pass a data export")
+	}
+
+	totals := make(map[civilDate]int)
+	from, end := lastYear()
+	// Summaries are expensive to compute server-side and long ranges time
+	// out, so request the year a month at a time.
+	err := eachMonth(from, end, func(from, to time.Time) error {
+		query := url.Values{}
+		query.Set("start", from.Format("2006-01-02"))
+		// The end date is inclusive.
+		query.Set("end", addDate(to, 0, 0, -1).Format("2006-01-02"))
+		if opts.Project != "" {
+			query.Set("project", opts.Project)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://wakatime.com/api/v1/users/current/summaries?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(apiKey)))
+
+		var summaries struct {
+			Data []wakatimeDay `json:"data"`
+		}
+		if err := opts.Limits.getJSON(req, &summaries); err != nil {
+			return err
+		}
+
+		for _, d := range summaries.Data {
+			date, err := time.Parse("2006-01-02", d.Range.Date)
+			if err != nil {
+				return err
+			}
+			// The API has already filtered by project.
+			totals[civil(date)] += d.minutes("")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dailyTotals(totals), nil
+}
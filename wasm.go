@@ -0,0 +1,132 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"syscall/js"
+)
+
+// wasmOptions are the options of render in the JavaScript API that are
+// not render flags. The others are named like the render flags of
+// generate, with underscores for dashes, and set them.
+type wasmOptions struct {
+	Format    string   `json:"format"`
+	Column    string   `json:"column"`
+	Transform []string `json:"transform"`
+}
+
+// wasmHidden are the render flags the JavaScript API leaves out: there are
+// no files to read in the browser.
+var wasmHidden = map[string]bool{"icc-profile": true}
+
+// main of the WebAssembly build registers heatmapRender for wasm/heatmap.js
+// to wrap and keeps the program alive to serve calls.
+func main() {
+	js.Global().Set("heatmapRender", js.FuncOf(jsRender))
+	select {}
+}
+
+// jsRender is heatmapRender(data, options). data is CSV text as the csv
+// source reads it, or an array of {date, count} or {time} points as the
+// webhook accepts them. It returns {result} with a Uint8Array of PNG or a
+// string of SVG, or {error}.
+func jsRender(this js.Value, args []js.Value) any {
+	if len(args) < 1 {
+		return jsResult(nil, "", errors.New(tr("render needs the data")))
+	}
+	options := "{}"
+	if len(args) > 1 && args[1].Truthy() {
+		options = js.Global().Get("JSON").Call("stringify", args[1]).String()
+	}
+	var data string
+	csv := args[0].Type() == js.TypeString
+	if csv {
+		data = args[0].String()
+	} else {
+		data = js.Global().Get("JSON").Call("stringify", args[0]).String()
+	}
+	out, format, err := renderWASM(data, csv, options)
+	return jsResult(out, format, err)
+}
+
+func renderWASM(data string, csv bool, options string) ([]byte, string, error) {
+	o := wasmOptions{Format: "png"}
+	if err := json.Unmarshal([]byte(options), &o); err != nil {
+		return nil, "", errorf("invalid options: %v", err)
+	}
+	if _, ok := outputFormats[o.Format]; !ok {
+		return nil, "", errorf("unknown format %q", o.Format)
+	}
+	var params map[string]any
+	decoder := json.NewDecoder(strings.NewReader(options))
+	decoder.UseNumber()
+	if err := decoder.Decode(&params); err != nil {
+		return nil, "", errorf("invalid options: %v", err)
+	}
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	f := addRenderFlags(fs)
+	for param, value := range params {
+		if value == nil || param == "format" || param == "column" || param == "transform" {
+			continue
+		}
+		name := strings.ReplaceAll(param, "_", "-")
+		if fs.Lookup(name) == nil || wasmHidden[name] {
+			return nil, "", errorf("unknown option %q", param)
+		}
+		if err := setParam(fs, name, param, fmt.Sprint(value)); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var tweets []DailyTweet
+	if csv {
+		var err error
+		if tweets, _, err = parseCSV(strings.NewReader(data), o.Column, defaultLimits); err != nil {
+			return nil, "", errorf("invalid CSV: %v", err)
+		}
+	} else {
+		var points []webhookPoint
+		if err := json.Unmarshal([]byte(data), &points); err != nil {
+			return nil, "", errors.New(tr("data must be CSV text or an array of points"))
+		}
+		totals, err := sumPoints(points)
+		if err != nil {
+			return nil, "", err
+		}
+		tweets = dailyTotals(totals)
+	}
+	expressions, err := compileTransforms(o.Transform)
+	if err != nil {
+		return nil, "", err
+	}
+	if tweets, _, err = transformData(tweets, expressions); err != nil {
+		return nil, "", err
+	}
+
+	opts, err := f.options("Tweet Activity Heatmap")
+	if err != nil {
+		return nil, "", err
+	}
+	out, err := renderHeatmap(context.Background(), o.Format, tweets, opts)
+	return out, o.Format, err
+}
+
+func jsResult(out []byte, format string, err error) any {
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	if format == "svg" || format == "txt" {
+		return map[string]any{"result": string(out)}
+	}
+	array := js.Global().Get("Uint8Array").New(len(out))
+	js.CopyBytesToJS(array, out)
+	return map[string]any{"result": array}
+}
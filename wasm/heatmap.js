@@ -0,0 +1,46 @@
+// heatmap.js wraps the WebAssembly build of heatmap-generator, so web apps
+// can render heatmaps in the browser with the same engine as the CLI.
+//
+// Build heatmap.wasm and copy the Go runtime support next to it:
+//
+//   GOOS=js GOARCH=wasm go build -o heatmap.wasm .
+//   cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// Load wasm_exec.js before this module, then:
+//
+//   import { loadHeatmap } from "./heatmap.js";
+//   const heatmap = await loadHeatmap("heatmap.wasm");
+//   const png = heatmap.render([{ date: "2024-05-01", count: 3 }], { theme: "dark" });
+//   const svg = heatmap.render(csvText, { format: "svg" });
+
+// loadHeatmap fetches and starts the WebAssembly module. It resolves to an
+// object with render(data, options).
+export async function loadHeatmap(url = "heatmap.wasm") {
+  if (typeof Go === "undefined") {
+    throw new Error("heatmap: load wasm_exec.js before heatmap.js");
+  }
+  const go = new Go();
+  const response = fetch(url);
+  const { instance } = WebAssembly.instantiateStreaming
+    ? await WebAssembly.instantiateStreaming(response, go.importObject)
+    : await WebAssembly.instantiate(await (await response).arrayBuffer(), go.importObject);
+  go.run(instance);
+
+  return {
+    // render draws a heatmap. data is CSV text as the CLI reads it (a
+    // header, then YYYYMMDD,count rows) or an array of {date: "YYYY-MM-DD",
+    // count} or {time: RFC 3339} points. options takes format ("png",
+    // "svg", "txt" or "xlsx"), column, transform, an array of expressions,
+    // and the render flags of generate but icc_profile, named with
+    // underscores for dashes: theme, cell, weekday_chart, thresholds and
+    // so on. PNG and xlsx come back as a Uint8Array, SVG and text as a
+    // string.
+    render(data, options = {}) {
+      const { result, error } = globalThis.heatmapRender(data, options);
+      if (error !== undefined) {
+        throw new Error("heatmap: " + error);
+      }
+      return result;
+    },
+  };
+}
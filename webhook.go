@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits on a single webhook request.
+const (
+	maxWebhookBody   = 1 << 20
+	maxWebhookPoints = 10000
+)
+
+// webhookMu serializes updates to input files, which routes may share.
+var webhookMu sync.Mutex
+
+// webhookPoint is one data point in a webhook request: either a date and a
+// count to add to it, or the time of a single event, which adds one.
+type webhookPoint struct {
+	Date  string `json:"date"`
+	Count *int   `json:"count"`
+	Time  string `json:"time"`
+}
+
+// receive handles data points POSTed to the server's path. The body is a
+// JSON point or array of points:
+//
+//	{"date": "2024-05-01", "count": 3}
+//	[{"time": "2024-05-01T21:30:00+09:00"}, {"time": "2024-05-02T08:00:00Z"}]
+//
+// Counts are added to the stored series, which must be a CSV input file,
+// and the default image is rendered again in the background so the next
+// request finds it cached.
+func (s *heatmapServer) receive(w http.ResponseWriter, r *http.Request) {
+	input := s.source.inputPath(s.fs)
+	if s.source.name != "csv" || input == "" {
+		http.Error(w, "webhook requires a csv input file", http.StatusConflict)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	additions, accepted, err := parseWebhookPoints(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	days, err := addToCSV(input, s.source.options.Column, additions, s.source.options.Limits)
+	if err != nil {
+		var ee *exitError
+		switch {
+		case errors.Is(err, errWebhookColumns):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.As(err, &ee) && ee.code == exitParse:
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			slog.Error("storing webhook data failed", "file", input, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	slog.Info("webhook data stored", "path", s.path, "file", input, "points", accepted)
+
+	go s.warm()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Accepted int `json:"accepted"`
+		Days     int `json:"days"`
+	}{accepted, days})
+}
+
+// parseWebhookPoints decodes a webhook body into counts to add per day.
+func parseWebhookPoints(body []byte) (map[civilDate]int, int, error) {
+	var points []webhookPoint
+	if err := json.Unmarshal(body, &points); err != nil {
+		var point webhookPoint
+		if err := json.Unmarshal(body, &point); err != nil {
+			return nil, 0, errors.New(tr("body must be a JSON point or array of points"))
+		}
+		points = []webhookPoint{point}
+	}
+	if len(points) == 0 {
+		return nil, 0, errors.New(tr("no points given"))
+	}
+	if len(points) > maxWebhookPoints {
+		return nil, 0, errorf("more than %d points in one request", maxWebhookPoints)
+	}
+	additions, err := sumPoints(points)
+	if err != nil {
+		return nil, 0, err
+	}
+	return additions, len(points), nil
+}
+
+// sumPoints adds up points per day.
+func sumPoints(points []webhookPoint) (map[civilDate]int, error) {
+	additions := make(map[civilDate]int)
+	for i, p := range points {
+		switch {
+		case p.Date != "" && p.Time == "":
+			date, err := time.Parse("2006-01-02", p.Date)
+			if err != nil {
+				return nil, errorf("point %d: invalid date %q", i+1, p.Date)
+			}
+			count := 1
+			if p.Count != nil {
+				count = *p.Count
+			}
+			if count < 0 {
+				return nil, errorf("point %d: negative count", i+1)
+			}
+			additions[civil(date)] += count
+		case p.Time != "" && p.Date == "" && p.Count == nil:
+			t, err := time.Parse(time.RFC3339, p.Time)
+			if err != nil {
+				return nil, errorf("point %d: invalid time %q", i+1, p.Time)
+			}
+			// Events count toward the day in their own time zone.
+			additions[civil(t)]++
+		default:
+			return nil, errorf("point %d: give either date and count, or time", i+1)
+		}
+	}
+	return additions, nil
+}
+
+// errWebhookColumns refuses to update a file whose other columns rewriting
+// it would lose.
+var errWebhookColumns = errors.New("webhook can only update files of a date and a count")
+
+// webhookHeader returns the header of the CSV file addToCSV rewrites, or
+// nil when there is no file yet. The file is written back as a date and a
+// count, so one with more columns, or whose count is not the column that
+// column names, is refused.
+func webhookHeader(filename, column string) ([]string, error) {
+	file, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	header, err := csv.NewReader(file).Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	valueColumn := 1
+	if column != "" {
+		valueColumn = headerIndex(header, column)
+	}
+	if len(header) > 2 || (len(header) == 2 && valueColumn != 1) || (len(header) == 1 && column != "") {
+		return nil, errorf("%s has the columns %q: %w", filename, strings.Join(header, ","), errWebhookColumns)
+	}
+	return header, nil
+}
+
+// addToCSV adds counts to the days of a CSV input file, creating it if
+// needed, and returns the number of days it then holds. The file is read
+// with the value column that column names, and written back as dates and
+// counts under the header it had; an event log of one column becomes
+// dates and counts.
+func addToCSV(filename, column string, additions map[civilDate]int, limits inputLimits) (int, error) {
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+
+	header, err := webhookHeader(filename, column)
+	if err != nil {
+		return 0, err
+	}
+	totals := make(map[civilDate]int)
+	if header != nil {
+		tweets, err := readCSV(filename, column, limits)
+		if err != nil {
+			return 0, err
+		}
+		for _, tweet := range tweets {
+			totals[civil(tweet.Date)] = tweet.Count
+		}
+	}
+	if len(header) != 2 {
+		header = csvHeader
+	}
+
+	for date, count := range additions {
+		totals[date] += count
+	}
+	tweets := dailyTotals(totals)
+	if err := limits.checkCounts(tweets); err != nil {
+		return 0, err
+	}
+
+	// Replace the file in one step so readers never see it half written,
+	// keeping its mode rather than the 0600 of temporary files.
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".heatmap-*.csv")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := writeCSVHeader(tmp, header, tweets); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return len(tweets), os.Rename(tmp.Name(), filename)
+}
+
+// warm renders the image with default options into the cache.
+func (s *heatmapServer) warm() {
+	tweets, defaultTitle, err := s.source.load(context.Background(), s.fs)
+	if err != nil {
+		return
+	}
+	none := func(string) bool { return false }
+	opts, err := requestRenderOptions(s.render, func(string) string { return "" }, none, defaultTitle)
+	if err != nil {
+		return
+	}
+	etag, _ := s.versionOf(tweets, s.format, opts)
+	if _, _, err := s.renderCached(context.Background(), etag, s.format, tweets, opts); err != nil {
+		slog.Error("rendering failed", "err", err)
+	}
+}
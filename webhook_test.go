@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func readTestFile(t *testing.T, filename string) string {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// added returns additions of count on the day of date, as YYYY-MM-DD.
+func added(date string, count int) map[civilDate]int {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		panic(err)
+	}
+	return map[civilDate]int{civil(t): count}
+}
+
+func TestAddToCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string // "" for no file
+		column string
+		want   string
+	}{
+		{"new file", "", "", "date,tweet_count\n20240501,3\n"},
+		{"date and count", "date,count\n20240430,1\n20240501,2\n", "", "date,count\n20240430,1\n20240501,5\n"},
+		{"named column", "day,steps\n2024-05-01,7000\n", "steps", "day,steps\n20240501,7003\n"},
+		{"event log", "date\n20240501\n20240501\n", "", "date,tweet_count\n20240501,5\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "input.csv")
+			if tt.input != "" {
+				filename = writeTestFile(t, tt.input)
+			}
+			if _, err := addToCSV(filename, tt.column, added("2024-05-01", 3), defaultLimits); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTestFile(t, filename); got != tt.want {
+				t.Errorf("file holds %q, want %q", got, tt.want)
+			}
+			// The server reads the file back as its source does.
+			if _, err := readCSV(filename, tt.column, defaultLimits); err != nil {
+				t.Errorf("reading the file back: %v", err)
+			}
+		})
+	}
+}
+
+// TestAddToCSVKeepsColumns checks that files whose other columns rewriting
+// would lose are left alone.
+func TestAddToCSVKeepsColumns(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		column string
+	}{
+		{"several values", "date,steps,floors\n2024-05-01,7000,12\n", "steps"},
+		{"not the second column", "date,floors,steps\n2024-05-01,12,7000\n", "steps"},
+		{"categories", "date,count,category\n20240501,2,work\n", ""},
+		{"event log with a column", "date\n20240501\n", "steps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeTestFile(t, tt.input)
+			_, err := addToCSV(filename, tt.column, added("2024-05-01", 3), defaultLimits)
+			if !errors.Is(err, errWebhookColumns) {
+				t.Errorf("got error %v, want %v", err, errWebhookColumns)
+			}
+			if got := readTestFile(t, filename); got != tt.input {
+				t.Errorf("file changed to %q", got)
+			}
+		})
+	}
+}
+
+func TestAddToCSVMaxCount(t *testing.T) {
+	input := "date,tweet_count\n20240501,8\n"
+	filename := writeTestFile(t, input)
+	limits := defaultLimits
+	limits.MaxCount = 10
+	_, err := addToCSV(filename, "", added("2024-05-01", 3), limits)
+	wantMalformed(t, err, "count past -max-count")
+	if got := readTestFile(t, filename); got != input {
+		t.Errorf("file changed to %q", got)
+	}
+}
+
+// TestAddToCSVKeepsMode checks that writing the file back keeps its mode,
+// and that a new file gets the mode of the files generate writes.
+func TestAddToCSVKeepsMode(t *testing.T) {
+	filename := writeTestFile(t, "date,tweet_count\n20240501,8\n")
+	if err := os.Chmod(filename, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(t.TempDir(), "new.csv")
+	for file, want := range map[string]os.FileMode{filename: 0o640, created: 0o644} {
+		if _, err := addToCSV(file, "", added("2024-05-01", 3), defaultLimits); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: mode %v, want %v", filepath.Base(file), got, want)
+		}
+	}
+}
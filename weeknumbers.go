@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strconv"
+
+	"golang.org/x/image/font"
+)
+
+// weekNumberSides are where -week-numbers-at puts the week numbers: in the
+// gap between the title and the month names, or in a row under the grid.
+var weekNumberSides = []string{"top", "bottom"}
+
+// weekNumbersHeight is the height of the row of week numbers under the
+// grid.
+const weekNumbersHeight = 18
+
+// checkWeekNumbers validates -week-numbers, every how many weeks to number
+// the columns, 0 for none, and -week-numbers-at.
+func checkWeekNumbers(every int, at string, opts renderOptions) (int, string, error) {
+	switch {
+	case every < 0:
+		return 0, "", usageError(trf("week-numbers must be a number of weeks, not %d", every))
+	case at != "top" && at != "bottom":
+		return 0, "", usageError(trf("week-numbers-at must be top or bottom, not %q", at))
+	case every > 0 && (opts.Layout != "" || opts.Card):
+		return 0, "", usageError(tr("-week-numbers numbers the columns of the year layout; it does not apply to -layout or -card"))
+	}
+	return every, at, nil
+}
+
+// addWeekNumbers numbers the columns of the grid of hm with the ISO week
+// most of their days fall in, that of the middle one, for weeks 1 and every
+// opts.WeekNumbers after it, centered on the column where they fit: with
+// the baseline at y when opts.WeekNumbersAt is top, otherwise in a row from
+// y down, whose bottom it returns.
+func (l *layout) addWeekNumbers(face font.Face, hm heatmap, opts renderOptions, y int) int {
+	cell, gap := opts.cellSize(), opts.Theme.Gap
+	baseline, bottom := y, y
+	if opts.WeekNumbersAt == "bottom" {
+		bottom = y + weekNumbersHeight
+		baseline = bottom - 3
+		l.height = max(l.height, bottom+5)
+	}
+	for week := 0; week < numWeeks; week++ {
+		_, number := addDate(hm.start, 0, 0, week*7+3).ISOWeek()
+		if (number-1)%opts.WeekNumbers != 0 {
+			continue
+		}
+		text := strconv.Itoa(number)
+		width := font.MeasureString(face, text).Ceil()
+		l.addLabel(face, layoutText{max(week*(cell+gap)+cell/2-width/2, 0), baseline, text})
+	}
+	return bottom
+}
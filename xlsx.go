@@ -0,0 +1,208 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+// The xlsx format writes the year grid into a spreadsheet: a row a weekday
+// and a column a week, as in the image, under the date each week starts,
+// with conditional formatting that colors the counts by the ranges of the
+// heatmap's scale in the theme's colors, so the sheet stays colored as its
+// numbers are edited. The legend follows the grid.
+
+// xlsxRange is the counts from lo to hi, or from lo up when open, that a
+// color of the scale stands for.
+type xlsxRange struct {
+	lo, hi int
+	open   bool
+	color  color.RGBA
+	label  string
+}
+
+// scaleRanges finds the counts each legend entry of scale stands for, up
+// to most, by searching for where its colors change. Scales color counts
+// in the order of their legend, so each color has one run of counts.
+func scaleRanges(scale colorScale, most int) []xlsxRange {
+	entries := scale.legendEntries()
+	index := func(v int) int {
+		c := scale.colorFor(v)
+		for i, e := range entries {
+			if e.color == c {
+				return i
+			}
+		}
+		return len(entries)
+	}
+	var ranges []xlsxRange
+	lo := 0
+	for i, e := range entries {
+		if lo > most || index(lo) > i {
+			continue // no counts of the data's range have this color
+		}
+		if i == len(entries)-1 {
+			ranges = append(ranges, xlsxRange{lo: lo, open: true, color: e.color, label: e.label})
+			break
+		}
+		// The last count with this color or one before it.
+		a, b := lo, most
+		for a < b {
+			m := a + (b-a+1)/2
+			if index(m) <= i {
+				a = m
+			} else {
+				b = m - 1
+			}
+		}
+		r := xlsxRange{lo: lo, hi: a, color: e.color, label: e.label}
+		if a == most {
+			r.open = true
+		}
+		ranges = append(ranges, r)
+		if r.open {
+			break
+		}
+		lo = a + 1
+	}
+	return ranges
+}
+
+// xlsxColumn returns the letters of the 0-based column i.
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxARGB returns c as the ARGB hex spreadsheets take.
+func xlsxARGB(c color.RGBA) string {
+	return fmt.Sprintf("FF%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// renderXLSX writes the year of tweets as an xlsx workbook of one sheet.
+func renderXLSX(tweets []DailyTweet, opts renderOptions) ([]byte, error) {
+	switch {
+	case opts.Layout != "":
+		return nil, usageError(tr("xlsx output holds the year of weeks; -layout does not apply"))
+	case opts.Normalize != "" || opts.Categories != "":
+		return nil, usageError(tr("xlsx output colors the counts; -normalize and -categories do not apply"))
+	}
+	hm := newHeatmap(tweets, opts)
+	most := 0
+	for _, count := range hm.counts {
+		most = max(most, count)
+	}
+	ranges := scaleRanges(hm.scale, most)
+
+	escape := func(s string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	}
+	text := func(ref, s string, style int) string {
+		return fmt.Sprintf(`<c r="%s" t="inlineStr" s="%d"><is><t>%s</t></is></c>`, ref, style, escape(s))
+	}
+
+	var sheet strings.Builder
+	sheet.WriteString(xml.Header)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if opts.RTL {
+		// Spreadsheets lay the sheet out right to left themselves.
+		sheet.WriteString(`<sheetViews><sheetView rightToLeft="1" workbookViewId="0"/></sheetViews>`)
+	}
+	sheet.WriteString(`<sheetData>`)
+	fmt.Fprintf(&sheet, `<row r="1">%s</row>`, text("A1", opts.Title, 0))
+	sheet.WriteString(`<row r="2">`)
+	for week := 0; week < numWeeks; week++ {
+		sheet.WriteString(text(fmt.Sprintf("%s2", xlsxColumn(week+1)), addDate(hm.start, 0, 0, week*7).Format("2006-01-02"), 0))
+	}
+	sheet.WriteString(`</row>`)
+	for day := 0; day < daysInWeek; day++ {
+		row := day + 3
+		fmt.Fprintf(&sheet, `<row r="%d">%s`, row, text(fmt.Sprintf("A%d", row), addDate(hm.start, 0, 0, day).Weekday().String()[:3], 0))
+		for week := 0; week < numWeeks; week++ {
+			if count, ok := hm.counts[civil(addDate(hm.start, 0, 0, week*7+day))]; ok {
+				fmt.Fprintf(&sheet, `<c r="%s%d"><v>%d</v></c>`, xlsxColumn(week+1), row, count)
+			}
+		}
+		sheet.WriteString(`</row>`)
+	}
+	// The legend, each label filled with its color by cell style i+1.
+	legendRow := daysInWeek + 4
+	for i, r := range ranges {
+		row := legendRow + i
+		fmt.Fprintf(&sheet, `<row r="%d">%s</row>`, row, text(fmt.Sprintf("A%d", row), r.label, i+1))
+	}
+	sheet.WriteString(`</sheetData>`)
+	fmt.Fprintf(&sheet, `<conditionalFormatting sqref="B3:%s%d">`, xlsxColumn(numWeeks), daysInWeek+2)
+	for i, r := range ranges {
+		if r.open {
+			fmt.Fprintf(&sheet, `<cfRule type="cellIs" dxfId="%d" priority="%d" operator="greaterThanOrEqual"><formula>%d</formula></cfRule>`, i, i+1, r.lo)
+		} else {
+			fmt.Fprintf(&sheet, `<cfRule type="cellIs" dxfId="%d" priority="%d" operator="between"><formula>%d</formula><formula>%d</formula></cfRule>`, i, i+1, r.lo, r.hi)
+		}
+	}
+	sheet.WriteString(`</conditionalFormatting></worksheet>`)
+
+	var styles strings.Builder
+	styles.WriteString(xml.Header)
+	styles.WriteString(`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	styles.WriteString(`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>`)
+	fmt.Fprintf(&styles, `<fills count="%d"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>`, len(ranges)+2)
+	for _, r := range ranges {
+		fmt.Fprintf(&styles, `<fill><patternFill patternType="solid"><fgColor rgb="%s"/></patternFill></fill>`, xlsxARGB(r.color))
+	}
+	styles.WriteString(`</fills><borders count="1"><border/></borders>`)
+	styles.WriteString(`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	fmt.Fprintf(&styles, `<cellXfs count="%d"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`, len(ranges)+1)
+	for i := range ranges {
+		fmt.Fprintf(&styles, `<xf numFmtId="0" fontId="0" fillId="%d" borderId="0" xfId="0" applyFill="1"/>`, i+2)
+	}
+	fmt.Fprintf(&styles, `</cellXfs><dxfs count="%d">`, len(ranges))
+	for _, r := range ranges {
+		fmt.Fprintf(&styles, `<dxf><fill><patternFill patternType="solid"><bgColor rgb="%s"/></patternFill></fill></dxf>`, xlsxARGB(r.color))
+	}
+	styles.WriteString(`</dxfs></styleSheet>`)
+
+	files := []struct{ name, body string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Heatmap" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+		{"xl/styles.xml", styles.String()},
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(f.body)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}